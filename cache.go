@@ -0,0 +1,202 @@
+package query
+
+import (
+	"container/list"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// queryCache is a concurrency safe LRU cache of parsed queries.
+type queryCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	query Query
+}
+
+func newQueryCache(size int) (c *queryCache) {
+	return &queryCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+// cacheKey returns a canonical encoding of params: keys are sorted and the
+// order of values of every key is preserved.
+func cacheKey(params url.Values) (key string) {
+	return params.Encode()
+}
+
+// isCacheable reports whether the parsed query of params may be cached.
+// The values and the elements of the multi-value ones that are relative
+// date expressions, i.e. "now-7d", are converted at the time of parsing.
+func isCacheable(params url.Values) (ok bool) {
+	for _, values := range params {
+		for _, val := range values {
+			if hasRelativeDate(val) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// hasRelativeDate reports whether a value or an element of a multi-value
+// one is a relative date expression.
+func hasRelativeDate(val string) (ok bool) {
+	for _, elem := range strings.Split(val, arrayDelimiter) {
+		if isRelativeDate(elem) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasRelativeDefaults reports whether a default value of a field is
+// a relative date expression. The defaults are added to almost every
+// query, so no query is cached then.
+func (p *Parser) hasRelativeDefaults() (ok bool) {
+	for _, field := range p.Fields {
+		if field.Default != nil && hasRelativeDate(field.Default.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get returns a copy of the cached query.
+func (c *queryCache) Get(key string) (q Query, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return q, false
+	}
+
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*cacheEntry).query.Clone(), true
+}
+
+// Put stores a copy of the query in the cache evicting the least recently
+// used entry when the cache is full.
+func (c *queryCache) Put(key string, q Query) {
+	q = q.Clone()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).query = q
+		c.order.MoveToFront(elem)
+
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, query: q})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of cached queries.
+func (c *queryCache) Len() (n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// CacheOption configures the cache of Parser.EnableCache.
+type CacheOption int
+
+const (
+	// CacheHooks enables the cache for a parser with hooks, i.e. the field
+	// converters, Field.Validate, Field.Transform, Parser.Bool and Build of
+	// the custom operators. The hooks are assumed to depend on the values
+	// only, the cached queries are not built by them again.
+	CacheHooks CacheOption = 1 << iota
+)
+
+// EnableCache enables an LRU cache of successfully parsed queries of the
+// given size. A non-positive size disables the cache. Cached queries are
+// keyed by the canonical encoding of url values and are returned as deep
+// copies, so callers may modify them freely.
+//
+// The cache assumes that the parser's converters are deterministic, i.e.
+// the same value is always converted to the same result. The queries with
+// the relative date expressions, i.e. "now-7d", are parsed every time and
+// never cached, as are all the queries when such an expression is
+// a Field.Default value. The hooks may depend on more than the values, so
+// a parser with hooks is reported with ErrCacheUnsafe listing them and
+// the cache stays disabled unless CacheHooks is given. Like any other
+// configuration, EnableCache must be called before the first call to Parse.
+func (p *Parser) EnableCache(size int, opts ...CacheOption) (err error) {
+	p.cache = nil
+
+	if size <= 0 {
+		return nil
+	}
+
+	var options CacheOption
+	for _, opt := range opts {
+		options |= opt
+	}
+
+	if hooks := p.cacheHooks(); options&CacheHooks == 0 && len(hooks) > 0 {
+		return fmt.Errorf("enable cache: %w: %s", ErrCacheUnsafe,
+			strings.Join(hooks, ", "))
+	}
+
+	p.cache = newQueryCache(size)
+
+	return nil
+}
+
+// cacheHooks returns the sorted names of the parser's hooks, i.e.
+// "created.Converter" or "operator exclusive.Build".
+func (p *Parser) cacheHooks() (hooks []string) {
+	if p.Bool != nil {
+		hooks = append(hooks, "Bool")
+	}
+
+	for name, field := range p.Fields {
+		if !isNilConverter(field.Converter) {
+			hooks = append(hooks, name+".Converter")
+		}
+
+		if field.Validate != nil {
+			hooks = append(hooks, name+".Validate")
+		}
+
+		if field.Transform != nil {
+			hooks = append(hooks, name+".Transform")
+		}
+	}
+
+	for op, spec := range p.operators {
+		if spec.Build != nil {
+			hooks = append(hooks, "operator "+string(op)+".Build")
+		}
+	}
+
+	sort.Strings(hooks)
+
+	return hooks
+}
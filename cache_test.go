@@ -0,0 +1,259 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest
+func TestParserCache(t *testing.T) {
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+	assert.NoError(t, p.EnableCache(2))
+
+	params := url.Values{
+		"a__in":  []string{"1,2"},
+		"b":      []string{"x"},
+		"__sort": []string{"-a"},
+	}
+
+	q1, err := p.Parse(params)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.cache.Len())
+
+	// corrupt the returned query, the cache must not be affected
+	q1.Filter["a"].(M)["$in"].([]interface{})[0] = "corrupted"
+	q1.Filter["b"] = "corrupted"
+	q1.Sort.([]map[string]interface{})[0]["a"] = 1
+
+	q2, err := p.Parse(url.Values{
+		"__sort": []string{"-a"},
+		"b":      []string{"x"},
+		"a__in":  []string{"1,2"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{
+		"a": M{"$in": []interface{}{int64(1), int64(2)}},
+		"b": "x",
+	}, q2.Filter)
+	assert.Equal(t, []map[string]interface{}{{"a": -1}}, q2.Sort)
+	assert.Equal(t, 1, p.cache.Len())
+
+	_, err = p.Parse(url.Values{"__limit": []string{"x"}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, p.cache.Len(), "errors must not be cached")
+
+	_, _ = p.Parse(url.Values{"c": []string{"1"}})
+	_, _ = p.Parse(params)
+	_, _ = p.Parse(url.Values{"d": []string{"1"}})
+	assert.Equal(t, 2, p.cache.Len())
+
+	_, hasParams := p.cache.Get(cacheKey(params))
+	_, hasC := p.cache.Get(cacheKey(url.Values{"c": []string{"1"}}))
+
+	assert.True(t, hasParams, "recently used entry must stay")
+	assert.False(t, hasC, "least recently used entry must be evicted")
+
+	assert.NoError(t, p.EnableCache(0))
+	assert.Nil(t, p.cache)
+}
+
+//nolint:paralleltest
+func TestParserCacheRelativeDate(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"created": Field{Converter: RelativeDate(func() time.Time {
+				return now
+			})},
+		},
+	}
+	assert.NoError(t, p.EnableCache(2, CacheHooks))
+
+	params := url.Values{"created__gte": []string{"now-1d"}}
+
+	q, err := p.Parse(params)
+	assert.NoError(t, err)
+	assert.Equal(t, M{"created": M{"$gte": now.AddDate(0, 0, -1)}}, q.Filter)
+
+	now = now.Add(time.Hour)
+
+	q, err = p.Parse(params)
+	assert.NoError(t, err)
+	assert.Equal(t, M{"created": M{"$gte": now.AddDate(0, 0, -1)}}, q.Filter)
+
+	now = now.Add(time.Hour)
+
+	q, err = p.ParseStrict(url.Values{
+		"created__between": []string{"startOfDay,now"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{"created": M{
+		"$gte": time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		"$lte": now,
+	}}, q.Filter)
+
+	now = now.Add(time.Hour)
+
+	q, warnings := p.ParseLenient(params)
+	assert.Empty(t, warnings)
+	assert.Equal(t, M{"created": M{"$gte": now.AddDate(0, 0, -1)}}, q.Filter)
+
+	assert.Equal(t, 0, p.cache.Len())
+
+	// an expression is never cached whatever the field, the other values are
+	_, err = p.Parse(url.Values{"name": []string{"now"}})
+	assert.NoError(t, err)
+	_, err = p.Parse(url.Values{"name": []string{"nowhere"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.cache.Len())
+}
+
+//nolint:paralleltest
+func TestParserCacheRelativeDefault(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"a": Field{},
+			"created": Field{
+				Converter: RelativeDate(func() time.Time { return now }),
+				Default:   &FieldDefault{Operator: "gte", Value: "now-1d"},
+			},
+		},
+	}
+	assert.NoError(t, p.EnableCache(2, CacheHooks))
+
+	for i := 0; i < 3; i++ {
+		q, err := p.Parse(url.Values{"a": []string{"1"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"a":       int64(1),
+			"created": M{"$gte": now.AddDate(0, 0, -1)},
+		}, q.Filter)
+
+		now = now.Add(time.Hour)
+	}
+
+	assert.Equal(t, 0, p.cache.Len())
+}
+
+//nolint:paralleltest
+func TestParserCacheHooks(t *testing.T) {
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"a": Field{},
+			"b": Field{Converter: Int()},
+			"c": Field{Transform: func(v interface{}) (interface{}, error) {
+				return v, nil
+			}},
+			"d": Field{Validate: func(v interface{}) error { return nil }},
+		},
+		Bool: BoolTokens([]string{"1"}, []string{"0"}),
+	}
+
+	assert.NoError(t, p.RegisterOperator("exclusive", OperatorSpec{
+		Build: func(string, []interface{}) (interface{}, error) {
+			return M{}, nil
+		},
+	}))
+
+	err := p.EnableCache(2)
+	assert.True(t, errors.Is(err, ErrCacheUnsafe))
+	assert.EqualError(t, err, "enable cache: cache is unsafe: Bool, "+
+		"b.Converter, c.Transform, d.Validate, operator exclusive.Build")
+	assert.Nil(t, p.cache)
+
+	_, err = p.Parse(url.Values{"a": []string{"1"}})
+	assert.NoError(t, err)
+	assert.Nil(t, p.cache)
+
+	// the hooks are cached with the explicit opt-in
+	assert.NoError(t, p.EnableCache(2, CacheHooks))
+
+	_, err = p.Parse(url.Values{"a": []string{"1"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.cache.Len())
+
+	// a failed EnableCache disables the cache enabled before
+	assert.Error(t, p.EnableCache(2))
+	assert.Nil(t, p.cache)
+
+	p = Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields:    Fields{"a": Field{DBName: "x"}},
+	}
+	assert.NoError(t, p.EnableCache(2))
+	assert.NotNil(t, p.cache)
+}
+
+func TestParserCacheConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const goroutines = 200
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+	assert.NoError(t, p.EnableCache(4))
+
+	var wg sync.WaitGroup
+
+	wg.Add(goroutines)
+
+	for i := 0; i < goroutines; i++ {
+		go func(n int) {
+			defer wg.Done()
+
+			v := string(rune('a' + n%8))
+
+			q, err := p.Parse(url.Values{"f__in": []string{v + ",z"}})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"f": M{"$in": []interface{}{v, "z"}}},
+				q.Filter)
+
+			q.Filter["f"].(M)["$in"].([]interface{})[0] = "corrupted"
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkParserCache(b *testing.B) {
+	params := url.Values{
+		"name":         []string{"John"},
+		"age__lte":     []string{"45"},
+		"category__in": []string{"A,B,C"},
+		"email__ico":   []string{"@example.com"},
+		"__limit":      []string{"10"},
+		"__sort":       []string{"-age,name"},
+	}
+
+	for _, size := range []int{0, 16} {
+		p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+		if err := p.EnableCache(size); err != nil {
+			b.Fatal(err)
+		}
+
+		name := "miss"
+		if size > 0 {
+			name = "hit"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Parse(params); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package query
+
+import "errors"
+
+// ErrorCode is a stable machine-readable category of a parse error, i.e.
+// "unknown_operator". Unlike the messages, the codes never change.
+type ErrorCode string
+
+// Error codes of the parse errors.
+const (
+	// CodeBadValue is a value that can not be converted, i.e. "x" of
+	// an integer field, or a malformed range, regex or coordinates.
+	CodeBadValue ErrorCode = "bad_value"
+	// CodeInvalidValue is a value rejected by Field.Validate or
+	// Field.Transform.
+	CodeInvalidValue ErrorCode = "invalid_value"
+	// CodeUnknownOperator is an unknown operator.
+	CodeUnknownOperator ErrorCode = "unknown_operator"
+	// CodeUnknownDirective is an unknown directive with StrictDirectives.
+	CodeUnknownDirective ErrorCode = "unknown_directive"
+	// CodeUnknownField is a field without a spec in a filter, a sort or
+	// a projection.
+	CodeUnknownField ErrorCode = "unknown_field"
+	// CodeMissingField is a required field without a condition.
+	CodeMissingField ErrorCode = "missing_field"
+	// CodeNotAllowed is an operator that is not allowed on a field,
+	// disabled or too expensive, or a disabled text search.
+	CodeNotAllowed ErrorCode = "not_allowed"
+	// CodeConflictingValues is a condition given with different values.
+	CodeConflictingValues ErrorCode = "conflicting_values"
+	// CodeTooManyValues is a condition, an array or a sort with too many
+	// values.
+	CodeTooManyValues ErrorCode = "too_many_values"
+	// CodeOutOfRange is a directive value above its maximum, i.e.
+	// __limit.
+	CodeOutOfRange ErrorCode = "out_of_range"
+	// CodeTooLarge is a query above the limits of the parser.
+	CodeTooLarge ErrorCode = "too_large"
+	// CodeBadCursor is a malformed or forged cursor.
+	CodeBadCursor ErrorCode = "bad_cursor"
+	// CodeMalformedQuery is a malformed query string, group, page or
+	// projection.
+	CodeMalformedQuery ErrorCode = "malformed_query"
+	// CodeInternal is a problem of the parser configuration, i.e.
+	// a missing converter, or a converter panic.
+	CodeInternal ErrorCode = "internal_error"
+)
+
+// errorCodes maps the sentinel errors to the codes. The wrapping errors
+// precede the wrapped ones, i.e. ErrConflictingValues precedes
+// ErrTooManyValues.
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrInvalidValue, CodeInvalidValue},
+	{ErrConflictingValues, CodeConflictingValues},
+	{ErrUnknownOperator, CodeUnknownOperator},
+	{ErrUnknownDirective, CodeUnknownDirective},
+	{ErrNoFieldSpec, CodeUnknownField},
+	{ErrNoSortField, CodeUnknownField},
+	{ErrNoProjectionField, CodeUnknownField},
+	{ErrMissingField, CodeMissingField},
+	{ErrOperatorNotAllowed, CodeNotAllowed},
+	{ErrOperatorDisabled, CodeNotAllowed},
+	{ErrExpensiveOperator, CodeNotAllowed},
+	{ErrTextSearchDisabled, CodeNotAllowed},
+	{ErrNotGeoPoint, CodeNotAllowed},
+	{ErrTooManyValues, CodeTooManyValues},
+	{ErrTooManyArrayValues, CodeTooManyValues},
+	{ErrTooManySortFields, CodeTooManyValues},
+	{ErrOutOfRange, CodeOutOfRange},
+	{ErrQueryTooLarge, CodeTooLarge},
+	{ErrRegexTooLong, CodeTooLarge},
+	{ErrBadCursor, CodeBadCursor},
+	{ErrMalformedQuery, CodeMalformedQuery},
+	{ErrBadBrackets, CodeMalformedQuery},
+	{ErrBadGroup, CodeMalformedQuery},
+	{ErrBadPage, CodeMalformedQuery},
+	{ErrMixedProjection, CodeMalformedQuery},
+	{ErrFieldConflict, CodeMalformedQuery},
+	{ErrNoConverter, CodeInternal},
+	{ErrConverterPanic, CodeInternal},
+}
+
+// ErrorCodeOf returns the code of an error. The errors of no other
+// category, i.e. ErrNoMatch or the strconv errors, are CodeBadValue.
+func ErrorCodeOf(err error) (code ErrorCode) {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+
+	return CodeBadValue
+}
+
+// Code returns the code of the underlying error, see ErrorCodeOf.
+func (e ParseError) Code() (code ErrorCode) {
+	return ErrorCodeOf(e.Err)
+}
@@ -0,0 +1,101 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest
+func TestErrorCodeOf(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code ErrorCode
+	}{
+		{ErrNoMatch, CodeBadValue},
+		{strconv.ErrRange, CodeBadValue},
+		{ErrBadRange, CodeBadValue},
+		{ErrInvertedRange, CodeBadValue},
+		{fmt.Errorf("%w: %w", ErrInvalidValue, ErrTooManyValues), CodeInvalidValue},
+		{ErrConflictingValues, CodeConflictingValues},
+		{ErrTooManyValues, CodeTooManyValues},
+		{ErrUnknownOperator, CodeUnknownOperator},
+		{ErrUnknownDirective, CodeUnknownDirective},
+		{ErrNoSortField, CodeUnknownField},
+		{ErrMissingField, CodeMissingField},
+		{ErrOperatorDisabled, CodeNotAllowed},
+		{ErrLimitTooLarge, CodeOutOfRange},
+		{&RangeError{Param: "skip"}, CodeOutOfRange},
+		{ErrInvalidCursor, CodeBadCursor},
+		{ErrBadGroup, CodeMalformedQuery},
+		{ErrConverterPanic, CodeInternal},
+		{ParseError{Err: ErrMissingField}, CodeMissingField},
+	} {
+		assert.Equal(t, test.code, ErrorCodeOf(test.err), test.err.Error())
+	}
+
+	assert.Equal(t, CodeUnknownOperator,
+		ParseError{Err: fmt.Errorf("x: %w", ErrUnknownOperator)}.Code())
+}
+
+func TestParserErrorFormatter(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"age":  Field{Converter: Int()},
+			"name": Field{Required: true},
+		},
+	}
+
+	values := url.Values{
+		"age__gte": []string{"old"},
+		"age__foo": []string{"1"},
+		"__limit":  []string{"x"},
+	}
+
+	ts.Run("codes", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(values)
+
+		var parseErrs *ParseErrors
+		if assert.True(t, errors.As(err, &parseErrs)) {
+			codes := make(map[ErrorCode]string)
+			for _, e := range parseErrs.Errors() {
+				codes[e.Code()] = e.Field
+			}
+
+			assert.Equal(t, map[ErrorCode]string{
+				CodeBadValue:        "",
+				CodeUnknownOperator: "age",
+				CodeMissingField:    "name",
+			}, codes)
+		}
+	})
+
+	ts.Run("formatter", func(t *testing.T) {
+		t.Parallel()
+
+		formatted := p
+		formatted.ErrorFormatter = func(e ParseError) string {
+			return fmt.Sprintf("%s:%s", e.Code(), e.Field)
+		}
+
+		_, err := formatted.Parse(url.Values{"name": []string{"x"},
+			"age__foo": []string{"1"}})
+		assert.EqualError(t, err, "unknown_operator:age")
+		assert.True(t, errors.Is(err, ErrUnknownOperator))
+
+		_, err = formatted.Parse(url.Values{})
+		assert.EqualError(t, err, "missing_field:name")
+
+		_, err = formatted.ParseString("name=%zz")
+		assert.EqualError(t, err, "malformed_query:")
+	})
+}
@@ -1,7 +1,7 @@
 package query
 
 import (
-	"regexp"
+	"encoding/hex"
 	"strconv"
 	"strings"
 	"time"
@@ -35,6 +35,24 @@ type Primitives interface {
 	DocElem(key string, val interface{}) (d interface{}, err error)
 }
 
+// DecimalPrimitives is an optional interface of Primitives that converts
+// strings to the BSON Decimal128 values, it is used by the Decimal
+// converter.
+type DecimalPrimitives interface {
+	// Decimal128 converts val to bson.Decimal128.
+	Decimal128(val string) (d interface{}, err error)
+}
+
+// BinaryPrimitives is an optional interface of Primitives that converts
+// bytes to the BSON binary values, it is used by the UUID converter.
+type BinaryPrimitives interface {
+	// Binary converts data to bson.Binary of a given subtype.
+	Binary(subtype byte, data []byte) (bin interface{}, err error)
+}
+
+// uuidSubtype is the BSON binary subtype of UUIDs.
+const uuidSubtype = 4
+
 // String returns a string val.
 func String() (convert ConvertFunc) {
 	return func(val string) (i interface{}, err error) {
@@ -49,6 +67,164 @@ func Int() (convert ConvertFunc) {
 	}
 }
 
+// Int32 tries to convert a val string to an int32 value. Values out of
+// the int32 range are reported with strconv.ErrRange.
+func Int32() (convert ConvertFunc) {
+	return func(val string) (i interface{}, err error) {
+		n, err := strconv.ParseInt(val, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		return int32(n), nil
+	}
+}
+
+// NumericString checks that a val string consists of decimal digits and
+// keeps it a string, i.e. "00420" for a zip code.
+func NumericString() (convert ConvertFunc) {
+	return func(val string) (i interface{}, err error) {
+		if len(val) == 0 || !isDigits(val) {
+			return nil, ErrNoMatch
+		}
+
+		return val, nil
+	}
+}
+
+// Decimal checks if a val string is a decimal number, i.e. "12.50" or
+// "-1.5E+3", and converts it to a Decimal128 value with the primitive.
+// The primitive must implement DecimalPrimitives, otherwise every value is
+// reported with ErrNoConverter.
+func Decimal(primitive Primitives) (convert ConvertFunc) {
+	decimal, ok := primitive.(DecimalPrimitives)
+
+	return func(val string) (i interface{}, err error) {
+		if !ok {
+			return nil, ErrNoConverter
+		}
+
+		if !isDecimal(val) {
+			return nil, ErrNoMatch
+		}
+
+		return decimal.Decimal128(val)
+	}
+}
+
+// isDecimal checks if val is a decimal number with an optional sign,
+// fraction and exponent.
+func isDecimal(val string) (ok bool) {
+	mantissa, exponent, hasExponent := strings.Cut(
+		strings.ToLower(trimSign(val)), "e")
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+
+	if len(intPart)+len(fracPart) == 0 ||
+		!isDigits(intPart) || !isDigits(fracPart) {
+		return false
+	}
+
+	if exponent = trimSign(exponent); hasExponent {
+		return len(exponent) > 0 && isDigits(exponent)
+	}
+
+	return true
+}
+
+// trimSign removes a single leading sign of a number.
+func trimSign(s string) (unsigned string) {
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		return s[1:]
+	}
+
+	return s
+}
+
+// isDigits checks if s consists of decimal digits, an empty s does too.
+func isDigits(s string) (ok bool) {
+	return strings.TrimLeft(s, "0123456789") == ""
+}
+
+// UUID checks if a val string is a UUID either in the canonical form, i.e.
+// "123e4567-e89b-12d3-a456-426614174000", or without hyphens and converts
+// it to a binary value of the UUID subtype with the primitive. The
+// primitive must implement BinaryPrimitives, otherwise every value is
+// reported with ErrNoConverter.
+func UUID(primitive Primitives) (convert ConvertFunc) {
+	binary, ok := primitive.(BinaryPrimitives)
+
+	return func(val string) (i interface{}, err error) {
+		if !ok {
+			return nil, ErrNoConverter
+		}
+
+		data, err := parseUUID(val)
+		if err != nil {
+			return nil, err
+		}
+
+		return binary.Binary(uuidSubtype, data)
+	}
+}
+
+func parseUUID(val string) (data []byte, err error) {
+	const (
+		hexLen       = 32
+		canonicalLen = hexLen + 4
+	)
+
+	if len(val) == canonicalLen {
+		for _, pos := range []int{8, 13, 18, 23} {
+			if val[pos] != '-' {
+				return nil, ErrNoMatch
+			}
+		}
+
+		val = strings.ReplaceAll(val, "-", "")
+	}
+
+	if len(val) != hexLen || !hasHexPrefix(val, hexLen) {
+		return nil, ErrNoMatch
+	}
+
+	return hex.DecodeString(val)
+}
+
+// Enum checks that a val string is one of the allowed values.
+func Enum(allowed ...string) (convert ConvertFunc) {
+	values := make(map[string]struct{}, len(allowed))
+	for _, val := range allowed {
+		values[val] = struct{}{}
+	}
+
+	return func(val string) (i interface{}, err error) {
+		if _, ok := values[val]; !ok {
+			return nil, ErrNoMatch
+		}
+
+		return val, nil
+	}
+}
+
+// EnumIgnoreCase checks that a val string is one of the allowed values
+// ignoring the case and returns the allowed spelling of the value, i.e.
+// "Active" for "ACTIVE".
+func EnumIgnoreCase(allowed ...string) (convert ConvertFunc) {
+	values := make(map[string]string, len(allowed))
+	for _, val := range allowed {
+		values[strings.ToLower(val)] = val
+	}
+
+	return func(val string) (i interface{}, err error) {
+		canonical, ok := values[strings.ToLower(val)]
+		if !ok {
+			return nil, ErrNoMatch
+		}
+
+		return canonical, nil
+	}
+}
+
 // Double tries to convert a val string to a float64 value.
 func Double() (convert ConvertFunc) {
 	return func(val string) (i interface{}, err error) {
@@ -56,17 +232,86 @@ func Double() (convert ConvertFunc) {
 	}
 }
 
-// Bool tries to convert a val string to a boolean value.
+// Bool tries to convert a val string to a boolean value: "true" and "yes"
+// are true, "false" and "no" are false regardless of the case.
 func Bool() (convert ConvertFunc) {
+	return BoolTokens([]string{"true", "yes"}, []string{"false", "no"})
+}
+
+// BoolTokens converts the trueVals to true and the falseVals to false
+// regardless of the case, i.e. BoolTokens([]string{"true", "1"},
+// []string{"false", "0"}). Other values are reported with ErrNoMatch.
+// A token listed in both lists is true.
+func BoolTokens(trueVals, falseVals []string) (convert ConvertFunc) {
+	tokens := make(map[string]bool, len(trueVals)+len(falseVals))
+
+	for _, val := range falseVals {
+		tokens[strings.ToLower(val)] = false
+	}
+
+	for _, val := range trueVals {
+		tokens[strings.ToLower(val)] = true
+	}
+
 	return func(val string) (i interface{}, err error) {
-		switch strings.ToLower(val) {
-		case "true", "yes":
-			return true, nil
-		case "false", "no":
-			return false, nil
+		b, ok := tokens[strings.ToLower(val)]
+		if !ok {
+			return nil, ErrNoMatch
 		}
 
-		return nil, ErrNoMatch
+		return b, nil
+	}
+}
+
+// Null converts the "null" literal to nil, so "deletedAt=null" is
+// {"deletedAt": nil} and "deletedAt__ne=null" is {"deletedAt": {"$ne":
+// nil}}. Other values are reported with ErrNoMatch, thus it is combined
+// with other converters, i.e. NewConverter(Bool(), p, Null(), Int(),
+// String()). Parser.NullLiteral does the same for any converter.
+func Null() (convert ConvertFunc) {
+	return func(val string) (i interface{}, err error) {
+		if val != "null" {
+			return nil, ErrNoMatch
+		}
+
+		return nil, nil
+	}
+}
+
+// arraySize converts a value of the size operator to a non-negative int64.
+func arraySize() (convert ConvertFunc) {
+	return func(val string) (i interface{}, err error) {
+		size, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if size < 0 {
+			return nil, ErrOutOfRange
+		}
+
+		return size, nil
+	}
+}
+
+// bsonTypes lists the BSON type aliases accepted by the type operator.
+var bsonTypes = map[string]struct{}{
+	"double": {}, "string": {}, "object": {}, "array": {}, "binData": {},
+	"undefined": {}, "objectId": {}, "bool": {}, "date": {}, "null": {},
+	"regex": {}, "dbPointer": {}, "javascript": {}, "symbol": {},
+	"javascriptWithScope": {}, "int": {}, "timestamp": {}, "long": {},
+	"decimal": {}, "minKey": {}, "maxKey": {}, "number": {},
+}
+
+// bsonType checks that a value of the type operator is a BSON type alias,
+// i.e. "string" or "objectId".
+func bsonType() (convert ConvertFunc) {
+	return func(val string) (i interface{}, err error) {
+		if _, ok := bsonTypes[val]; !ok {
+			return nil, ErrNoMatch
+		}
+
+		return val, nil
 	}
 }
 
@@ -74,10 +319,9 @@ func Bool() (convert ConvertFunc) {
 // converts it.
 func ObjectID(primitive Primitives) (convert ConvertFunc) {
 	objectIDConvert := primitive.ObjectID
-	rx := regexp.MustCompile("^[0-9a-fA-F]{12}")
 
 	return func(val string) (i interface{}, err error) {
-		if !rx.MatchString(val) {
+		if !hasHexPrefix(val, objectIDPrefixLen) {
 			return nil, ErrNoMatch
 		}
 
@@ -85,29 +329,181 @@ func ObjectID(primitive Primitives) (convert ConvertFunc) {
 	}
 }
 
+const (
+	objectIDPrefixLen = 12
+	objectIDHexLen    = 24
+
+	// dateFmt is a layout of the date-only values.
+	dateFmt = "2006-01-02"
+	// monthFmt is a layout of the month-only values.
+	monthFmt = "2006-01"
+)
+
+// ObjectIDMode defines how TypeConverter infers ObjectID values.
+type ObjectIDMode int
+
+const (
+	// ObjectIDNever disables the ObjectID inference, so ObjectIDs are
+	// only converted for the fields with the ObjectID() converter.
+	ObjectIDNever ObjectIDMode = iota
+	// ObjectIDPrefix converts every value that starts with 12 hex digits,
+	// it is the mode of NewConverter() and NewDefaultConverter().
+	ObjectIDPrefix
+	// ObjectIDExact converts only the values of exactly 24 hex digits.
+	ObjectIDExact
+)
+
+// match checks if a value looks like an ObjectID in the mode.
+func (m ObjectIDMode) match(val string) (ok bool) {
+	switch m {
+	case ObjectIDPrefix:
+		return hasHexPrefix(val, objectIDPrefixLen)
+	case ObjectIDExact:
+		return len(val) == objectIDHexLen &&
+			hasHexPrefix(val, objectIDHexLen)
+	case ObjectIDNever:
+	}
+
+	return false
+}
+
+// hasHexPrefix checks that the first n bytes of val are hex digits.
+func hasHexPrefix(val string, n int) (ok bool) {
+	if len(val) < n {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		c := val[i]
+		if !('0' <= c && c <= '9' ||
+			'a' <= c && c <= 'f' ||
+			'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DateOption enables additional formats of the Date converter.
+type DateOption int
+
+const (
+	// AcceptUnixSeconds makes Date convert integers as seconds since
+	// the Unix epoch.
+	AcceptUnixSeconds DateOption = 1 << iota
+	// AcceptUnixMillis makes Date convert integers as milliseconds since
+	// the Unix epoch. Together with AcceptUnixSeconds the integers with
+	// an absolute value below unixMillisCutoff are seconds and the others
+	// are milliseconds.
+	AcceptUnixMillis
+	// AcceptRelative makes Date convert the relative date expressions,
+	// i.e. "now-7d", at the current time, see RelativeDate.
+	AcceptRelative
+	// AcceptMonth makes Date convert the month-only values, i.e. "2021-03",
+	// to the first day of the month in the location of the values.
+	AcceptMonth
+)
+
+// unixMillisCutoff is the smallest absolute value of a Unix timestamp in
+// milliseconds when both seconds and milliseconds are accepted. It is
+// 1973-03-03 in milliseconds and year 5138 in seconds.
+const unixMillisCutoff = 100_000_000_000
+
+// unixTime converts an integer string to time.Time according to the options.
+func unixTime(val string, opts DateOption) (t time.Time, err error) {
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return t, ErrNoMatch
+	}
+
+	isMillis := opts&AcceptUnixMillis != 0
+	if isMillis && opts&AcceptUnixSeconds != 0 {
+		isMillis = n >= unixMillisCutoff || n <= -unixMillisCutoff
+	}
+
+	if isMillis {
+		return time.UnixMilli(n).UTC(), nil
+	}
+
+	return time.Unix(n, 0).UTC(), nil
+}
+
 // Date checks if a string matches some of the known patterns and tries to
-// convert it to time.Time.
-func Date() (convert ConvertFunc) {
+// convert it to time.Time. The options enable Unix timestamps, i.e.
+// Date(AcceptUnixSeconds) converts "1672531200" to 2023-01-01 and
+// Date(AcceptRelative) converts "now-7d" to the time a week ago.
+func Date(opts ...DateOption) (convert ConvertFunc) {
+	return DateWithOptions(nil, nil, opts...)
+}
+
+// DateWithOptions is a Date converter with custom layouts and a default
+// location of the values without a zone, i.e. DateWithOptions([]string{
+// "2006-01-02 15:04:05"}, berlin) converts "2021-01-02 15:04:05" to
+// the Berlin time. The empty layouts are the layouts of Date, of them only
+// the date-only values are in the location. A nil location is UTC.
+func DateWithOptions(layouts []string, loc *time.Location,
+	opts ...DateOption) (convert ConvertFunc) {
 	const (
-		dateFmt            = "2006-01-02"
 		utcTimeFmt         = "2006-01-02T15:04:05Z"
 		utcTimeWithNsecFmt = "2006-01-02T15:04:05.999Z"
 		timeFmt            = utcTimeFmt + "-0700"
 		timeWithNsecFmt    = utcTimeWithNsecFmt + "-0700"
 	)
 
-	formats := []string{
-		dateFmt, utcTimeFmt, timeFmt,
-		utcTimeWithNsecFmt, timeWithNsecFmt,
+	if loc == nil {
+		loc = time.UTC
 	}
 
+	// the default layouts of the time have either "Z" or an offset
+	var utcLayouts []string
+
+	if len(layouts) == 0 {
+		layouts = []string{dateFmt}
+		utcLayouts = []string{
+			utcTimeFmt, timeFmt, utcTimeWithNsecFmt, timeWithNsecFmt,
+		}
+	}
+
+	var unix DateOption
+	for _, opt := range opts {
+		unix |= opt
+	}
+
+	var relative ConvertFunc
+	if unix&AcceptRelative != 0 {
+		relative = RelativeDate(nil)
+	}
+
+	if unix&AcceptMonth != 0 {
+		layouts = append(layouts[:len(layouts):len(layouts)], monthFmt)
+	}
+
+	unix &^= AcceptRelative | AcceptMonth
+
 	return func(val string) (i interface{}, err error) {
-		for _, layout := range formats {
+		for _, layout := range layouts {
+			if i, err = time.ParseInLocation(layout, val, loc); err == nil {
+				return
+			}
+		}
+
+		for _, layout := range utcLayouts {
 			if i, err = time.Parse(layout, val); err == nil {
 				return
 			}
 		}
 
+		if unix != 0 {
+			if t, err := unixTime(val, unix); err == nil {
+				return t, nil
+			}
+		}
+
+		if relative != nil {
+			return relative(val)
+		}
+
 		return nil, ErrNoMatch
 	}
 }
@@ -120,6 +516,9 @@ type TypeConverter struct {
 	Primitives Primitives
 	// Funcs checks and converts strings to known types.
 	Funcs []ConvertFunc
+	// ObjectIDMode defines which values are converted to ObjectIDs
+	// with Primitives before trying Funcs.
+	ObjectIDMode ObjectIDMode
 }
 
 // static assertion: *TypeConverter must implement Converter interface.
@@ -131,11 +530,11 @@ func NewConverter(boolConvert ConvertFunc, p Primitives,
 	c = &TypeConverter{
 		Bool:       boolConvert,
 		Primitives: p,
-		Funcs:      make([]ConvertFunc, 0, len(convert)+1),
+		Funcs:      make([]ConvertFunc, 0, len(convert)),
 	}
 
 	if p != nil {
-		c.Funcs = append(c.Funcs, ObjectID(p))
+		c.ObjectIDMode = ObjectIDPrefix
 	}
 
 	for _, cx := range convert {
@@ -155,8 +554,16 @@ func NewDefaultConverter(p Primitives) (c *TypeConverter) {
 
 // Convert checks string value for patterns and converts it to matched types.
 func (c TypeConverter) Convert(val string) (i interface{}, err error) {
-	if i, err = c.Bool(val); err == nil {
-		return i, nil
+	if c.Bool != nil {
+		if i, err = c.Bool(val); err == nil {
+			return i, nil
+		}
+	}
+
+	if c.Primitives != nil && c.ObjectIDMode.match(val) {
+		if i, err = c.Primitives.ObjectID(val); err == nil {
+			return i, nil
+		}
 	}
 
 	for _, convert := range c.Funcs {
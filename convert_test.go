@@ -1,6 +1,9 @@
 package query
 
 import (
+	"errors"
+	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
@@ -51,6 +54,29 @@ func (t testOidPrimitive) DocElem(key string, val interface{}) (
 	return map[string]interface{}{key: val}, nil
 }
 
+type testDecimal struct {
+	dec string
+}
+
+type testExtendedPrimitive struct {
+	testOidPrimitive
+}
+
+type testBinary struct {
+	subtype byte
+	data    []byte
+}
+
+func (t testExtendedPrimitive) Binary(subtype byte, data []byte) (
+	bin interface{}, err error) {
+	return testBinary{subtype: subtype, data: data}, nil
+}
+
+func (t testExtendedPrimitive) Decimal128(val string) (
+	d interface{}, err error) {
+	return testDecimal{dec: val}, nil
+}
+
 //nolint:paralleltest
 func TestDefaultConvertFuncs(t *testing.T) {
 	i, err := Int()(testIntStr)
@@ -149,6 +175,10 @@ func TestDefaultConverter(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, -555.888, i)
 
+	i, err = converter.Convert("2021-03")
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-03", i)
+
 	i, err = converter.Convert(testObjectIDStr)
 	assert.NoError(t, err)
 	assert.Equal(t, testObjectID{oid: testObjectIDStr}, i)
@@ -162,3 +192,315 @@ func TestDefaultConverter(t *testing.T) {
 	_, err = converter.Convert("")
 	assert.Error(t, err)
 }
+
+//nolint:paralleltest
+func TestConverterObjectIDMode(t *testing.T) {
+	const (
+		oid   = "0123456789abcdef01234567"
+		promo = "deadbeefcafe-promo"
+	)
+
+	converter := NewDefaultConverter(testOidPrimitive{})
+	assert.Equal(t, ObjectIDPrefix, converter.ObjectIDMode)
+
+	i, err := converter.Convert(promo)
+	assert.NoError(t, err)
+	assert.Equal(t, testObjectID{oid: promo}, i)
+
+	converter.ObjectIDMode = ObjectIDExact
+
+	i, err = converter.Convert(promo)
+	assert.NoError(t, err)
+	assert.Equal(t, promo, i)
+
+	i, err = converter.Convert(oid)
+	assert.NoError(t, err)
+	assert.Equal(t, testObjectID{oid: oid}, i)
+
+	i, err = converter.Convert(oid + "0")
+	assert.NoError(t, err)
+	assert.Equal(t, oid+"0", i)
+
+	converter.ObjectIDMode = ObjectIDNever
+
+	i, err = converter.Convert(oid)
+	assert.NoError(t, err)
+	assert.Equal(t, oid, i)
+
+	// there is no inference without primitives
+	converter = NewDefaultConverter(nil)
+	assert.Equal(t, ObjectIDNever, converter.ObjectIDMode)
+
+	converter.ObjectIDMode = ObjectIDExact
+
+	i, err = converter.Convert(oid)
+	assert.NoError(t, err)
+	assert.Equal(t, oid, i)
+}
+
+//nolint:paralleltest
+func TestBoolTokens(t *testing.T) {
+	convert := BoolTokens([]string{"true", "1", "Oui"}, []string{"false", "0", "non"})
+
+	for val, expected := range map[string]bool{
+		"true": true, "TRUE": true, "1": true, "oui": true, "OUI": true,
+		"false": false, "0": false, "non": false, "Non": false,
+	} {
+		i, err := convert(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, expected, i, val)
+	}
+
+	for _, val := range []string{"yes", "no", "", "2", "truee"} {
+		_, err := convert(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	i, err := BoolTokens([]string{"y"}, []string{"y", "n"})("y")
+	assert.NoError(t, err)
+	assert.Equal(t, true, i)
+
+	_, err = BoolTokens(nil, nil)("true")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+}
+
+//nolint:paralleltest
+func TestDateWithOptions(t *testing.T) {
+	berlin := time.FixedZone("CET", 60*60)
+
+	custom := DateWithOptions(
+		[]string{"2006-01-02 15:04:05", "02.01.2006"}, berlin)
+
+	i, err := custom("2021-01-02 15:04:05")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 2, 15, 4, 5, 0, berlin), i)
+
+	i, err = custom("02.01.2021")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, berlin), i)
+
+	// the custom layouts replace the default ones
+	_, err = custom("2021-01-02")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+
+	defaults := DateWithOptions(nil, berlin)
+
+	i, err = defaults("2021-01-02")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, berlin), i)
+
+	// the month-only values are opt-in
+	_, err = defaults("2021-03")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+
+	i, err = DateWithOptions(nil, berlin, AcceptMonth)("2021-03")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 3, 1, 0, 0, 0, 0, berlin), i)
+
+	// the default layouts of the time keep their zone
+	i, err = defaults(testTimeStr)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, time.December, 8, 12, 50, 37, 0, time.UTC),
+		i)
+
+	i, err = DateWithOptions([]string{"2006-01-02 15:04"}, nil)(
+		"2021-01-02 15:04")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2021, 1, 2, 15, 4, 0, 0, time.UTC), i)
+
+	i, err = DateWithOptions([]string{"2006-01-02"}, nil, AcceptUnixSeconds)(
+		"1672531200")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), i)
+}
+
+//nolint:paralleltest
+func TestDateUnix(t *testing.T) {
+	seconds := Date(AcceptUnixSeconds)
+	millis := Date(AcceptUnixMillis)
+	both := Date(AcceptUnixSeconds, AcceptUnixMillis)
+
+	newYear := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, test := range map[string]struct {
+		convert  ConvertFunc
+		val      string
+		expected time.Time
+	}{
+		"seconds":          {seconds, "1672531200", newYear},
+		"millis":           {millis, "1672531200000", newYear},
+		"both seconds":     {both, "1672531200", newYear},
+		"both millis":      {both, "1672531200000", newYear},
+		"negative seconds": {seconds, "-1", time.Unix(-1, 0).UTC()},
+		"negative millis":  {millis, "-1", time.UnixMilli(-1).UTC()},
+		"below cutoff": {
+			both, "99999999999", time.Unix(99999999999, 0).UTC(),
+		},
+		"cutoff": {
+			both, "100000000000", time.UnixMilli(100000000000).UTC(),
+		},
+		"negative below cutoff": {
+			both, "-99999999999", time.Unix(-99999999999, 0).UTC(),
+		},
+		"negative cutoff": {
+			both, "-100000000000", time.UnixMilli(-100000000000).UTC(),
+		},
+		"date still wins": {
+			both, "2023-01-01", newYear,
+		},
+	} {
+		i, err := test.convert(test.val)
+		assert.NoError(t, err, name)
+		assert.Equal(t, test.expected, i, name)
+	}
+
+	for _, val := range []string{"1672531200.5", "1e9", "", "99999999999999999999"} {
+		_, err := both(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	_, err := Date()("1672531200")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+}
+
+//nolint:paralleltest
+func TestNumericConverters(t *testing.T) {
+	for val, expected := range map[string]interface{}{
+		"42": int32(42), "-2147483648": int32(-2147483648), "007": int32(7),
+	} {
+		i, err := Int32()(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, expected, i, val)
+	}
+
+	for _, val := range []string{"2147483648", "-2147483649"} {
+		_, err := Int32()(val)
+		assert.True(t, errors.Is(err, strconv.ErrRange), val)
+	}
+
+	_, err := Int32()("1.5")
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+
+	for _, val := range []string{"00420", "0", "12345678901234567890"} {
+		i, err := NumericString()(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, val, i)
+	}
+
+	for _, val := range []string{"", "-1", "1.5", "12a", " 1"} {
+		_, err := NumericString()(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	decimal := Decimal(testExtendedPrimitive{})
+
+	for _, val := range []string{
+		"12.50", "-0.1", "+3", ".5", "5.", "1E6145", "-1.5e-3", "00.10",
+	} {
+		i, err := decimal(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, testDecimal{dec: val}, i, val)
+	}
+
+	for _, val := range []string{
+		"", ".", "-", "1e", "1e+", "e5", "1.2.3", "--1", "1e5.5", "NaN",
+		"Inf", "0x10", "1_000",
+	} {
+		_, err := decimal(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	_, err = Decimal(testOidPrimitive{})("1.5")
+	assert.True(t, errors.Is(err, ErrNoConverter))
+
+	_, err = Decimal(nil)("1.5")
+	assert.True(t, errors.Is(err, ErrNoConverter))
+}
+
+//nolint:paralleltest
+func TestUUIDEnum(t *testing.T) {
+	uuid := UUID(testExtendedPrimitive{})
+	data := []byte{
+		0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3,
+		0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00,
+	}
+
+	for _, val := range []string{
+		"123e4567-e89b-12d3-a456-426614174000",
+		"123E4567-E89B-12D3-A456-426614174000",
+		"123e4567e89b12d3a456426614174000",
+	} {
+		i, err := uuid(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, testBinary{subtype: 4, data: data}, i, val)
+	}
+
+	for _, val := range []string{
+		"", "123e4567", "123e4567-e89b-12d3-a456-42661417400",
+		"123e4567-e89b-12d3-a456_426614174000",
+		"123e4567e-89b-12d3-a456-426614174000",
+		"123e4567-e89b-12d3-a456-42661417400g",
+		"{123e4567-e89b-12d3-a456-426614174000}",
+		"123e4567e89b12d3a45642661417400",
+	} {
+		_, err := uuid(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	_, err := UUID(testOidPrimitive{})(string(data))
+	assert.True(t, errors.Is(err, ErrNoConverter))
+
+	status := Enum("active", "blocked")
+
+	i, err := status("active")
+	assert.NoError(t, err)
+	assert.Equal(t, "active", i)
+
+	for _, val := range []string{"Active", "", "deleted"} {
+		_, err = status(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	status = EnumIgnoreCase("Active", "Blocked")
+
+	for val, expected := range map[string]string{
+		"active": "Active", "BLOCKED": "Blocked", "Active": "Active",
+	} {
+		i, err = status(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, expected, i, val)
+	}
+
+	_, err = status("deleted")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+}
+
+//nolint:paralleltest
+func TestNull(t *testing.T) {
+	i, err := Null()("null")
+	assert.NoError(t, err)
+	assert.Nil(t, i)
+
+	for _, val := range []string{"", "NULL", "nil", "0"} {
+		_, err = Null()(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+
+	p := Parser{Converter: NewConverter(Bool(), testOidPrimitive{},
+		Null(), Int(), String())}
+
+	for query, expected := range map[string]M{
+		"a=null":          {"a": nil},
+		"a__ne=null":      {"a": M{"$ne": nil}},
+		"a__not__eq=null": {"a": M{"$ne": nil}},
+		"a__in=1,null":    {"a": M{"$in": []interface{}{int64(1), nil}}},
+		"a=nullable":      {"a": "nullable"},
+	} {
+		values, err := url.ParseQuery(query)
+		assert.NoError(t, err)
+
+		filter, err := p.Parse(values)
+		assert.NoError(t, err, query)
+		assert.Equal(t, expected, filter.Filter, query)
+	}
+}
@@ -0,0 +1,328 @@
+package query
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// cursorDirectives maps the keyset pagination directives to the operators
+// of their conditions for the ascending sort. The operators are swapped
+// for the descending sort.
+var cursorDirectives = [...]struct {
+	param   string
+	op, rev operator
+}{
+	{param: afterParam, op: operatorGreaterThan, rev: operatorLessThan},
+	{param: beforeParam, op: operatorLessThan, rev: operatorGreaterThan},
+}
+
+// cursorToken is the decoded form of an opaque cursor: the database names
+// of the sort fields and the values of the last document of a page.
+type cursorToken struct {
+	Fields []string `json:"f"`
+	Values []string `json:"v"`
+}
+
+// CursorToken returns an opaque token of the __after directive for
+// the last document of a page, or of the __before directive for the first
+// one, for the parsers with CursorTokens. The document is a result of
+// a query, i.e. a bson.M, and holds the values of all the sort fields of
+// the query.
+func CursorToken(q Query, doc interface{}) (token string, err error) {
+	document, _ := canonicalValue(doc).(M)
+	if document == nil {
+		return "", fmt.Errorf("%w: %T is not a document", ErrBadCursor, doc)
+	}
+
+	s := reflect.ValueOf(q.Sort)
+	if s.Kind() != reflect.Slice || s.Len() == 0 {
+		return "", fmt.Errorf("%w: no sort fields", ErrBadCursor)
+	}
+
+	var c cursorToken
+
+	for i := 0; i < s.Len(); i++ {
+		elem, _ := canonicalSort(s.Index(i)).(M)
+		if len(elem) != 1 {
+			return "", fmt.Errorf("%w: sort %v", ErrBadCursor,
+				s.Index(i).Interface())
+		}
+
+		for field, direction := range elem {
+			if _, isDoc := direction.(M); isDoc {
+				return "", fmt.Errorf("%w: sort %s", ErrBadCursor, field)
+			}
+
+			value, ok := cursorValue(document, field)
+			if !ok {
+				return "", fmt.Errorf("%w: no value of %s", ErrBadCursor,
+					field)
+			}
+
+			c.Fields = append(c.Fields, field)
+			c.Values = append(c.Values, value)
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("cursor token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// CursorToken returns a cursor token like the CursorToken function does,
+// but signed with the CursorKey of the parser.
+func (p *Parser) CursorToken(q Query, doc interface{}) (token string,
+	err error) {
+	token, err = CursorToken(q, doc)
+	if err != nil || len(p.CursorKey) == 0 {
+		return token, err
+	}
+
+	return token + signatureDelimiter + p.cursorSignature(token), nil
+}
+
+// signatureDelimiter separates a cursor token from its signature.
+const signatureDelimiter = "."
+
+// cursorSignature returns the HMAC-SHA256 of a cursor token.
+func (p *Parser) cursorSignature(token string) (signature string) {
+	mac := hmac.New(sha256.New, p.CursorKey)
+	mac.Write([]byte(token))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCursor checks the signature of a cursor token and returns the token
+// without it. The tokens are not signed without a CursorKey.
+func (p *Parser) verifyCursor(signed string) (token string, err error) {
+	if len(p.CursorKey) == 0 {
+		return signed, nil
+	}
+
+	token, signature, ok := strings.Cut(signed, signatureDelimiter)
+	if !ok || !hmac.Equal([]byte(signature),
+		[]byte(p.cursorSignature(token))) {
+		return "", ErrInvalidCursor
+	}
+
+	return token, nil
+}
+
+// cursorValue formats the value of a dotted field of a document.
+func cursorValue(doc M, field string) (value string, ok bool) {
+	var val interface{} = doc
+
+	for _, name := range strings.Split(field, ".") {
+		sub, isDoc := val.(M)
+		if !isDoc {
+			return "", false
+		}
+
+		if val, ok = sub[name]; !ok {
+			return "", false
+		}
+	}
+
+	if t, isTime := val.(interface{ Time() time.Time }); isTime {
+		return t.Time().UTC().Format(time.RFC3339Nano), true
+	}
+
+	return encodeValue(val)
+}
+
+// decodeCursorToken decodes a token of CursorToken.
+func decodeCursorToken(token string) (c cursorToken, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+
+	if err == nil && (len(c.Fields) == 0 || len(c.Fields) != len(c.Values)) {
+		err = fmt.Errorf("%d fields with %d values", len(c.Fields),
+			len(c.Values))
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("%w: %w", ErrBadCursor, err)
+	}
+
+	return c, nil
+}
+
+// parseCursor converts the __after and __before directives to conditions
+// on the sort field, i.e. "__sort=-created&__after=2021-01-01" to
+// {"created": {"$lt": 2021-01-01}}. The cursor values are converted with
+// the sort field converter. A cursor needs a single sort field and cannot
+// be combined with __skip. With CursorTokens the tokens are parsed with
+// parseCursorToken instead.
+func (p *Parser) parseCursor(params url.Values, filter *Query,
+	sortFields []string) (errs []error) {
+	for _, cursor := range cursorDirectives {
+		values, hasCursor := params[delimiter+cursor.param]
+		if !hasCursor {
+			continue
+		}
+
+		key := delimiter + cursor.param
+
+		switch {
+		case len(params.Get(delimiter+skipParam)) > 0:
+			errs = append(errs, fmt.Errorf("%w: %s with %s", ErrBadCursor,
+				key, delimiter+skipParam))
+
+			continue
+		case p.CursorTokens:
+			if err := p.parseCursorToken(values, filter, sortFields,
+				cursor.op, cursor.rev); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+
+			continue
+		case len(sortFields) != 1:
+			errs = append(errs, fmt.Errorf("%w: %s needs a single sort "+
+				"field, got %d", ErrBadCursor, key, len(sortFields)))
+
+			continue
+		}
+
+		field, direction := parseSortSpec(sortFields[0])
+
+		field, err := p.flattenField(field)
+		if err == nil && field == scoreSortField {
+			err = fmt.Errorf("%w: %s with %s", ErrBadCursor, key,
+				scoreSortField)
+		}
+
+		op := cursor.op
+		if direction == sortDesc {
+			op = cursor.rev
+		}
+
+		var value interface{}
+		if err == nil {
+			value, err = p.convert(field, op, values)
+		}
+
+		if err == nil {
+			err = addCursorCondition(filter, p.Fields.DBName(field), op,
+				value)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key,
+				asParseError(field, op, values, err)))
+		}
+	}
+
+	return errs
+}
+
+// addCursorCondition merges a cursor condition with the other conditions on
+// the sort field. A condition of the same operator, i.e. "a__lt=3" of
+// "__sort=-a&__after=5&a__lt=3", is kept and the cursor one is added to
+// the $and, so the documents match both of them.
+func addCursorCondition(filter *Query, field string, op operator,
+	value interface{}) (err error) {
+	err = filter.addFilter(field, op, value)
+	if errors.Is(err, ErrConflictingValues) {
+		filter.AddAnd(M{field: M{op.MongoOperator(): value}})
+
+		return nil
+	}
+
+	return err
+}
+
+// parseCursorToken converts a cursor token to the keyset conditions of
+// the sort fields, i.e. {"$or": [{"a": {"$gt": 1}}, {"a": 1, "b": {"$gt":
+// 2}}]} for "__sort=a,b". The token of a single sort field is merged with
+// the other conditions on the field, the others are added to the $and.
+// The op operator is used for the ascending sort fields and rev for
+// the descending ones.
+func (p *Parser) parseCursorToken(values []string, filter *Query,
+	sortFields []string, op, rev operator) (err error) {
+	if len(values) != 1 {
+		return fmt.Errorf("%w: %d cursors", ErrTooManyValues, len(values))
+	}
+
+	raw, err := p.verifyCursor(values[0])
+	if err != nil {
+		return err
+	}
+
+	token, err := decodeCursorToken(raw)
+	if err != nil {
+		return err
+	}
+
+	if len(token.Fields) != len(sortFields) {
+		return fmt.Errorf("%w: %d sort fields, the cursor has %d",
+			ErrBadCursor, len(sortFields), len(token.Fields))
+	}
+
+	or := make([]M, 0, len(sortFields))
+	equal := make(M, len(sortFields))
+
+	for i, sortField := range sortFields {
+		name, direction := parseSortSpec(sortField)
+
+		field, err := p.flattenField(name)
+		if err == nil && field == scoreSortField {
+			err = fmt.Errorf("%w: %s", ErrBadCursor, scoreSortField)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		dbName := p.Fields.DBName(field)
+		if dbName != token.Fields[i] {
+			return fmt.Errorf("%w: sort field %s, the cursor has %s",
+				ErrBadCursor, dbName, token.Fields[i])
+		}
+
+		cmp := op
+		if direction == sortDesc {
+			cmp = rev
+		}
+
+		raw := token.Values[i : i+1]
+
+		value, err := p.convert(field, cmp, raw)
+		if err != nil {
+			return asParseError(field, cmp, raw, err)
+		}
+
+		if len(sortFields) == 1 {
+			return addCursorCondition(filter, dbName, cmp, value)
+		}
+
+		condition := make(M, len(equal)+1)
+		for eqField, eqValue := range equal {
+			condition[eqField] = eqValue
+		}
+
+		condition[dbName] = M{cmp.MongoOperator(): value}
+		or = append(or, condition)
+
+		if equal[dbName], err = p.convert(field, operatorEquals,
+			raw); err != nil {
+			return asParseError(field, operatorEquals, raw, err)
+		}
+	}
+
+	filter.AddAnd(M{mongoOpPrefix + orParam: or})
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OperatorSpec describes a custom operator registered with
+// Parser.RegisterOperator.
+type OperatorSpec struct {
+	// MultiValue makes the operator take several values, otherwise more
+	// than one value is reported with ErrTooManyValues.
+	MultiValue bool
+	// SplitString splits a single value by commas, i.e. "10,20".
+	SplitString bool
+	// MongoOperator is a mongo operator of the condition, i.e. "$geoWithin".
+	// When it is empty Build must return a document of conditions, i.e.
+	// M{"$gte": 10, "$lte": 20}, that is merged into the field document.
+	MongoOperator string
+	// Build builds the value of the condition from the converted values.
+	// Without Build the value is the converted value itself or an array of
+	// the converted values for a MultiValue operator.
+	Build func(field string, values []interface{}) (interface{}, error)
+}
+
+// fragment is a document of conditions built by a custom operator, its
+// mongo operators are merged into the field document.
+type fragment M
+
+// RegisterOperator registers a custom operator, i.e. "exclusive", that is
+// used as a suffix of a query key like the built-in ones. A name must
+// consist of lower case ASCII letters and digits and must not collide with
+// a built-in or an already registered operator. Operators must be
+// registered before the first call to Parse.
+func (p *Parser) RegisterOperator(name string, spec OperatorSpec) (
+	err error) {
+	op := operator(name)
+
+	switch {
+	case !isOperatorName(name):
+		return fmt.Errorf("register operator: %w: %q", ErrBadOperatorName,
+			name)
+	case op.isListed() || op.IsNegated() ||
+		op == operatorElemMatch || op == operatorNot:
+		return fmt.Errorf("register operator: %w: built-in %q",
+			ErrOperatorExists, name)
+	case spec.MongoOperator == "" && spec.Build == nil:
+		return fmt.Errorf("register operator: %w: %q needs MongoOperator "+
+			"or Build", ErrBadOperatorName, name)
+	}
+
+	if _, exists := p.operators[op]; exists {
+		return fmt.Errorf("register operator: %w: %q", ErrOperatorExists,
+			name)
+	}
+
+	if p.operators == nil {
+		p.operators = make(map[operator]OperatorSpec, 1)
+	}
+
+	p.operators[op] = spec
+
+	return nil
+}
+
+func isOperatorName(name string) (ok bool) {
+	if len(name) == 0 || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+
+	for i := 1; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cutCustom moves the values of the custom operators out of fields, so
+// they are not normalized as the built-in ones.
+func (p *Parser) cutCustom(fields fieldsMap) (custom fieldsMap) {
+	if len(p.operators) == 0 {
+		return nil
+	}
+
+	for field, ops := range fields {
+		for op, values := range ops {
+			if _, isCustom := p.operators[op]; !isCustom {
+				continue
+			}
+
+			if custom == nil {
+				custom = make(fieldsMap)
+			}
+
+			if custom[field] == nil {
+				custom[field] = make(operatorsMap, 1)
+			}
+
+			custom[field][op] = values
+
+			delete(ops, op)
+		}
+	}
+
+	return custom
+}
+
+// addCustom splits the values of the custom operators and adds them to
+// the normalized fields.
+func (p *Parser) addCustom(fields, custom fieldsMap, b *budget) (err error) {
+	for field, ops := range custom {
+		for op, values := range ops {
+			n := len(values)
+
+			split := len(values) == 1 && p.operators[op].SplitString
+			if split {
+				n = countSplit(values[0], b.valuesLeft())
+			}
+
+			if err = b.spend(n, 0); err != nil {
+				return err
+			}
+
+			if split {
+				values = strings.Split(values[0], arrayDelimiter)
+			}
+
+			if fields[field] == nil {
+				fields[field] = make(operatorsMap, 1)
+			}
+
+			fields[field][op] = values
+		}
+	}
+
+	return nil
+}
+
+// convertCustom converts the values of a custom operator and builds
+// the conditions.
+func convertCustom(field string, spec OperatorSpec, v []string,
+	c Converter) (value interface{}, err error) {
+	if isNilConverter(c) {
+		return nil, ErrNoConverter
+	}
+
+	values, err := mapValues(v, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !spec.MultiValue && len(values) > 1 {
+		return nil, ErrTooManyValues
+	}
+
+	if spec.Build != nil {
+		value, err = spec.Build(field, values)
+		if err != nil {
+			return nil, err
+		}
+	} else if spec.MultiValue {
+		value = values
+	} else if len(values) > 0 {
+		value = values[0]
+	}
+
+	if len(spec.MongoOperator) > 0 {
+		return fragment{spec.MongoOperator: value}, nil
+	}
+
+	if m, isDoc := value.(M); isDoc {
+		return fragment(m), nil
+	}
+
+	return fragment{operatorEquals.MongoOperator(): value}, nil
+}
+
+// addFragment merges the conditions of a fragment into the field document.
+func addFragment(filter M, field string, frag fragment) (m M) {
+	if m = filter; m == nil {
+		m = make(M, 1)
+	}
+
+	f, exists := m[field]
+
+	mm, isMap := f.(M)
+	if !isMap {
+		mm = make(M, len(frag)+1)
+
+		if exists {
+			mm[operatorEquals.MongoOperator()] = f
+		}
+
+		m[field] = mm
+	}
+
+	for mongoOp, val := range frag {
+		mm[mongoOp] = val
+	}
+
+	return m
+}
+
+// sortedConditions returns the mongo operators of a fragment in a stable
+// order.
+func (frag fragment) sortedConditions() (ops []string) {
+	ops = make([]string, 0, len(frag))
+	for op := range frag {
+		ops = append(ops, op)
+	}
+
+	sort.Strings(ops)
+
+	return ops
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errBadExclusive = errors.New("exclusive needs two values")
+
+func exclusive(_ string, values []interface{}) (cond interface{}, err error) {
+	if len(values) != 2 {
+		return nil, errBadExclusive
+	}
+
+	return M{"$gt": values[0], "$lt": values[1]}, nil
+}
+
+//nolint:paralleltest
+func TestParserRegisterOperator(t *testing.T) {
+	var p Parser
+
+	assert.NoError(t, p.RegisterOperator("exclusive", OperatorSpec{
+		MultiValue: true, SplitString: true, Build: exclusive,
+	}))
+	assert.True(t, errors.Is(p.RegisterOperator("exclusive", OperatorSpec{
+		MongoOperator: "$x",
+	}), ErrOperatorExists))
+
+	for _, name := range []string{
+		"gte", "in", "ire", "nco", "elem", "not", "between",
+	} {
+		err := p.RegisterOperator(name, OperatorSpec{MongoOperator: "$x"})
+		assert.True(t, errors.Is(err, ErrOperatorExists), name)
+	}
+
+	for _, name := range []string{"", "Fuzzy", "1st", "a-b", "a__b", "x[]"} {
+		err := p.RegisterOperator(name, OperatorSpec{MongoOperator: "$x"})
+		assert.True(t, errors.Is(err, ErrBadOperatorName), name)
+	}
+
+	assert.True(t, errors.Is(p.RegisterOperator("fuzzy", OperatorSpec{}),
+		ErrBadOperatorName))
+}
+
+func TestParserParseCustomOperator(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"price": Field{Converter: Int(), DBName: "cost"},
+		},
+	}
+
+	assert.NoError(ts, p.RegisterOperator("exclusive", OperatorSpec{
+		MultiValue: true, SplitString: true, Build: exclusive,
+	}))
+	assert.NoError(ts, p.RegisterOperator("circle", OperatorSpec{
+		MultiValue: true, SplitString: true, MongoOperator: "$geoWithin",
+		Build: func(_ string, values []interface{}) (interface{}, error) {
+			return M{"$centerSphere": values}, nil
+		},
+	}))
+	assert.NoError(ts, p.RegisterOperator("fuzzy", OperatorSpec{
+		MongoOperator: "$text",
+	}))
+
+	ts.Run("conditions", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"price__exclusive": []string{"10,20"},
+			"price__ne":        []string{"15"},
+			"loc__circle":      []string{"1.5,2.5,0.1"},
+			"name__FUZZY":      []string{"jon"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"cost": M{
+				"$gt": int64(10),
+				"$lt": int64(20),
+				"$ne": int64(15),
+			},
+			"loc": M{"$geoWithin": M{
+				"$centerSphere": []interface{}{1.5, 2.5, 0.1},
+			}},
+			"name": M{"$text": "jon"},
+		}, q.Filter)
+	})
+
+	ts.Run("merge with equality", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"name":        []string{"jon"},
+			"name__fuzzy": []string{"jon"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": M{"$eq": "jon", "$text": "jon"}}, q.Filter)
+
+		_, err = p.Parse(url.Values{
+			"price__exclusive": []string{"10,20"},
+			"price__gt":        []string{"5"},
+		})
+		assert.True(t, errors.Is(err, ErrConflictingValues))
+	})
+
+	ts.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"price__exclusive=10":         errBadExclusive,
+			"price__exclusive=10,x":       strconv.ErrSyntax,
+			"name__fuzzy=a&name__fuzzy=b": ErrTooManyValues,
+			"name__fuzzzy=a":              ErrUnknownOperator,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected),
+				fmt.Sprintf("%s: %v", query, err))
+		}
+
+		var other Parser
+
+		_, err := (&Parser{Converter: other.Converter}).Parse(url.Values{
+			"price__exclusive": []string{"1,2"},
+		})
+		assert.True(t, errors.Is(err, ErrUnknownOperator))
+	})
+}
@@ -0,0 +1,98 @@
+package query
+
+import "time"
+
+// dateOnly returns the period of a raw date-only value, i.e. "2021-01-01",
+// or of a raw month-only value, i.e. "2021-01", when the value is converted
+// to the start of that period in the location of the value. The period
+// lasts until the next midnight or the first day of the next month.
+func dateOnly(raw string, value interface{}) (start, next time.Time,
+	ok bool) {
+	t, isTime := value.(time.Time)
+	if !isTime {
+		return start, next, false
+	}
+
+	var err error
+
+	switch len(raw) {
+	case len(dateFmt):
+		start, err = time.ParseInLocation(dateFmt, raw, t.Location())
+		next = start.AddDate(0, 0, 1)
+	case len(monthFmt):
+		start, err = time.ParseInLocation(monthFmt, raw, t.Location())
+		next = start.AddDate(0, 1, 0)
+	default:
+		return start, next, false
+	}
+
+	return start, next, err == nil && start.Equal(t)
+}
+
+// isDayValue reports whether a raw value is a date-only or a month-only one,
+// i.e. "2021-01-01" or "2021-01".
+func isDayValue(raw string) (ok bool) {
+	for _, layout := range [...]string{dateFmt, monthFmt} {
+		if _, err := time.Parse(layout, raw); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dayCondition widens a condition on a date-only or a month-only value to
+// the whole day or month:
+//   - "eq" becomes a "gte" the start and "lt" the next period range;
+//   - "ne" becomes a negation of that range;
+//   - "lte" becomes "lt" and "gt" becomes "gte" the next period.
+//
+// The bounds of a range are widened one by one, other conditions are
+// returned as is.
+func dayCondition(op operator, raw []string, value interface{}) (
+	dayOp operator, dayValue interface{}) {
+	if r, isRange := value.(valueRange); isRange {
+		widened := make(valueRange, len(r))
+
+		for i, b := range r {
+			// the "gte" bound is the first raw value, the "lte" is the last
+			rawBound := raw[len(raw)-1]
+			if b.op == operatorGreaterThanOrEquals {
+				rawBound = raw[0]
+			}
+
+			b.op, b.value = dayCondition(b.op, []string{rawBound}, b.value)
+			widened[i] = b
+		}
+
+		return op, widened
+	}
+
+	if len(raw) == 0 {
+		return op, value
+	}
+
+	start, next, ok := dateOnly(raw[0], value)
+	if !ok {
+		return op, value
+	}
+
+	switch op {
+	case operatorEquals:
+		return operatorRange, valueRange{
+			{op: operatorGreaterThanOrEquals, value: start},
+			{op: operatorLessThan, value: next},
+		}
+	case operatorNotEquals:
+		return operatorNot, M{
+			operatorGreaterThanOrEquals.MongoOperator(): start,
+			operatorLessThan.MongoOperator():            next,
+		}
+	case operatorLessThanOrEquals:
+		return operatorLessThan, next
+	case operatorGreaterThan:
+		return operatorGreaterThanOrEquals, next
+	}
+
+	return op, value
+}
@@ -0,0 +1,215 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest
+func TestDateOnly(t *testing.T) {
+	day := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	start, next, ok := dateOnly("2021-01-01", day)
+	assert.True(t, ok)
+	assert.Equal(t, day, start)
+	assert.Equal(t, day.AddDate(0, 0, 1), next)
+
+	start, next, ok = dateOnly("2021-01", day)
+	assert.True(t, ok)
+	assert.Equal(t, day, start)
+	assert.Equal(t, day.AddDate(0, 1, 0), next)
+
+	_, _, ok = dateOnly("2021-01-01T00:00:00Z", day)
+	assert.False(t, ok)
+
+	_, _, ok = dateOnly("2021-01-01", "2021-01-01")
+	assert.False(t, ok)
+
+	_, _, ok = dateOnly("2021-01-01", day.Add(time.Hour))
+	assert.False(t, ok)
+
+	_, _, ok = dateOnly("2021", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.False(t, ok)
+
+	berlin := time.FixedZone("CET", 60*60)
+	local := time.Date(2021, 1, 1, 0, 0, 0, 0, berlin)
+
+	start, _, ok = dateOnly("2021-01-01", local)
+	assert.True(t, ok)
+	assert.True(t, local.Equal(start))
+	assert.Equal(t, berlin, start.Location())
+}
+
+//nolint:paralleltest
+func TestParserParseDateRangeAwareLocation(t *testing.T) {
+	berlin := time.FixedZone("CET", 60*60)
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"created": Field{Converter: DateWithOptions(nil, berlin)},
+		},
+		DateRangeAware: true,
+	}
+
+	day := time.Date(2021, 1, 1, 0, 0, 0, 0, berlin)
+
+	q, err := p.Parse(url.Values{"created": []string{"2021-01-01"}})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		M{"created": M{"$gte": day, "$lt": day.AddDate(0, 0, 1)}},
+		q.Filter)
+}
+
+func TestParserParseDateRangeAware(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"created": Field{Converter: Date(AcceptMonth)},
+		},
+		DateRangeAware: true,
+	}
+
+	day := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := day.AddDate(0, 0, 1)
+
+	for name, test := range map[string]struct {
+		query    url.Values
+		expected M
+	}{
+		"eq": {
+			query:    url.Values{"created": []string{"2021-01-01"}},
+			expected: M{"created": M{"$gte": day, "$lt": next}},
+		},
+		"ne": {
+			query: url.Values{"created__ne": []string{"2021-01-01"}},
+			expected: M{"created": M{"$not": M{
+				"$gte": day, "$lt": next,
+			}}},
+		},
+		"gte": {
+			query:    url.Values{"created__gte": []string{"2021-01-01"}},
+			expected: M{"created": M{"$gte": day}},
+		},
+		"gt": {
+			query:    url.Values{"created__gt": []string{"2021-01-01"}},
+			expected: M{"created": M{"$gte": next}},
+		},
+		"lte": {
+			query:    url.Values{"created__lte": []string{"2021-01-01"}},
+			expected: M{"created": M{"$lt": next}},
+		},
+		"lt": {
+			query:    url.Values{"created__lt": []string{"2021-01-01"}},
+			expected: M{"created": M{"$lt": day}},
+		},
+		"range": {
+			query: url.Values{
+				"created__range": []string{"2020-12-31,2021-01-01"},
+			},
+			expected: M{"created": M{
+				"$gte": day.AddDate(0, 0, -1),
+				"$lt":  next,
+			}},
+		},
+		"time precision": {
+			query: url.Values{
+				"created__gte": []string{"2020-12-31T10:00:00Z"},
+				"created__lte": []string{"2021-01-01"},
+			},
+			expected: M{"created": M{
+				"$gte": day.Add(-14 * time.Hour),
+				"$lt":  next,
+			}},
+		},
+		"time precision eq": {
+			query:    url.Values{"created": []string{"2021-01-01T00:00:00Z"}},
+			expected: M{"created": day},
+		},
+		"month eq": {
+			query: url.Values{"created": []string{"2021-01"}},
+			expected: M{"created": M{
+				"$gte": day, "$lt": day.AddDate(0, 1, 0),
+			}},
+		},
+		"month lte": {
+			query:    url.Values{"created__lte": []string{"2021-01"}},
+			expected: M{"created": M{"$lt": day.AddDate(0, 1, 0)}},
+		},
+		"month between": {
+			query: url.Values{
+				"created__between": []string{"2020-12,2021-01"},
+			},
+			expected: M{"created": M{
+				"$gte": day.AddDate(0, -1, 0),
+				"$lt":  day.AddDate(0, 1, 0),
+			}},
+		},
+		"in": {
+			query:    url.Values{"created__in": []string{"2021-01-01,2021-01-02"}},
+			expected: M{"created": M{"$in": []interface{}{day, next}}},
+		},
+		"in single value": {
+			query:    url.Values{"created__in": []string{"2021-01-01"}},
+			expected: M{"created": M{"$in": []interface{}{day}}},
+		},
+		"in single month": {
+			query:    url.Values{"created__in": []string{"2021-01"}},
+			expected: M{"created": M{"$in": []interface{}{day}}},
+		},
+		"in array single value": {
+			query:    url.Values{"created[]": []string{"2021-01-01"}},
+			expected: M{"created": M{"$in": []interface{}{day}}},
+		},
+		"nin": {
+			query:    url.Values{"created__nin": []string{"2021-01-01,2021-01-02"}},
+			expected: M{"created": M{"$nin": []interface{}{day, next}}},
+		},
+		"nin single value": {
+			query:    url.Values{"created__nin": []string{"2021-01-01"}},
+			expected: M{"created": M{"$nin": []interface{}{day}}},
+		},
+		"not in single value": {
+			query:    url.Values{"created__not__in": []string{"2021-01-01"}},
+			expected: M{"created": M{"$nin": []interface{}{day}}},
+		},
+		"in single time": {
+			query:    url.Values{"created__in": []string{"2021-01-01T00:00:00Z"}},
+			expected: M{"created": day},
+		},
+		"in single non-date value": {
+			query:    url.Values{"name__in": []string{"x"}},
+			expected: M{"name": "x"},
+		},
+	} {
+		test := test
+
+		ts.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			q, err := p.Parse(test.query)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, q.Filter)
+		})
+	}
+
+	ts.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.DateRangeAware = false
+
+		q, err := p.Parse(url.Values{"created__lte": []string{"2021-01-01"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"created": M{"$lte": day}}, q.Filter)
+
+		q, err = p.Parse(url.Values{"created__in": []string{"2021-01-01"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"created": day}, q.Filter)
+	})
+}
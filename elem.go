@@ -0,0 +1,119 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// elemMatchKey splits a key of the elem operator, i.e.
+// "items__elem[price__gt]", to an array field and a key of a condition on
+// the array elements, i.e. "items" and "price__gt". The operator is case
+// insensitive and the condition key may be continued after the brackets,
+// so "items__elem[price]__gt" is the same condition.
+func elemMatchKey(key string) (field, inner string, isElem bool, err error) {
+	if strings.IndexByte(key, '[') < 0 {
+		return "", "", false, nil
+	}
+
+	name := string(operatorElemMatch)
+
+	for pos := strings.Index(key, delimiter); pos > 0; {
+		rest := key[pos+len(delimiter):]
+
+		if len(rest) > len(name) && rest[len(name)] == '[' &&
+			strings.EqualFold(rest[:len(name)], name) {
+			segment, tail, ok := cutBrackets(rest[len(name):])
+			if !ok || len(segment) == 0 {
+				return "", "", true, fmt.Errorf("%w: %q", ErrBadBrackets, key)
+			}
+
+			return key[:pos], segment + tail, true, nil
+		}
+
+		next := strings.Index(rest, delimiter)
+		if next < 0 {
+			break
+		}
+
+		pos += len(delimiter) + next
+	}
+
+	return "", "", false, nil
+}
+
+// parseElemMatches converts the conditions of the elem operator to
+// the $elemMatch documents of the array fields. The conditions go through
+// the same pipeline as the top level ones with the field specs of
+// the array elements, i.e. "items.price" for "items__elem[price__gt]".
+// The result is not complete when the query exceeds the budget.
+func (p *Parser) parseElemMatches(query url.Values, b *budget) (
+	elems map[string]M, errs []error, complete bool) {
+	byField := make(map[string]url.Values)
+
+	for _, key := range sortedKeys(query) {
+		field, inner, isElem, err := elemMatchKey(key)
+		if !isElem {
+			continue
+		}
+
+		if err == nil {
+			field, err = p.flattenField(field)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("filter: %w", err))
+
+			continue
+		}
+
+		conditions, ok := byField[field]
+		if !ok {
+			conditions = make(url.Values)
+			byField[field] = conditions
+		}
+
+		innerKey := field + "." + inner
+		conditions[innerKey] = append(conditions[innerKey], query[key]...)
+	}
+
+	fields := make([]string, 0, len(byField))
+	for field := range byField {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		filter, elemErrs, complete := p.parseConditions(byField[field], b)
+		for _, err := range elemErrs {
+			errs = append(errs, fmt.Errorf("%s%s%s: %w",
+				field, delimiter, operatorElemMatch, err))
+		}
+
+		if !complete {
+			return nil, errs, false
+		}
+
+		if filter.Filter == nil {
+			continue
+		}
+
+		if elems == nil {
+			elems = make(map[string]M, len(byField))
+		}
+
+		// the conditions are relative to the array elements
+		prefix := p.Fields.DBName(field) + "."
+		match := make(M, len(filter.Filter))
+
+		for name, condition := range filter.Filter {
+			match[strings.TrimPrefix(name, prefix)] = condition
+		}
+
+		elems[field] = match
+	}
+
+	return elems, errs, true
+}
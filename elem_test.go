@@ -0,0 +1,141 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest
+func TestElemMatchKey(t *testing.T) {
+	valid := map[string]struct {
+		field, inner string
+	}{
+		"items__elem[price__gt]":     {"items", "price__gt"},
+		"items__ELEM[price]__gt":     {"items", "price__gt"},
+		"items__elem[qty]":           {"items", "qty"},
+		"order[items]__elem[qty]":    {"order[items]", "qty"},
+		"legacy__code__elem[a__lte]": {"legacy__code", "a__lte"},
+		"items__elem[dims.w__gte]":   {"items", "dims.w__gte"},
+	}
+
+	for key, expected := range valid {
+		field, inner, isElem, err := elemMatchKey(key)
+		assert.NoError(t, err, key)
+		assert.True(t, isElem, key)
+		assert.Equal(t, expected.field, field, key)
+		assert.Equal(t, expected.inner, inner, key)
+	}
+
+	for _, key := range []string{
+		"items", "items__elem", "items[elem]", "__elem[a]", "items__element[a]",
+		"items__gte", "items[a]__in",
+	} {
+		_, _, isElem, err := elemMatchKey(key)
+		assert.NoError(t, err, key)
+		assert.False(t, isElem, key)
+	}
+
+	for _, key := range []string{"items__elem[]", "items__elem[price"} {
+		_, _, isElem, err := elemMatchKey(key)
+		assert.True(t, isElem, key)
+		assert.True(t, errors.Is(err, ErrBadBrackets), key)
+	}
+}
+
+func TestParserParseElemMatch(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"items":       Field{DBName: "lines"},
+			"items.price": Field{Converter: Double()},
+			"items.qty":   Field{Converter: Int()},
+			"items.sku":   Field{Converter: String()},
+		},
+		ValidateFields: true,
+	}
+
+	ts.Run("conditions", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"items__elem[price__gt]": []string{"10"},
+			"items__elem[price__lt]": []string{"20"},
+			"items__elem[qty__gte]":  []string{"2"},
+			"items__elem[sku]":       []string{"007"},
+			"items__exists":          []string{"true"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"lines": M{
+			"$exists": true,
+			"$elemMatch": M{
+				"price": M{"$gt": 10.0, "$lt": 20.0},
+				"qty":   M{"$gte": int64(2)},
+				"sku":   "007",
+			},
+		}}, q.Filter)
+	})
+
+	ts.Run("without fields specifications", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+		q, err := p.Parse(url.Values{
+			"items__elem[price__gt]": []string{"10"},
+			"items__elem[qty]":       []string{"2"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"items": M{"$elemMatch": M{
+			"price": M{"$gt": int64(10)},
+			"qty":   int64(2),
+		}}}, q.Filter)
+	})
+
+	ts.Run("in groups", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"__or[0][items__elem[qty]]": []string{"1"},
+			"__or[1][items__exists]":    []string{"false"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"$or": []M{
+			{"lines": M{"$elemMatch": M{"qty": int64(1)}}},
+			{"lines": M{"$exists": false}},
+		}}, q.Filter)
+	})
+
+	ts.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"items__elem[qty__gte]": []string{"many"},
+			"items__elem[color]":    []string{"red"},
+			"items__elem[]":         []string{"x"},
+		})
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+		assert.True(t, errors.Is(err, ErrNoFieldSpec))
+		assert.True(t, errors.Is(err, ErrBadBrackets))
+		assert.Contains(t, err.Error(), "items__elem")
+
+		var parseErrs *ParseErrors
+		if assert.True(t, errors.As(err, &parseErrs)) {
+			fields := make([]string, 0, len(parseErrs.Errors()))
+			for _, parseErr := range parseErrs.Errors() {
+				fields = append(fields, parseErr.Field)
+			}
+
+			assert.ElementsMatch(t, []string{"", "items.color", "items.qty"},
+				fields)
+		}
+
+		_, err = p.Parse(url.Values{"items__elem": []string{"x"}})
+		assert.True(t, errors.Is(err, ErrUnknownOperator))
+	})
+}
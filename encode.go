@@ -0,0 +1,629 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// encodedOperators maps the mongo operators of the single value conditions
+// back to the query operators.
+var encodedOperators = func() (ops map[string]operator) {
+	ops = make(map[string]operator)
+
+	for _, op := range []operator{
+		operatorEquals, operatorNotEquals, operatorGreaterThan,
+		operatorGreaterThanOrEquals, operatorLessThan,
+		operatorLessThanOrEquals, operatorExists, operatorSize,
+		operatorType, operatorMod, operatorBitsAllClear, operatorBitsAllSet,
+		operatorBitsAnyClear, operatorBitsAnySet,
+	} {
+		ops[op.MongoOperator()] = op
+	}
+
+	return ops
+}()
+
+// param is an operator of a condition with its query values.
+type param struct {
+	op     operator
+	values []string
+}
+
+// addFunc adds the values of a query key.
+type addFunc func(key string, values ...string)
+
+// Encode converts a query back to the query parameters, i.e. to build
+// the pagination links. The filter is encoded with the operators and
+// the groups of the parser, the sort, the limit, the skip and
+// the projection with the directives. The field names are the database
+// ones and the values are formatted as strings, so a parsed query is
+// reproduced by a parser with the same converters and without the DBName
+// aliases. The conditions without a query form, i.e. nested groups or
+// the custom operators, are reported with ErrNotEncodable.
+func (f Query) Encode() (values url.Values, err error) {
+	values = make(url.Values)
+
+	add := func(key string, vals ...string) {
+		values[key] = append(values[key], vals...)
+	}
+
+	if filter, _ := canonicalValue(f.Filter).(M); filter != nil {
+		if err = encodeFilter(add, filter, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = f.encodeSort(add); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case f.Page > 0 && f.Limit > 0 && f.Skip == (f.Page-1)*f.Limit:
+		add(delimiter+pageParam, strconv.FormatInt(f.Page, 10))
+		add(delimiter+perPageParam, strconv.FormatInt(f.Limit, 10))
+	default:
+		if f.Limit != 0 {
+			add(delimiter+limitParam, strconv.FormatInt(f.Limit, 10))
+		}
+
+		if f.Skip != 0 {
+			add(delimiter+skipParam, strconv.FormatInt(f.Skip, 10))
+		}
+	}
+
+	if f.CountOnly {
+		add(delimiter+countParam, strconv.FormatBool(f.CountOnly))
+	}
+
+	if len(f.Projection) > 0 {
+		fields := make([]string, 0, len(f.Projection))
+		for field, include := range f.Projection {
+			if include == 0 {
+				field = sortDescPrefix + field
+			}
+
+			fields = append(fields, field)
+		}
+
+		sort.Strings(fields)
+		add(delimiter+projectionParam, strings.Join(fields, arrayDelimiter))
+	}
+
+	return values, nil
+}
+
+// encodeSort adds the __sort directive. The text score is encoded as
+// the __score sort field.
+func (f Query) encodeSort(add addFunc) (err error) {
+	s := reflect.ValueOf(f.Sort)
+	if s.Kind() != reflect.Slice || s.Len() == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, s.Len())
+
+	for i := 0; i < s.Len(); i++ {
+		elem, _ := canonicalSort(s.Index(i)).(M)
+		if len(elem) != 1 {
+			return fmt.Errorf("encode: %w: sort %v", ErrNotEncodable,
+				s.Index(i).Interface())
+		}
+
+		for field, direction := range elem {
+			if strings.Contains(field, arrayDelimiter) {
+				return fmt.Errorf("encode: %w: sort %s", ErrNotEncodable,
+					field)
+			}
+
+			if meta, isDoc := direction.(M); isDoc {
+				if field != textScoreField || meta["$meta"] != "textScore" {
+					return fmt.Errorf("encode: %w: sort %s",
+						ErrNotEncodable, field)
+				}
+
+				field = scoreSortField
+			} else if isNegative(direction) {
+				field = sortDescPrefix + field
+			}
+
+			fields = append(fields, field)
+		}
+	}
+
+	add(delimiter+sortParam, strings.Join(fields, arrayDelimiter))
+
+	return nil
+}
+
+// isNegative checks if a sort direction is a negative number.
+func isNegative(direction interface{}) (ok bool) {
+	v := reflect.ValueOf(direction)
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return v.Int() < 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() < 0
+	}
+
+	return false
+}
+
+// encodeFilter adds the conditions of a filter. The groups and the text
+// search are only encoded at the top level.
+func encodeFilter(add addFunc, filter M, top bool) (err error) {
+	for _, field := range sortedFields(filter) {
+		value := filter[field]
+
+		switch {
+		case top && (field == andOperator || field == mongoOpPrefix+orParam):
+			err = encodeGroups(add, field[len(mongoOpPrefix):], value)
+		case top && field == textOperator:
+			err = encodeText(add, value)
+		case strings.HasPrefix(field, mongoOpPrefix):
+			err = fmt.Errorf("encode: %w: %s", ErrNotEncodable, field)
+		default:
+			err = encodeField(add, field, value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeGroups adds the conditions of the $or or the $and groups with
+// the group directive, i.e. "__or[0][status]".
+func encodeGroups(add addFunc, name string, value interface{}) (err error) {
+	groups, isArray := value.([]interface{})
+	if !isArray {
+		return fmt.Errorf("encode: %w: %s", ErrNotEncodable, name)
+	}
+
+	for i, group := range groups {
+		filter, isDoc := group.(M)
+		if !isDoc {
+			return fmt.Errorf("encode: %w: %s[%d]", ErrNotEncodable, name, i)
+		}
+
+		prefix := fmt.Sprintf("%s%s[%d]", delimiter, name, i)
+
+		err = encodeFilter(func(key string, vals ...string) {
+			add(prefix+"["+key+"]", vals...)
+		}, filter, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeText adds the text search directives of a $text document.
+func encodeText(add addFunc, value interface{}) (err error) {
+	text, isDoc := value.(M)
+	if !isDoc {
+		return fmt.Errorf("encode: %w: %s", ErrNotEncodable, textOperator)
+	}
+
+	directives := map[string]string{
+		"$search":             searchParam,
+		"$language":           searchLangParam,
+		"$caseSensitive":      searchCaseParam,
+		"$diacriticSensitive": diacriticParam,
+	}
+
+	for _, key := range sortedFields(text) {
+		name, known := directives[key]
+		str, ok := encodeValue(text[key])
+
+		if !known || !ok {
+			return fmt.Errorf("encode: %w: %s.%s", ErrNotEncodable,
+				textOperator, key)
+		}
+
+		add(delimiter+name, str)
+	}
+
+	return nil
+}
+
+// encodeField adds the conditions of a field. A scalar value is
+// an equality, a document is a list of conditions.
+func encodeField(add addFunc, field string, value interface{}) (err error) {
+	doc, isDoc := value.(M)
+	if _, _, isRegex := asRegex(value); isRegex || !isDoc {
+		if str, ok := encodeValue(value); ok {
+			add(field, str)
+
+			return nil
+		}
+
+		doc = M{operatorEquals.MongoOperator(): value}
+	}
+
+	for _, mongoOp := range sortedFields(doc) {
+		if mongoOp == operatorElemMatch.MongoOperator() {
+			err = encodeElemMatch(add, field, doc[mongoOp])
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		params, err := encodeCondition(mongoOp, doc[mongoOp])
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, field)
+		}
+
+		for _, p := range params {
+			add(paramKey(field, p.op), p.values...)
+		}
+	}
+
+	return nil
+}
+
+// encodeElemMatch adds the conditions of an $elemMatch document with
+// the elem operator, i.e. "items__elem[price__gt]".
+func encodeElemMatch(add addFunc, field string, value interface{}) (
+	err error) {
+	match, isDoc := value.(M)
+	if !isDoc {
+		return fmt.Errorf("encode: %w: %s", ErrNotEncodable, field)
+	}
+
+	prefix := field + delimiter + string(operatorElemMatch)
+
+	return encodeFilter(func(key string, vals ...string) {
+		add(prefix+"["+key+"]", vals...)
+	}, match, false)
+}
+
+// paramKey builds a query key of a field condition.
+func paramKey(field string, op operator) (key string) {
+	if op == operatorInArray {
+		return field + string(op)
+	}
+
+	return field + delimiter + string(op)
+}
+
+// encodeCondition converts a condition of a field document to the query
+// operators and values.
+func encodeCondition(mongoOp string, value interface{}) (
+	params []param, err error) {
+	notEncodable := fmt.Errorf("encode: %w: %s", ErrNotEncodable, mongoOp)
+
+	switch mongoOp {
+	case operatorIn.MongoOperator(), operatorNotIn.MongoOperator():
+		return encodeArray(mongoOp, value)
+	case operatorAll.MongoOperator():
+		values, ok := encodeValues(value)
+		if !ok {
+			return nil, notEncodable
+		}
+
+		return []param{{op: operatorAllArray, values: values}}, nil
+	case operatorNot.MongoOperator():
+		return encodeNot(value)
+	case operatorNear.MongoOperator(), operatorNearSphere.MongoOperator(),
+		operatorGeoWithin.MongoOperator():
+		return encodeGeo(mongoOp, value)
+	}
+
+	op, known := encodedOperators[mongoOp]
+	if !known {
+		return nil, notEncodable
+	}
+
+	if pattern, options, isRegex := asRegex(value); isRegex &&
+		op == operatorEquals {
+		return regexParam(operatorRegex, pattern, options)
+	}
+
+	if value == nil {
+		switch op {
+		case operatorEquals:
+			return []param{{op: operatorNull, values: []string{"true"}}}, nil
+		case operatorNotEquals:
+			return []param{{op: operatorNull, values: []string{"false"}}}, nil
+		}
+	}
+
+	if _, isArray := value.([]interface{}); isArray {
+		if op == operatorEquals {
+			op = operatorEqualArray
+		}
+
+		str, ok := joinValues(value)
+		if !ok || !op.IsArguments() && op != operatorEqualArray {
+			return nil, notEncodable
+		}
+
+		return []param{{op: op, values: []string{str}}}, nil
+	}
+
+	str, ok := encodeValue(value)
+	if !ok {
+		return nil, notEncodable
+	}
+
+	return []param{{op: op, values: []string{str}}}, nil
+}
+
+// encodeArray converts an $in or a $nin array. The regular expressions
+// are encoded with the regex operators, i.e. "re[]" or "nre[]", the other
+// values with the "[]" operator or a comma separated "nin" list.
+func encodeArray(mongoOp string, value interface{}) (
+	params []param, err error) {
+	notEncodable := fmt.Errorf("encode: %w: %s", ErrNotEncodable, mongoOp)
+
+	arr, isArray := value.([]interface{})
+	if !isArray {
+		return nil, notEncodable
+	}
+
+	negated := mongoOp == operatorNotIn.MongoOperator()
+	regexOp := operatorRegex + operatorInArray
+
+	var plain []string
+
+	for _, elem := range arr {
+		if pattern, options, isRegex := asRegex(elem); isRegex {
+			op := regexOp
+			if negated {
+				op = negatedPrefix + op
+			}
+
+			regex, err := regexParam(op, pattern, options)
+			if err != nil {
+				return nil, err
+			}
+
+			params = append(params, regex...)
+
+			continue
+		}
+
+		str, ok := encodeValue(elem)
+		if !ok || negated && strings.Contains(str, arrayDelimiter) {
+			return nil, notEncodable
+		}
+
+		plain = append(plain, str)
+	}
+
+	switch {
+	case len(plain) == 0:
+	case negated:
+		params = append(params, param{
+			op: operatorNotIn, values: []string{
+				strings.Join(plain, arrayDelimiter),
+			},
+		})
+	default:
+		params = append(params, param{op: operatorInArray, values: plain})
+	}
+
+	return params, nil
+}
+
+// encodeNot converts a $not of a regular expression to a negated regex
+// operator and a $not of a single condition to the not modifier.
+func encodeNot(value interface{}) (params []param, err error) {
+	notEncodable := fmt.Errorf("encode: %w: %s", ErrNotEncodable,
+		operatorNot.MongoOperator())
+
+	if pattern, options, isRegex := asRegex(value); isRegex {
+		return regexParam(negatedPrefix+operatorRegex, pattern, options)
+	}
+
+	doc, isDoc := value.(M)
+	if !isDoc || len(doc) != 1 {
+		return nil, notEncodable
+	}
+
+	for mongoOp, inner := range doc {
+		if _, _, isRegex := asRegex(inner); isRegex {
+			return nil, notEncodable
+		}
+
+		params, err = encodeCondition(mongoOp, inner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(params) != 1 {
+		return nil, notEncodable
+	}
+
+	params[0].op = notModifier + params[0].op
+	if !params[0].op.resolveNot().IsValid() {
+		return nil, notEncodable
+	}
+
+	return params, nil
+}
+
+// encodeGeo converts the $near, $nearSphere and $geoWithin documents to
+// the "lon,lat,meters" values and the shapes of the within operator.
+func encodeGeo(mongoOp string, value interface{}) (
+	params []param, err error) {
+	notEncodable := fmt.Errorf("encode: %w: %s", ErrNotEncodable, mongoOp)
+
+	doc, isDoc := value.(M)
+	if !isDoc {
+		return nil, notEncodable
+	}
+
+	var (
+		op     operator
+		values []interface{}
+	)
+
+	switch mongoOp {
+	case operatorNear.MongoOperator(), operatorNearSphere.MongoOperator():
+		op = operatorNear
+		if mongoOp == operatorNearSphere.MongoOperator() {
+			op = operatorNearSphere
+		}
+
+		geometry, _ := doc["$geometry"].(M)
+		coordinates, _ := geometry["coordinates"].([]interface{})
+		values = append(coordinates, doc["$maxDistance"])
+	case operatorGeoWithin.MongoOperator():
+		center, _ := doc["$centerSphere"].([]interface{})
+		if len(center) == 2 {
+			radius, _ := center[1].(float64)
+
+			point, _ := center[0].([]interface{})
+			op, values = operatorGeoWithin, append(point, radius*earthRadius)
+
+			break
+		}
+
+		shape, _ := doc["$box"].([]interface{})
+		if shape == nil {
+			shape, _ = doc["$polygon"].([]interface{})
+		}
+
+		op = operatorWithin
+
+		for _, point := range shape {
+			coordinates, _ := point.([]interface{})
+			values = append(values, coordinates...)
+		}
+	}
+
+	str, ok := joinValues(values)
+
+	switch {
+	case !ok:
+	case op == operatorWithin && len(values) >= boxValues:
+	case op != operatorWithin && len(values) == 3:
+	default:
+		ok = false
+	}
+
+	if !ok {
+		return nil, notEncodable
+	}
+
+	return []param{{op: op, values: []string{str}}}, nil
+}
+
+// regexParam converts a regular expression to a regex operator, the "i"
+// option is encoded with the ignore case prefix.
+func regexParam(op operator, pattern, options string) (
+	params []param, err error) {
+	switch options {
+	case "":
+	case ignoreCasePrefix:
+		op = ignoreCasePrefix + op
+	default:
+		return nil, fmt.Errorf("encode: %w: regex options %q",
+			ErrNotEncodable, options)
+	}
+
+	return []param{{op: op, values: []string{pattern}}}, nil
+}
+
+// asRegex returns the pattern and the options of a canonical regular
+// expression.
+func asRegex(value interface{}) (pattern, options string, ok bool) {
+	doc, isDoc := value.(M)
+	if !isDoc || len(doc) != 2 {
+		return "", "", false
+	}
+
+	pattern, hasPattern := doc["$regex"].(string)
+	options, hasOptions := doc["$options"].(string)
+
+	return pattern, options, hasPattern && hasOptions
+}
+
+// encodeValues formats the elements of an array.
+func encodeValues(value interface{}) (values []string, ok bool) {
+	arr, isArray := value.([]interface{})
+	if !isArray {
+		return nil, false
+	}
+
+	values = make([]string, len(arr))
+	for i, elem := range arr {
+		if values[i], ok = encodeValue(elem); !ok {
+			return nil, false
+		}
+	}
+
+	return values, true
+}
+
+// joinValues formats the elements of an array as a comma separated list.
+// The elements that contain a comma can not be joined.
+func joinValues(value interface{}) (s string, ok bool) {
+	values, ok := encodeValues(value)
+	if !ok {
+		return "", false
+	}
+
+	for _, val := range values {
+		if strings.Contains(val, arrayDelimiter) {
+			return "", false
+		}
+	}
+
+	return strings.Join(values, arrayDelimiter), true
+}
+
+// encodeValue formats a scalar value of a canonical filter. The ObjectIDs
+// are formatted as hex strings.
+func encodeValue(value interface{}) (s string, ok bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case interface{ Hex() string }:
+		return v.Hex(), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+
+	rv := reflect.ValueOf(value)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, 64), true
+	}
+
+	return "", false
+}
+
+// sortedFields returns the keys of a document in a stable order.
+func sortedFields(doc M) (fields []string) {
+	fields = make([]string, 0, len(doc))
+	for field := range doc {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
@@ -0,0 +1,181 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testHexID struct{}
+
+func (testHexID) Hex() string { return "5f1d7a" }
+
+//nolint:paralleltest
+func TestQueryEncode(t *testing.T) {
+	q := Query{
+		Filter: M{
+			"status":  "open",
+			"owner":   testHexID{},
+			"deleted": nil,
+			"age":     M{"$gte": int64(18), "$lt": 65.5, "$ne": nil},
+			"created": M{"$gt": time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)},
+			"name":    testRegEx{regex: "^jo", options: "i"},
+			"email":   M{"$not": testRegEx{regex: "@test$"}},
+			"tags": M{
+				"$in": []interface{}{"a,b", testRegEx{regex: "^x"}},
+				"$nin": []interface{}{
+					"c", "d", testRegEx{regex: "y", options: "i"},
+				},
+				"$all": []interface{}{"e", "f"},
+			},
+			"seq":   M{"$mod": []interface{}{int64(4), int64(1)}},
+			"flags": M{"$bitsAnySet": int64(5), "$size": 3},
+			"score": M{"$not": M{"$gt": 10}},
+			"codes": M{"$eq": []interface{}{1, 2}},
+			"items": M{"$elemMatch": M{
+				"qty":   M{"$gte": 2},
+				"color": "red",
+			}},
+			"loc": M{"$near": M{
+				"$geometry": M{
+					"type":        "Point",
+					"coordinates": []interface{}{37.61, 55.75},
+				},
+				"$maxDistance": 5000.0,
+			}},
+			"area": M{"$geoWithin": M{"$box": []interface{}{
+				[]interface{}{2.2, 48.8}, []interface{}{2.5, 48.9},
+			}}},
+			"$or":   []M{{"vip": true}, {"spent": M{"$gt": 100}}},
+			"$and":  []M{{"x": 1}, {"x": 2}},
+			"$text": M{"$search": "coffee", "$language": "en"},
+		},
+		Sort: []interface{}{
+			testSortElem{Key: "age", Value: -1},
+			M{"score": M{"$meta": "textScore"}},
+			M{"name": 1},
+		},
+		Limit:      10,
+		Skip:       20,
+		Projection: map[string]int{"name": 1, "age": 1},
+	}
+
+	values, err := q.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"status":                {"open"},
+		"owner":                 {"5f1d7a"},
+		"deleted__null":         {"true"},
+		"age__gte":              {"18"},
+		"age__lt":               {"65.5"},
+		"age__null":             {"false"},
+		"created__gt":           {"2021-01-02T03:04:05Z"},
+		"name__ire":             {"^jo"},
+		"email__nre":            {"@test$"},
+		"tags[]":                {"a,b"},
+		"tags__re[]":            {"^x"},
+		"tags__nin":             {"c,d"},
+		"tags__inre[]":          {"y"},
+		"tags__all[]":           {"e", "f"},
+		"seq__mod":              {"4,1"},
+		"flags__banyset":        {"5"},
+		"flags__size":           {"3"},
+		"score__not__gt":        {"10"},
+		"codes__eqa":            {"1,2"},
+		"items__elem[color]":    {"red"},
+		"items__elem[qty__gte]": {"2"},
+		"loc__near":             {"37.61,55.75,5000"},
+		"area__within":          {"2.2,48.8,2.5,48.9"},
+		"__or[0][vip]":          {"true"},
+		"__or[1][spent__gt]":    {"100"},
+		"__and[0][x]":           {"1"},
+		"__and[1][x]":           {"2"},
+		"__search":              {"coffee"},
+		"__search_lang":         {"en"},
+		"__sort":                {"-age,__score,name"},
+		"__limit":               {"10"},
+		"__skip":                {"20"},
+		"__fields":              {"age,name"},
+	}, values)
+
+	values, err = Query{}.Encode()
+	assert.NoError(t, err)
+	assert.Empty(t, values)
+
+	values, err = Query{Limit: 25, Skip: 50, Page: 3}.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"__page":     {"3"},
+		"__per_page": {"25"},
+	}, values)
+
+	values, err = Query{Limit: 25, Skip: 60, Page: 3}.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"__limit": {"25"}, "__skip": {"60"}}, values)
+}
+
+//nolint:paralleltest
+func TestQueryEncodeNotEncodable(t *testing.T) {
+	for name, q := range map[string]Query{
+		"nested group": {Filter: M{"$or": []M{{"$and": []M{{"a": 1}}}}}},
+		"unknown operator": {Filter: M{"a": M{"$between": []interface{}{
+			1, 2,
+		}}}},
+		"subdocument":    {Filter: M{"a": M{"b": 1}}},
+		"regex options":  {Filter: M{"a": testRegEx{regex: "x", options: "m"}}},
+		"nin comma":      {Filter: M{"a": M{"$nin": []interface{}{"x,y"}}}},
+		"not of two":     {Filter: M{"a": M{"$not": M{"$gt": 1, "$lt": 5}}}},
+		"not of in":      {Filter: M{"a": M{"$not": M{"$in": []interface{}{1}}}}},
+		"bad value":      {Filter: M{"a": struct{}{}}},
+		"bad geometry":   {Filter: M{"a": M{"$near": M{"$maxDistance": 1}}}},
+		"sort comma":     {Sort: []interface{}{M{"a,b": 1}}},
+		"sort meta":      {Sort: []interface{}{M{"a": M{"$meta": "x"}}}},
+		"text operator":  {Filter: M{"$text": M{"$foo": "x"}}},
+		"top level expr": {Filter: M{"$expr": M{}}},
+	} {
+		_, err := q.Encode()
+		assert.True(t, errors.Is(err, ErrNotEncodable), "%s: %v", name, err)
+	}
+}
+
+//nolint:paralleltest
+func TestQueryEncodeRoundTrip(t *testing.T) {
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"name":      Field{Converter: String()},
+			"age":       Field{Converter: Int()},
+			"price":     Field{Converter: Double()},
+			"tags":      Field{Converter: String()},
+			"created":   Field{Converter: Date()},
+			"loc":       Field{GeoPoint: true},
+			"items":     Field{},
+			"items.sku": Field{Converter: String()},
+			"items.qty": Field{Converter: Int()},
+		},
+		ValidateFields:  true,
+		AllowTextSearch: true,
+	}
+
+	values, err := url.ParseQuery("name__ico=Jo.n&age__gte=18&age__not__lt=21" +
+		"&price__range=1.5,20&tags__in=a,b&tags__nin=c&tags__all=d,e" +
+		"&created__lt=2021-01-02T03:04:05Z&loc__near=37.61,55.75,5000" +
+		"&items__elem[sku]=x&items__elem[qty__gt]=2" +
+		"&__or[0][name]=a&__or[1][age]=5&__and[0][tags]=f" +
+		"&__search=coffee&__sort=-age,name&__limit=10&__skip=5" +
+		"&__fields=name,age")
+	assert.NoError(t, err)
+
+	q, err := p.Parse(values)
+	assert.NoError(t, err)
+
+	encoded, err := q.Encode()
+	assert.NoError(t, err)
+
+	reparsed, err := p.Parse(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, q, reparsed)
+}
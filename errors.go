@@ -0,0 +1,167 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RangeError is returned when a numeric parameter, i.e. __limit or
+// __skip, is negative or exceeds its maximum value. It unwraps to
+// ErrLimitTooLarge for too large __limit and __per_page and to ErrOutOfRange
+// for the others.
+type RangeError struct {
+	// Param is a parameter name without the delimiter, i.e. "skip".
+	Param string
+	// Value is a raw parameter value.
+	Value string
+	// Max is the maximum allowed value.
+	Max int64
+}
+
+func (e *RangeError) Error() (s string) {
+	if e.isNegative() {
+		return fmt.Sprintf("%s parameter: %v: %s is less than 0",
+			e.Param, ErrOutOfRange, e.Value)
+	}
+
+	return fmt.Sprintf("%s parameter: %v: %s exceeds the maximum of %d",
+		e.Param, ErrOutOfRange, e.Value, e.Max)
+}
+
+// Unwrap returns ErrLimitTooLarge or ErrOutOfRange.
+func (e *RangeError) Unwrap() (err error) {
+	if !e.isNegative() && (e.Param == limitParam || e.Param == perPageParam) {
+		return ErrLimitTooLarge
+	}
+
+	return ErrOutOfRange
+}
+
+// isNegative reports whether the value is below the minimum of 0 rather
+// than above the maximum, the values out of the int64 range included.
+func (e *RangeError) isNegative() (ok bool) {
+	return strings.HasPrefix(e.Value, "-")
+}
+
+// maxRawValues is the number of raw values kept by ParseError.
+const maxRawValues = 2
+
+// ParseError describes a problem with a single query field or directive.
+// It unwraps to the underlying error, i.e. ErrNoMatch or ErrTooManyValues,
+// and is matched with errors.As(err, &ParseError{}).
+type ParseError struct {
+	// Field is a field name.
+	Field string
+	// Operator is a public spelling of the operator, i.e. "gte".
+	Operator string
+	// Count is the number of values received.
+	Count int
+	// RawValues holds up to two offending raw values.
+	RawValues []string
+	// Err is the underlying error.
+	Err error
+}
+
+func newParseError(op operator, values []string, err error) (
+	pe ParseError) {
+	pe = ParseError{
+		Operator: op.String(),
+		Count:    len(values),
+		Err:      err,
+	}
+
+	if len(values) > maxRawValues {
+		values = values[:maxRawValues]
+	}
+
+	pe.RawValues = append([]string(nil), values...)
+
+	return pe
+}
+
+// asParseError returns err if it is already a ParseError, otherwise it
+// wraps err with a ParseError for the field, operator and values.
+func asParseError(field string, op operator, values []string, err error) (
+	parseErr error) {
+	if errors.As(err, &ParseError{}) {
+		return err
+	}
+
+	pe := newParseError(op, values, err)
+	pe.Field = field
+
+	return pe
+}
+
+func (e ParseError) Error() (s string) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%v: %s", e.Err, e.Field)
+
+	if len(e.Operator) > 0 {
+		fmt.Fprintf(&b, "[%s]", e.Operator)
+	}
+
+	if e.Count > 0 {
+		fmt.Fprintf(&b, ": %d values: ", e.Count)
+
+		for i, val := range e.RawValues {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+
+			b.WriteString(strconv.Quote(val))
+		}
+
+		if e.Count > len(e.RawValues) {
+			b.WriteString(", ...")
+		}
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e ParseError) Unwrap() (err error) { return e.Err }
+
+// ParseErrors is an error returned by Parser.Parse. It holds all
+// the problems of a query and unwraps to every one of them, so errors.Is
+// works with all the sentinel errors.
+type ParseErrors struct {
+	errs   []error
+	format func(ParseError) string
+}
+
+// Error joins the messages of all the problems. With the ErrorFormatter of
+// the parser the messages are the formatted Errors, one per line.
+func (e *ParseErrors) Error() (s string) {
+	if e.format == nil {
+		return "parse: " + errors.Join(e.errs...).Error()
+	}
+
+	messages := make([]string, 0, len(e.errs))
+	for _, err := range e.Errors() {
+		messages = append(messages, e.format(err))
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap returns all the underlying errors.
+func (e *ParseErrors) Unwrap() (errs []error) { return e.errs }
+
+// Errors returns all the problems of a query as ParseErrors. Problems that
+// do not relate to a field, i.e. a bad __limit value, have an empty Field.
+func (e *ParseErrors) Errors() (errs []ParseError) {
+	errs = make([]ParseError, len(e.errs))
+
+	for i, err := range e.errs {
+		if !errors.As(err, &errs[i]) {
+			errs[i] = ParseError{Err: err}
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,119 @@
+package query_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	query "github.com/Denisss025/mongo-uri-query"
+)
+
+func ExampleQuery_AddFilter() {
+	var q query.Query
+
+	q.AddFilter("status", query.OpEquals, "open")
+	q.AddFilter("status", query.OpNotEquals, "closed")
+	q.AddFilter("tags", query.OpIn, []interface{}{"a"})
+	q.AddFilter("tags", query.OpIn, []interface{}{"b", "c"})
+
+	fmt.Println(q.Filter)
+	// Output: map[status:map[$eq:open $ne:closed] tags:map[$in:[a b c]]]
+}
+
+func ExampleParseErrors_Errors() {
+	p := query.Parser{
+		Converter: query.NewDefaultConverter(nil),
+		Fields: query.Fields{
+			"age":   query.Field{Converter: query.Int()},
+			"price": query.Field{Converter: query.Int()},
+		},
+	}
+
+	_, err := p.Parse(url.Values{
+		"age__gte":       []string{"old"},
+		"price__between": []string{"20,10"},
+	})
+
+	// the details of a 422 response
+	var parseErrs *query.ParseErrors
+	if errors.As(err, &parseErrs) {
+		for _, e := range parseErrs.Errors() {
+			fmt.Println(e.Field, e.Operator, e.RawValues,
+				errors.Is(e, query.ErrBadRange))
+		}
+	}
+	// Output:
+	// age gte [old] false
+	// price between [20 10] true
+}
+
+//nolint:paralleltest
+func TestParseOp(t *testing.T) {
+	for s, expected := range map[string]query.Operator{
+		"gte":  query.OpGreaterThanOrEquals,
+		"IN":   query.OpIn,
+		"nin":  query.OpNotIn,
+		"size": query.OpSize,
+		"EQ":   {},
+	} {
+		op, err := query.ParseOp(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected.MongoOperator(), op.MongoOperator(), s)
+		assert.Equal(t, expected.String(), op.String(), s)
+	}
+
+	for s, expected := range map[string]string{
+		"ire":     "ire",
+		"nco":     "nco",
+		"not__re": "nre",
+		"NOT__GT": "not__gt",
+	} {
+		op, err := query.ParseOp(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, op.String(), s)
+	}
+
+	for _, s := range []string{
+		"", "elem", "not", "gte__lt", "foo", "not__near", "not__not__gt",
+		"range", "between", "datebetween", "null", "not__range",
+	} {
+		_, err := query.ParseOp(s)
+		assert.True(t, errors.Is(err, query.ErrUnknownOperator), s)
+	}
+}
+
+//nolint:paralleltest
+func TestAddFilterExternal(t *testing.T) {
+	var q query.Query
+
+	gte, err := query.ParseOp("gte")
+	assert.NoError(t, err)
+
+	q.AddFilter("age", query.OpEquals, 18)
+	q.AddFilter("age", gte, 10)
+	q.AddFilter("name", query.OpNotIn, []interface{}{"a"})
+	q.AddFilter("name", query.OpNotIn, []interface{}{"b"})
+
+	assert.Equal(t, query.M{
+		"age":  query.M{"$eq": 18, "$gte": 10},
+		"name": query.M{"$nin": []interface{}{"a", "b"}},
+	}, q.Filter)
+	assert.Equal(t, "$gte", gte.MongoOperator())
+
+	notGT, err := query.ParseOp("NOT__GT")
+	assert.NoError(t, err)
+
+	q = query.Query{}
+	q.AddFilter("status", query.Operator{}, "open")
+	q.AddFilter("score", notGT, 5)
+
+	assert.Equal(t, query.M{
+		"status": "open",
+		"score":  query.M{"$not": query.M{"$gt": 5}},
+	}, q.Filter)
+	assert.Equal(t, "eq", query.Operator{}.String())
+	assert.Equal(t, "$eq", query.Operator{}.MongoOperator())
+}
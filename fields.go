@@ -1,27 +1,165 @@
 package query
 
+import "strings"
+
 // Field is a structure that holds field specification.
 type Field struct {
 	// Converter defines a type of the field.
 	Converter Converter
 	// Required defines if the field is required.
 	Required bool
+	// RequiredWith makes the field required only when any of the listed
+	// fields has a condition, i.e. "currency" with "price".
+	RequiredWith []string
+	// DBName is a name of the field in the database documents. The query
+	// parameter name is used when it is empty. The nested fields of
+	// an aliased field are renamed too, i.e. "user.city" is "usr.city"
+	// when the "user" field has the "usr" DBName.
+	DBName string
+	// NoRegex forbids the unanchored pattern operators on the field, i.e.
+	// "re" and "co" with their variants, since they need a collection
+	// scan. The starts-with operators are allowed as an anchored pattern
+	// can use an index.
+	NoRegex bool
+	// AllowEmpty makes the field keep the empty values regardless of
+	// the parser's EmptyValues policy.
+	AllowEmpty bool
+	// GeoPoint marks a field that holds a GeoJSON point. With
+	// ValidateFields the geospatial operators are only allowed on such
+	// fields.
+	GeoPoint bool
+	// AllowedOperators lists the public names of the operators allowed on
+	// the field, i.e. "eq" and "in", the others are reported with
+	// ErrOperatorNotAllowed. The negated operators are listed by their
+	// own names, i.e. "nin" for "not__in" and "not__gt". Empty allows all
+	// the operators.
+	AllowedOperators []string
+	// Strict makes the values of the field converted only with its
+	// Converter: neither the parser's Converter nor the NullLiteral are
+	// consulted, so a numeric id never ends up matched as a bool or a date.
+	// A strict field without a Converter is reported with ErrNoConverter.
+	// The operators of a fixed type, i.e. "exists" or "re", are not
+	// affected.
+	Strict bool
+	// Validate checks every converted value of the field, i.e. a bound of
+	// a range or an element of "in", and reports the business rules
+	// violations, i.e. a non-positive price. Its errors are wrapped with
+	// ErrInvalidValue and reported as ParseError with the field name.
+	// The nil values and the values of the operators of a fixed type, i.e.
+	// "exists" or "re", are not validated.
+	Validate func(value interface{}) error
+	// Transform replaces every converted value of the field after
+	// Validate, i.e. lowercases an email or maps an external code to
+	// an internal ID. Its errors are reported like the errors of Validate.
+	// The nil values and the values of the operators of a fixed type are
+	// not transformed.
+	Transform func(value interface{}) (interface{}, error)
+	// Default is the condition on the field that is added when the query
+	// has no condition on it, neither at the top level nor in a group.
+	// Unlike Required, a query without the field succeeds. Default is
+	// ignored for the patterns.
+	Default *FieldDefault
+}
+
+// FieldDefault is a default condition of a field, i.e. "status=active".
+type FieldDefault struct {
+	// Operator is a public name of the operator, "eq" when it is empty.
+	Operator string
+	// Value is a query value, it is converted like the query values are.
+	Value string
 }
 
-// Fields is a map with fields specifications.
+// Fields is a map with fields specifications. A key that ends with ".*"
+// (i.e. "address.*") specifies every direct child of a field and a key that
+// ends with ".**" (i.e. "attributes.**") specifies all the nested fields at
+// any depth. An exact key wins over the patterns and a longer pattern wins
+// over a shorter one. Required is ignored for the patterns.
 type Fields map[string]Field
 
+const (
+	// wildcardChild is the suffix of a pattern of the direct children.
+	wildcardChild = ".*"
+	// wildcardDescendant is the suffix of a pattern of the nested fields.
+	wildcardDescendant = ".**"
+)
+
+// isPattern checks if a key of the fields specifications is a pattern.
+func isPattern(name string) (ok bool) {
+	return strings.HasSuffix(name, wildcardChild) ||
+		strings.HasSuffix(name, wildcardDescendant)
+}
+
+// matchPattern checks if a field name matches a key of the fields
+// specifications, either exactly or as a pattern. A pattern is never
+// matched as a name.
+func matchPattern(key, name string) (ok bool) {
+	if isPattern(name) {
+		return false
+	}
+
+	if key == name {
+		return true
+	}
+
+	if strings.Contains(name, delimiter) {
+		return false
+	}
+
+	switch {
+	case strings.HasSuffix(key, wildcardDescendant):
+		prefix := strings.TrimSuffix(key, "**")
+
+		return len(name) > len(prefix) && strings.HasPrefix(name, prefix)
+	case strings.HasSuffix(key, wildcardChild):
+		prefix := strings.TrimSuffix(key, "*")
+
+		return len(name) > len(prefix) && strings.HasPrefix(name, prefix) &&
+			!strings.Contains(name[len(prefix):], ".")
+	}
+
+	return false
+}
+
+// lookup returns the specification of a field either by its exact name or
+// by the longest matching pattern. The patterns never match the names that
+// contain the delimiter, so the operators are not a part of a field, and
+// a pattern itself, i.e. "address.*", is not a field name.
+func (f Fields) lookup(name string) (field Field, ok bool) {
+	if isPattern(name) {
+		return field, false
+	}
+
+	if field, ok = f[name]; ok || strings.Contains(name, delimiter) {
+		return field, ok
+	}
+
+	last := strings.LastIndexByte(name, '.')
+	for pos := last; pos > 0; pos = strings.LastIndexByte(name[:pos], '.') {
+		if pos == last {
+			if field, ok = f[name[:pos]+wildcardChild]; ok {
+				return field, true
+			}
+		}
+
+		if field, ok = f[name[:pos]+wildcardDescendant]; ok {
+			return field, true
+		}
+	}
+
+	return field, false
+}
+
 // HasField check if a field with a given name is present in the
 // fields specifications.
 func (f Fields) HasField(name string) (ok bool) {
-	_, ok = f[name]
+	_, ok = f.lookup(name)
 
 	return
 }
 
 // Converter returns a specified converter for a field with a given name.
 func (f Fields) Converter(name string) (converter Converter, ok bool) {
-	field, ok := f[name]
+	field, ok := f.lookup(name)
 	if ok {
 		converter = field.Converter
 	}
@@ -39,3 +177,23 @@ func (f Fields) IsRequired(name string) (ok bool) {
 
 	return
 }
+
+// DBName returns a name of the field in the database documents. The name
+// of the field or of the nearest parent field with a DBName is replaced,
+// other names are returned as is.
+func (f Fields) DBName(name string) (dbName string) {
+	for prefix := name; len(prefix) > 0; {
+		if field, ok := f[prefix]; ok && len(field.DBName) > 0 {
+			return field.DBName + name[len(prefix):]
+		}
+
+		pos := strings.LastIndexByte(prefix, '.')
+		if pos < 0 {
+			break
+		}
+
+		prefix = prefix[:pos]
+	}
+
+	return name
+}
@@ -42,3 +42,72 @@ func TestFields(t *testing.T) {
 	assert.False(t, f.IsRequired("field2"))
 	assert.False(t, f.IsRequired("field3"))
 }
+
+//nolint:paralleltest
+func TestFieldsDBName(t *testing.T) {
+	f := Fields{
+		"createdAt":    Field{DBName: "created_at"},
+		"user":         Field{DBName: "usr"},
+		"user.address": Field{DBName: "usr.addr"},
+		"plain":        Field{},
+	}
+
+	assert.Equal(t, "created_at", f.DBName("createdAt"))
+	assert.Equal(t, "usr", f.DBName("user"))
+	assert.Equal(t, "usr.name", f.DBName("user.name"))
+	assert.Equal(t, "usr.addr", f.DBName("user.address"))
+	assert.Equal(t, "usr.addr.city", f.DBName("user.address.city"))
+	assert.Equal(t, "plain", f.DBName("plain"))
+	assert.Equal(t, "plain.x", f.DBName("plain.x"))
+	assert.Equal(t, "unknown", f.DBName("unknown"))
+	assert.Equal(t, "users", f.DBName("users"))
+	assert.Equal(t, "", f.DBName(""))
+	assert.Equal(t, "x", Fields(nil).DBName("x"))
+}
+
+//nolint:paralleltest
+func TestFieldsWildcard(t *testing.T) {
+	f := Fields{
+		"a.*":         Field{Converter: String()},
+		"b.**":        Field{Converter: Int()},
+		"b.c.**":      Field{Converter: Bool()},
+		"b.exact":     Field{Converter: Double()},
+		"address.*":   Field{Converter: String(), Required: true},
+		"plain__code": Field{},
+	}
+
+	assert.True(t, f.HasField("a.b"))
+	assert.False(t, f.HasField("a.b.c"))
+	assert.False(t, f.HasField("a"))
+	assert.True(t, f.HasField("b.x"))
+	assert.True(t, f.HasField("b.x.y.z"))
+	assert.False(t, f.HasField("b"))
+	assert.False(t, f.HasField("a.b__in"))
+	assert.False(t, f.HasField("a.*"))
+	assert.False(t, f.HasField("b.**"))
+	assert.False(t, f.HasField("b.c.**"))
+	assert.True(t, f.HasField("plain__code"))
+
+	conv, ok := f.Converter("b.exact")
+	assert.True(t, ok)
+
+	v, err := conv.Convert("1.5")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+
+	conv, ok = f.Converter("b.c.d")
+	assert.True(t, ok)
+
+	v, err = conv.Convert("true")
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+
+	conv, ok = f.Converter("b.x")
+	assert.True(t, ok)
+
+	v, err = conv.Convert("3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+
+	assert.False(t, f.IsRequired("address.city"))
+}
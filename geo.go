@@ -0,0 +1,168 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// boxValues is a number of the values of a "minLng,minLat,maxLng,maxLat"
+	// box of the within operator.
+	boxValues = 4
+	// minPolygonPoints is a number of the points of the smallest polygon.
+	minPolygonPoints = 3
+
+	// earthRadius is the equatorial radius of the Earth in meters that
+	// converts distances to the radians of $centerSphere.
+	earthRadius = 6378100
+
+	maxLongitude = 180
+	maxLatitude  = 90
+)
+
+// geoPoint is a point of the near and geowithin operators with a distance
+// in meters.
+type geoPoint struct {
+	lon, lat, distance float64
+}
+
+// parseGeoPoint parses a "lon,lat,meters" value. The components are always
+// floats regardless of the field converter.
+func parseGeoPoint(val string) (pt geoPoint, err error) {
+	parts := strings.Split(val, arrayDelimiter)
+	if len(parts) != 3 {
+		return pt, fmt.Errorf("%w: want lon,lat,meters, got %d values",
+			ErrBadCoordinates, len(parts))
+	}
+
+	names := [...]string{"longitude", "latitude", "distance"}
+	nums := make([]float64, len(parts))
+
+	for i, part := range parts {
+		if nums[i], err = strconv.ParseFloat(part, 64); err != nil {
+			return pt, fmt.Errorf("%w: %s: %w", ErrBadCoordinates,
+				names[i], err)
+		}
+
+		if math.IsNaN(nums[i]) || math.IsInf(nums[i], 0) {
+			return pt, fmt.Errorf("%w: %s %v", ErrBadCoordinates,
+				names[i], nums[i])
+		}
+	}
+
+	pt = geoPoint{lon: nums[0], lat: nums[1], distance: nums[2]}
+
+	if err = checkCoordinates(pt.lon, pt.lat); err != nil {
+		return pt, err
+	}
+
+	if pt.distance < 0 {
+		return pt, fmt.Errorf("%w: distance %v", ErrOutOfRange,
+			pt.distance)
+	}
+
+	return pt, nil
+}
+
+// checkCoordinates checks a longitude and a latitude to be in range.
+func checkCoordinates(lon, lat float64) (err error) {
+	switch {
+	case math.IsNaN(lon) || math.IsInf(lon, 0):
+		return fmt.Errorf("%w: longitude %v", ErrBadCoordinates, lon)
+	case math.IsNaN(lat) || math.IsInf(lat, 0):
+		return fmt.Errorf("%w: latitude %v", ErrBadCoordinates, lat)
+	case lon < -maxLongitude || lon > maxLongitude:
+		return fmt.Errorf("%w: longitude %v", ErrOutOfRange, lon)
+	case lat < -maxLatitude || lat > maxLatitude:
+		return fmt.Errorf("%w: latitude %v", ErrOutOfRange, lat)
+	}
+
+	return nil
+}
+
+// parseGeoShape parses a value of the within operator to a $box document
+// for a "minLng,minLat,maxLng,maxLat" box and to a $polygon document for
+// a "lng1,lat1,lng2,lat2,lng3,lat3,..." polygon of three or more points.
+func parseGeoShape(val string) (shape M, err error) {
+	parts := strings.Split(val, arrayDelimiter)
+	if len(parts) < minPolygonPoints*2 && len(parts) != boxValues ||
+		len(parts)%2 != 0 {
+		return nil, fmt.Errorf("%w: want a box or a polygon, got %d values",
+			ErrBadCoordinates, len(parts))
+	}
+
+	points := make([]interface{}, 0, len(parts)/2)
+
+	for i := 0; i < len(parts); i += 2 {
+		lon, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: longitude: %w", ErrBadCoordinates,
+				err)
+		}
+
+		lat, err := strconv.ParseFloat(parts[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: latitude: %w", ErrBadCoordinates,
+				err)
+		}
+
+		if err = checkCoordinates(lon, lat); err != nil {
+			return nil, err
+		}
+
+		points = append(points, []interface{}{lon, lat})
+	}
+
+	if len(parts) != boxValues {
+		return M{"$polygon": points}, nil
+	}
+
+	bottomLeft, upperRight := points[0].([]interface{}),
+		points[1].([]interface{})
+	if bottomLeft[0].(float64) > upperRight[0].(float64) ||
+		bottomLeft[1].(float64) > upperRight[1].(float64) {
+		return nil, fmt.Errorf("%w: box corners are swapped",
+			ErrBadCoordinates)
+	}
+
+	return M{"$box": points}, nil
+}
+
+// convertGeo converts a value of the near and nearsphere operators to
+// a document with a GeoJSON point, of the geowithin operator to
+// a $centerSphere document with the radius in radians and of the within
+// operator to a $box or a $polygon document.
+func convertGeo(op operator, v []string) (value interface{}, err error) {
+	if len(v) > 1 {
+		return nil, newParseError(op, v, ErrTooManyValues)
+	}
+
+	if op == operatorWithin {
+		shape, err := parseGeoShape(strings.Join(v, ""))
+		if err != nil {
+			return nil, newParseError(op, v, err)
+		}
+
+		return shape, nil
+	}
+
+	pt, err := parseGeoPoint(strings.Join(v, ""))
+	if err != nil {
+		return nil, newParseError(op, v, err)
+	}
+
+	coordinates := []interface{}{pt.lon, pt.lat}
+
+	if op == operatorGeoWithin {
+		return M{"$centerSphere": []interface{}{
+			coordinates, pt.distance / earthRadius,
+		}}, nil
+	}
+
+	return M{
+		"$geometry":    M{"type": "Point", "coordinates": coordinates},
+		"$maxDistance": pt.distance,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// orParam is a name of the directive that groups conditions with $or,
+	// i.e. "__or[0][status]=open&__or[1][assignee]=me".
+	orParam = "or"
+	// andParam is a name of the directive that groups conditions with $and,
+	// i.e. "__and[0][tags__in]=a,b&__and[1][tags__in]=c,d".
+	andParam = "and"
+)
+
+// groupKey splits a key of a group directive, i.e. "__or[1][age__gte]", to
+// a group index and a key of a condition inside the group, i.e. "age__gte".
+// Nested fields keep the bracket syntax, so "__or[0][user][city]" is
+// the "user[city]" condition of the first group.
+func groupKey(key, name string) (index int, inner string, err error) {
+	rest := strings.TrimPrefix(key, delimiter+name)
+
+	idx, rest, ok := cutBrackets(rest)
+	if !ok || !isIndex(idx) {
+		return 0, "", fmt.Errorf("%w: bad index: %q", ErrBadGroup, key)
+	}
+
+	index, err = strconv.Atoi(idx)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: bad index: %q", ErrBadGroup, key)
+	}
+
+	field, rest, ok := cutBrackets(rest)
+	if !ok || len(field) == 0 {
+		return 0, "", fmt.Errorf("%w: no condition: %q", ErrBadGroup, key)
+	}
+
+	return index, field + rest, nil
+}
+
+// cutBrackets cuts the first bracketed segment of s, i.e. "[a][b]" is cut
+// to "a" and "[b]".
+func cutBrackets(s string) (segment, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", s, false
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return "", s, false
+	}
+
+	return s[1:end], s[end+1:], true
+}
+
+func isIndex(s string) (ok bool) {
+	if len(s) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseGroups converts the conditions of a group directive to a list of
+// filters ordered by the group indices. Every group goes through the same
+// pipeline as the top level conditions.
+func (p *Parser) parseGroups(query url.Values, name string, b *budget) (
+	groups []M, errs []error) {
+	prefix := delimiter + name
+
+	byIndex := make(map[int]url.Values)
+
+	for _, key := range sortedKeys(query) {
+		if key != prefix && !strings.HasPrefix(key, prefix+"[") {
+			continue
+		}
+
+		index, inner, err := groupKey(key, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("filter: %w", err))
+
+			continue
+		}
+
+		group, ok := byIndex[index]
+		if !ok {
+			group = make(url.Values)
+			byIndex[index] = group
+		}
+
+		group[inner] = append(group[inner], query[key]...)
+	}
+
+	indices := make([]int, 0, len(byIndex))
+	for index := range byIndex {
+		indices = append(indices, index)
+	}
+
+	sort.Ints(indices)
+
+	for _, index := range indices {
+		filter, groupErrs, complete := p.parseConditions(byIndex[index], b)
+		for _, err := range groupErrs {
+			errs = append(errs, fmt.Errorf("%s[%d]: %w", name, index, err))
+		}
+
+		if !complete {
+			return nil, errs
+		}
+
+		if filter.Filter != nil {
+			groups = append(groups, filter.Filter)
+		}
+	}
+
+	return groups, errs
+}
+
+// hasCondition checks if a filter has a condition on a field either at
+// the top level, in any $and group or in every $or group.
+func hasCondition(filter M, or, and []M, field string) (ok bool) {
+	if _, ok = filter[field]; ok {
+		return true
+	}
+
+	for _, group := range and {
+		if _, ok = group[field]; ok {
+			return true
+		}
+	}
+
+	for _, group := range or {
+		if _, ok = group[field]; !ok {
+			return false
+		}
+	}
+
+	return len(or) > 0
+}
+
+// mentionsField checks if the filter or any of its groups has a condition
+// on the field.
+func mentionsField(filter M, or, and []M, field string) (ok bool) {
+	if _, ok = filter[field]; ok {
+		return true
+	}
+
+	for _, groups := range [...][]M{or, and} {
+		for _, group := range groups {
+			if _, ok = group[field]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
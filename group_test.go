@@ -0,0 +1,251 @@
+package query
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest
+func TestGroupKey(t *testing.T) {
+	valid := map[string]struct {
+		index int
+		inner string
+	}{
+		"__or[0][status]":         {0, "status"},
+		"__or[12][age__gte]":      {12, "age__gte"},
+		"__or[1][user][city]":     {1, "user[city]"},
+		"__or[1][tags][]":         {1, "tags[]"},
+		"__or[007][a__exists]":    {7, "a__exists"},
+		"__or[3][user][city]__in": {3, "user[city]__in"},
+	}
+
+	for key, expected := range valid {
+		index, inner, err := groupKey(key, orParam)
+		assert.NoError(t, err, key)
+		assert.Equal(t, expected.index, index, key)
+		assert.Equal(t, expected.inner, inner, key)
+	}
+
+	invalid := []string{
+		"__or", "__or[]", "__or[x][a]", "__or[-1][a]", "__or[+1][a]",
+		"__or[0]", "__or[0][]", "__or[0]a", "__or[0", "__or0[a]",
+		"__or[99999999999999999999][a]",
+	}
+
+	for _, key := range invalid {
+		_, _, err := groupKey(key, orParam)
+		assert.True(t, errors.Is(err, ErrBadGroup), key)
+		assert.Contains(t, err.Error(), key)
+	}
+}
+
+func TestParserParseOr(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"status":   Field{Converter: String()},
+			"assignee": Field{Converter: String()},
+			"age":      Field{Converter: Int()},
+			"tenant":   Field{Converter: String(), Required: true},
+		},
+		ValidateFields: true,
+	}
+
+	ts.Run("groups", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"tenant":                    []string{"acme"},
+			"__or[0][status]":           []string{"open"},
+			"__or[0][assignee__exists]": []string{"false"},
+			"__or[1][assignee]":         []string{"me"},
+			"__or[2][age__gte]":         []string{"18"},
+			"__or[2][age__lt]":          []string{"65"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"tenant": "acme",
+			"$or": []M{
+				{"status": "open", "assignee": M{"$exists": false}},
+				{"assignee": "me"},
+				{"age": M{"$gte": int64(18), "$lt": int64(65)}},
+			},
+		}, q.Filter)
+
+		c := q.Clone()
+		c.Filter["$or"].([]M)[0]["status"] = "closed"
+		assert.Equal(t, "open", q.Filter["$or"].([]M)[0]["status"])
+	})
+
+	ts.Run("groups without fields specifications", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+		q, err := p.Parse(url.Values{
+			"__or[0][status]":  []string{"active"},
+			"__or[0][age__gt]": []string{"30"},
+			"__or[1][vip]":     []string{"true"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"$or": []M{
+			{"status": "active", "age": M{"$gt": int64(30)}},
+			{"vip": true},
+		}}, q.Filter)
+	})
+
+	ts.Run("groups are ordered by index", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"tenant":           []string{"acme"},
+			"__or[10][status]": []string{"b"},
+			"__or[2][status]":  []string{"a"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []M{{"status": "a"}, {"status": "b"}},
+			q.Filter["$or"])
+	})
+
+	ts.Run("required field in every group", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"__or[0][tenant]": []string{"a"},
+			"__or[1][tenant]": []string{"b"},
+		})
+		assert.NoError(t, err)
+
+		_, err = p.Parse(url.Values{
+			"__or[0][tenant]": []string{"a"},
+			"__or[1][status]": []string{"b"},
+		})
+		assert.True(t, errors.Is(err, ErrMissingField))
+	})
+
+	ts.Run("validation inside groups", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"tenant":           []string{"acme"},
+			"__or[0][unknown]": []string{"x"},
+			"__or[1][age]":     []string{"old"},
+		})
+		assert.True(t, errors.Is(err, ErrNoFieldSpec))
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+		assert.Contains(t, err.Error(), "or[0]")
+		assert.Contains(t, err.Error(), "or[1]")
+	})
+
+	ts.Run("malformed groups", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"tenant":          []string{"acme"},
+			"__or[x][status]": []string{"open"},
+			"__or":            []string{"open"},
+		})
+		assert.True(t, errors.Is(err, ErrBadGroup))
+		assert.Contains(t, err.Error(), `"__or[x][status]"`)
+		assert.Contains(t, err.Error(), `"__or"`)
+	})
+
+	ts.Run("budget is shared with groups", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.MaxValues = 2
+
+		_, err := p.Parse(url.Values{
+			"tenant":          []string{"acme"},
+			"__or[0][status]": []string{"a,b"},
+			"__or[1][status]": []string{"c"},
+		})
+		assert.True(t, errors.Is(err, ErrQueryTooLarge))
+	})
+}
+
+func TestParserParseAnd(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"tags":   Field{Converter: String()},
+			"status": Field{Converter: String()},
+			"tenant": Field{Converter: String(), Required: true},
+		},
+		ValidateFields: true,
+	}
+
+	ts.Run("groups", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"tenant":              []string{"acme"},
+			"__and[0][tags__in]":  []string{"a,b"},
+			"__and[1][tags__in]":  []string{"c,d"},
+			"__or[0][status]":     []string{"open"},
+			"__or[1][status__ne]": []string{"closed"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"tenant": "acme",
+			"$and": []M{
+				{"tags": M{"$in": []interface{}{"a", "b"}}},
+				{"tags": M{"$in": []interface{}{"c", "d"}}},
+			},
+			"$or": []M{
+				{"status": "open"},
+				{"status": M{"$ne": "closed"}},
+			},
+		}, q.Filter)
+	})
+
+	ts.Run("required field in any group", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"__and[0][tenant]": []string{"acme"},
+			"__and[1][status]": []string{"open"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"$and": []M{
+			{"tenant": "acme"},
+			{"status": "open"},
+		}}, q.Filter)
+	})
+
+	ts.Run("validation inside groups", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"tenant":            []string{"acme"},
+			"__and[2][unknown]": []string{"x"},
+			"__and[x][tags]":    []string{"a"},
+		})
+		assert.True(t, errors.Is(err, ErrNoFieldSpec))
+		assert.True(t, errors.Is(err, ErrBadGroup))
+		assert.Contains(t, err.Error(), "and[2]")
+		assert.Contains(t, err.Error(), `"__and[x][tags]"`)
+	})
+
+	ts.Run("strict directives", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.StrictDirectives = true
+
+		_, err := p.Parse(url.Values{
+			"tenant":           []string{"acme"},
+			"__and[0][status]": []string{"open"},
+		})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,155 @@
+package query
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// RegexValue is an optional interface of the regular expressions made by
+// Primitives.RegEx. The regular expressions are marshaled to JSON as
+// {"$regex": pattern, "$options": options}. The values with the Pattern
+// and Options string fields, i.e. primitive.Regex, need not implement it.
+type RegexValue interface {
+	// RegexPattern returns the pattern and the options of a regular
+	// expression.
+	RegexPattern() (pattern, options string)
+}
+
+// jsonQuery is a canonical form of a Query.
+type jsonQuery struct {
+	Filter     interface{}    `json:"filter,omitempty"`
+	Sort       []interface{}  `json:"sort,omitempty"`
+	Limit      int64          `json:"limit,omitempty"`
+	Skip       int64          `json:"skip,omitempty"`
+	Projection map[string]int `json:"projection,omitempty"`
+	Page       int64          `json:"page,omitempty"`
+	CountOnly  bool           `json:"count,omitempty"`
+}
+
+// MarshalJSON encodes a query as a JSON object with the filter, sort,
+// limit, skip, projection, page and count fields. The keys of the documents
+// are sorted, the sort order is kept, the time values are RFC3339 strings
+// and the regular expressions are {"$regex": ..., "$options": ...}
+// documents.
+func (f Query) MarshalJSON() (data []byte, err error) {
+	q := jsonQuery{
+		Limit: f.Limit, Skip: f.Skip, Projection: f.Projection, Page: f.Page,
+		CountOnly: f.CountOnly,
+	}
+
+	if f.Filter != nil {
+		q.Filter = canonicalValue(f.Filter)
+	}
+
+	if s := reflect.ValueOf(f.Sort); s.Kind() == reflect.Slice {
+		q.Sort = make([]interface{}, s.Len())
+		for i := range q.Sort {
+			q.Sort[i] = canonicalSort(s.Index(i))
+		}
+	}
+
+	return json.Marshal(q)
+}
+
+// String returns the JSON form of a query for logs.
+func (f Query) String() (s string) {
+	data, err := f.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%+v", jsonQuery{
+			Filter: f.Filter, Limit: f.Limit, Skip: f.Skip,
+			Projection: f.Projection, Page: f.Page, CountOnly: f.CountOnly,
+		})
+	}
+
+	return string(data)
+}
+
+// CacheKey returns a hash of the canonical form of a query, so the same
+// query parsed from the differently ordered parameters has the same key.
+func (f Query) CacheKey() (key string) {
+	sum := sha256.Sum256([]byte(f.String()))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalSort converts an element of the Sort document to a single key
+// document, i.e. bson.E{Key: "age", Value: -1} to {"age": -1}.
+func canonicalSort(de reflect.Value) (elem interface{}) {
+	key, ok := sortKey(de)
+	if !ok {
+		return canonicalValue(de.Interface())
+	}
+
+	for de.Kind() == reflect.Interface || de.Kind() == reflect.Ptr {
+		de = de.Elem()
+	}
+
+	var val interface{}
+
+	switch de.Kind() {
+	case reflect.Struct:
+		if de.NumField() > 1 && de.Field(1).CanInterface() {
+			val = de.Field(1).Interface()
+		}
+	case reflect.Map:
+		val = de.MapIndex(de.MapKeys()[0]).Interface()
+	}
+
+	return M{key: canonicalValue(val)}
+}
+
+// canonicalValue converts the documents and the arrays of a filter
+// recursively, the time values to RFC3339 and the regular expressions to
+// {"$regex": ..., "$options": ...}.
+func canonicalValue(val interface{}) (canonical interface{}) {
+	switch v := val.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case RegexValue:
+		pattern, options := v.RegexPattern()
+
+		return M{"$regex": pattern, "$options": options}
+	case json.Marshaler:
+		return v
+	}
+
+	rv := reflect.ValueOf(val)
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return val
+		}
+
+		m := make(M, rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			m[iter.Key().String()] = canonicalValue(iter.Value().Interface())
+		}
+
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return val
+		}
+
+		arr := make([]interface{}, rv.Len())
+		for i := range arr {
+			arr[i] = canonicalValue(rv.Index(i).Interface())
+		}
+
+		return arr
+	case reflect.Struct:
+		pattern := rv.FieldByName("Pattern")
+		options := rv.FieldByName("Options")
+
+		if pattern.Kind() == reflect.String && options.Kind() == reflect.String {
+			return M{"$regex": pattern.String(), "$options": options.String()}
+		}
+	}
+
+	return val
+}
@@ -0,0 +1,91 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (r testRegEx) RegexPattern() (pattern, options string) {
+	return r.regex, r.options
+}
+
+type testPrimitiveRegex struct {
+	Pattern string
+	Options string
+}
+
+type testSortElem struct {
+	Key   string
+	Value interface{}
+}
+
+//nolint:paralleltest
+func TestQueryMarshalJSON(t *testing.T) {
+	q := Query{
+		Filter: M{
+			"name":    M{"$eq": testRegEx{regex: "^jo", options: "i"}},
+			"created": M{"$gte": time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)},
+			"tags":    M{"$in": []interface{}{"b", "a"}},
+			"$or": []M{
+				{"code": testPrimitiveRegex{Pattern: "x", Options: ""}},
+			},
+		},
+		Sort:       []testSortElem{{Key: "z", Value: -1}, {Key: "a", Value: 1}},
+		Limit:      10,
+		Projection: map[string]int{"name": 1},
+	}
+
+	data, err := q.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"filter": {
+			"$or": [{"code": {"$regex": "x", "$options": ""}}],
+			"created": {"$gte": "2021-01-02T03:04:05Z"},
+			"name": {"$eq": {"$regex": "^jo", "$options": "i"}},
+			"tags": {"$in": ["b", "a"]}
+		},
+		"sort": [{"z": -1}, {"a": 1}],
+		"limit": 10,
+		"projection": {"name": 1}
+	}`, string(data))
+
+	assert.Equal(t, `{"filter":{"$or":[{"code":{"$options":"","$regex":"x"}}],`+
+		`"created":{"$gte":"2021-01-02T03:04:05Z"},`+
+		`"name":{"$eq":{"$options":"i","$regex":"^jo"}},`+
+		`"tags":{"$in":["b","a"]}},"sort":[{"z":-1},{"a":1}],"limit":10,`+
+		`"projection":{"name":1}}`, q.String())
+
+	assert.Equal(t, "{}", Query{}.String())
+}
+
+//nolint:paralleltest
+func TestQueryCacheKey(t *testing.T) {
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	queries := []string{
+		"name__ire=^jo&age__gte=18&age__lt=65&__sort=-age,name&__limit=5",
+		"__limit=5&age__lt=65&__sort=-age,name&name__ire=^jo&age__gte=18",
+		"age__gte=18&__limit=5&name__ire=^jo&__sort=-age,name&age__lt=65",
+	}
+
+	keys := make(map[string]struct{})
+
+	for _, raw := range queries {
+		q, err := p.ParseString(raw)
+		assert.NoError(t, err)
+
+		keys[q.CacheKey()] = struct{}{}
+	}
+
+	assert.Len(t, keys, 1)
+
+	q, err := p.Parse(url.Values{"__sort": []string{"name,-age"}})
+	assert.NoError(t, err)
+
+	_, sameKey := keys[q.CacheKey()]
+	assert.False(t, sameKey)
+	assert.Len(t, q.CacheKey(), 64)
+}
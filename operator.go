@@ -1,12 +1,16 @@
 package query
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type operator string
 
 // list of allowed operators.
 const (
 	ignoreCasePrefix = "i"
+	negatedPrefix    = "n"
 	mongoOpPrefix    = "$"
 
 	operatorIn                  operator = "in"
@@ -20,6 +24,37 @@ const (
 	operatorLessThanOrEquals    operator = "lte"
 	operatorNotEquals           operator = "ne"
 	operatorNotIn                        = "n" + operatorIn
+	operatorNull                operator = "null"
+	operatorRange               operator = "range"
+	operatorBetween             operator = "between"
+	operatorDateBetween         operator = "datebetween"
+	operatorSize                operator = "size"
+	operatorType                operator = "type"
+	operatorNear                operator = "near"
+	operatorNearSphere          operator = "nearsphere"
+	operatorGeoWithin           operator = "geowithin"
+	operatorWithin              operator = "within"
+	operatorMod                 operator = "mod"
+	operatorBitsAllClear        operator = "ballclear"
+	operatorBitsAllSet          operator = "ballset"
+	operatorBitsAnyClear        operator = "banyclear"
+	operatorBitsAnySet          operator = "banyset"
+
+	// operatorNot negates an operator expression. It is not available
+	// in queries as is, but as a modifier of another operator, i.e.
+	// "age__not__gt=30".
+	operatorNot operator = "not"
+	// notModifier is a prefix of an operator negated by the modifier.
+	notModifier = operatorNot + delimiter
+	// operatorElemMatch matches array elements with a document of
+	// conditions, i.e. "items__elem[price__gt]=10". It is not a suffix of
+	// a query key, so it is not listed in allOperators.
+	operatorElemMatch operator = "elem"
+
+	operatorEqualsIgnoreCase        = ignoreCasePrefix + operatorEquals
+	operatorEqualsInIgnoreCase      = operatorEqualsIgnoreCase + operatorIn
+	operatorEqualsInArrayIgnoreCase = operatorEqualsIgnoreCase +
+		operatorInArray
 
 	operatorAll operator = "all"
 
@@ -55,43 +90,140 @@ const (
 
 	allOperators = delimiter + operatorAll +
 		delimiter + operatorAllArray +
+		delimiter + operatorBetween +
+		delimiter + operatorBitsAllClear +
+		delimiter + operatorBitsAllSet +
+		delimiter + operatorBitsAnyClear +
+		delimiter + operatorBitsAnySet +
 		delimiter + operatorContains +
 		delimiter + operatorContainsIgnoreCase +
 		delimiter + operatorContainsIn +
 		delimiter + operatorContainsInArray +
 		delimiter + operatorContainsInArrayIgnoreCase +
 		delimiter + operatorContainsInIgnoreCase +
+		delimiter + operatorDateBetween +
 		delimiter + operatorEqualArray +
 		delimiter + operatorEquals +
 		delimiter + operatorExists +
+		delimiter + operatorGeoWithin +
+		delimiter + operatorEqualsIgnoreCase +
+		delimiter + operatorEqualsInArrayIgnoreCase +
+		delimiter + operatorEqualsInIgnoreCase +
 		delimiter + operatorGreaterThan +
 		delimiter + operatorGreaterThanOrEquals +
 		delimiter + operatorIn +
 		delimiter + operatorInArray +
 		delimiter + operatorLessThan +
 		delimiter + operatorLessThanOrEquals +
+		delimiter + operatorMod +
 		delimiter + operatorNotEquals +
+		delimiter + operatorNear +
+		delimiter + operatorNearSphere +
 		delimiter + operatorNotIn +
+		delimiter + operatorNull +
+		delimiter + operatorRange +
 		delimiter + operatorRegex +
 		delimiter + operatorRegexIgnoreCase +
 		delimiter + operatorRegexIn +
 		delimiter + operatorRegexInArray +
 		delimiter + operatorRegexInArrayIgnoreCase +
 		delimiter + operatorRegexInIgnoreCase +
+		delimiter + operatorSize +
 		delimiter + operatorStartsWith +
 		delimiter + operatorStartsWithIgnoreCase +
 		delimiter + operatorStartsWithIn +
 		delimiter + operatorStartsWithInArray +
 		delimiter + operatorStartsWithInArrayIgnoreCase +
 		delimiter + operatorStartsWithInIgnoreCase +
+		delimiter + operatorType +
+		delimiter + operatorWithin +
 		delimiter
 )
 
+// Operator is a query operator, i.e. "gte" of "age__gte=18". It is used to
+// add conditions with Query.AddFilter. An Operator is one of the Op* values
+// or is returned by ParseOp, so it is always valid. The zero Operator is
+// OpEquals.
+type Operator struct {
+	op operator
+}
+
+// Operators of the conditions that are added with Query.AddFilter, other
+// operators are given with ParseOp.
+var (
+	OpEquals              = Operator{operatorEquals}
+	OpNotEquals           = Operator{operatorNotEquals}
+	OpGreaterThan         = Operator{operatorGreaterThan}
+	OpGreaterThanOrEquals = Operator{operatorGreaterThanOrEquals}
+	OpLessThan            = Operator{operatorLessThan}
+	OpLessThanOrEquals    = Operator{operatorLessThanOrEquals}
+	OpIn                  = Operator{operatorIn}
+	OpNotIn               = Operator{operatorNotIn}
+	OpAll                 = Operator{operatorAll}
+	OpEqualArray          = Operator{operatorEqualArray}
+	OpExists              = Operator{operatorExists}
+	OpSize                = Operator{operatorSize}
+	OpType                = Operator{operatorType}
+)
+
+// ParseOp converts a query operator suffix, i.e. "gte" or "IN", to
+// an Operator. Unknown operators are reported with ErrUnknownOperator, as
+// are the range and the null operators, whose conditions are built by
+// the parser from the query values.
+func ParseOp(s string) (op Operator, err error) {
+	o := foldOperator(s).resolveNot()
+	inner, _ := o.operand()
+
+	if !o.IsValid() || inner.IsRange() || inner == operatorNull {
+		return op, fmt.Errorf("%w: %q", ErrUnknownOperator, s)
+	}
+
+	return Operator{o}, nil
+}
+
+// String returns the operator as it is written in a query, i.e. "gte".
+func (o Operator) String() (s string) { return o.operator().String() }
+
+// MongoOperator returns the mongo operator of the condition, i.e. "$gte".
+func (o Operator) MongoOperator() (mongoOp string) {
+	return o.operator().MongoOperator()
+}
+
+// operator returns the parsed operator, "eq" for the zero Operator.
+func (o Operator) operator() (op operator) {
+	if len(o.op) == 0 {
+		return operatorEquals
+	}
+
+	return o.op
+}
+
+// foldOperator converts an operator suffix to the lower case. Operators are
+// a fixed ASCII vocabulary, so "GTE" or "iRe" are folded to "gte" and "ire",
+// while non-ASCII letters are left untouched and stay invalid.
+func foldOperator(s string) (op operator) {
+	pos := strings.IndexFunc(s, func(r rune) bool {
+		return 'A' <= r && r <= 'Z'
+	})
+	if pos < 0 {
+		return operator(s)
+	}
+
+	b := []byte(s)
+	for i := pos; i < len(b); i++ {
+		if 'A' <= b[i] && b[i] <= 'Z' {
+			b[i] += 'a' - 'A'
+		}
+	}
+
+	return operator(b)
+}
+
 func parseOperator(fieldName string) (field string, op operator) {
 	field, op = fieldName, operatorEquals
 
 	if pos := strings.Index(field, delimiter); pos > 0 {
-		op = operator(field[pos+len(delimiter):])
+		op = foldOperator(field[pos+len(delimiter):])
 		field = field[:pos]
 	} else if pos < 0 &&
 		strings.HasSuffix(field, string(operatorInArray)) {
@@ -104,29 +236,176 @@ func parseOperator(fieldName string) (field string, op operator) {
 
 func (o operator) String() (s string) { return string(o.CommonOperator()) }
 
-// IsValid checks if an operator is in the list of the valid operators.
+// IsValid checks if an operator is in the list of the valid operators, is
+// a negated pattern operator or is a valid operator negated by the modifier.
 func (o operator) IsValid() (ok bool) {
+	if inner, negated := o.operand(); negated {
+		return inner.isNegatable()
+	}
+
+	if len(o) == 0 || strings.Contains(string(o), delimiter) {
+		return false
+	}
+
+	return o.isListed() || o.IsNegated()
+}
+
+func (o operator) isListed() (ok bool) {
 	//nolint:gocritic
 	// This is correct arguments order
-	return strings.Contains(string(allOperators), string(o))
+	return strings.Contains(string(allOperators),
+		delimiter+string(o)+delimiter)
+}
+
+// positive returns a pattern operator negated by an operator, i.e. "co"
+// for "nco" and "ico[]" for "inco[]". Other operators are returned as is.
+func (o operator) positive() (op operator, negated bool) {
+	s := strings.TrimPrefix(string(o), ignoreCasePrefix)
+	if !strings.HasPrefix(s, negatedPrefix) ||
+		strings.HasPrefix(s[len(negatedPrefix):], ignoreCasePrefix) {
+		return o, false
+	}
+
+	op = o[:len(o)-len(s)] + operator(s[len(negatedPrefix):])
+	if !op.isListed() || !(op.Is(operatorRegex) ||
+		op.Is(operatorContains) || op.Is(operatorStartsWith)) {
+		return o, false
+	}
+
+	return op, true
+}
+
+// IsNegated checks if an operator is a negated pattern operator, i.e.
+// "nco", "inre" or "nswin".
+func (o operator) IsNegated() (ok bool) {
+	_, ok = o.positive()
+
+	return ok
+}
+
+// operand returns an operator negated by the modifier, i.e. "gt" for
+// "not__gt".
+func (o operator) operand() (op operator, negated bool) {
+	if !strings.HasPrefix(string(o), string(notModifier)) {
+		return o, false
+	}
+
+	return o[len(notModifier):], true
+}
+
+// isNegatable checks if an operator can be negated by the modifier. The
+// null and geospatial operators can not be negated, while the operators
+// that collapse to a single value one are replaced by resolveNot.
+func (o operator) isNegatable() (ok bool) {
+	if _, negated := o.operand(); negated || !o.IsValid() {
+		return false
+	}
+
+	return o != operatorNull && !o.IsGeo() &&
+		!(o.IsMultiVal() && !o.IsArrayOperator())
+}
+
+// resolveNot replaces an operator negated by the modifier with
+// the built-in negated operator when there is one, i.e. "not__re" with
+// "nre", "not__in" with "nin" and "not__eq" with "ne". Other operators
+// keep the modifier and their conditions are wrapped with $not.
+func (o operator) resolveNot() (op operator) {
+	inner, negated := o.operand()
+	if !negated {
+		return o
+	}
+
+	if positive, isNegated := inner.positive(); isNegated {
+		return positive
+	}
+
+	switch inner {
+	case operatorEquals:
+		return operatorNotEquals
+	case operatorNotEquals:
+		return operatorEquals
+	case operatorIn:
+		return operatorNotIn
+	case operatorNotIn:
+		return operatorIn
+	}
+
+	if inner.IsPattern() {
+		s := strings.TrimPrefix(string(inner), ignoreCasePrefix)
+		op = inner[:len(inner)-len(s)] + negatedPrefix + operator(s)
+
+		if op.IsNegated() {
+			return op
+		}
+	}
+
+	return o
 }
 
 // IsMultiVal checks if an operator accepts multiple values.
 func (o operator) IsMultiVal() (ok bool) {
-	return o.Is(operatorIn) ||
+	return !o.IsGeo() && o.Is(operatorIn) ||
 		o.Is(operatorAll) ||
-		o == operatorEqualArray
+		o == operatorEqualArray ||
+		o.IsArguments()
+}
+
+// IsArguments checks if the values of an operator are the arguments of
+// a single condition, i.e. "mod" with "4,1" or the bitwise operators, so
+// they are split but never merged with other values.
+func (o operator) IsArguments() (ok bool) {
+	return o == operatorMod || o.IsBitwise()
+}
+
+// IsBitwise checks if an operator is a bitwise one, i.e. "banyset".
+func (o operator) IsBitwise() (ok bool) {
+	switch o {
+	case operatorBitsAllClear, operatorBitsAllSet,
+		operatorBitsAnyClear, operatorBitsAnySet:
+		return true
+	}
+
+	return false
 }
 
-// NeedSplitString checks if an operator is multival and needs to split
-// a string value into a slice.
+// IsGeo checks if an operator is a geospatial one, i.e. "near". Its value
+// is a single string of coordinates that is never split, so "geowithin"
+// and "within" are not multi-value operators despite the "in" suffix.
+func (o operator) IsGeo() (ok bool) {
+	return o == operatorNear || o == operatorNearSphere ||
+		o == operatorGeoWithin || o == operatorWithin
+}
+
+// IsArrayOperator checks if an operator has array semantics, so it keeps
+// an array value even when a single value is given, i.e. "all".
+func (o operator) IsArrayOperator() (ok bool) {
+	return o.Is(operatorAll) || o.IsArguments()
+}
+
+// NeedSplitString checks if an operator is multival or the range operator
+// and needs to split a string value into a slice.
 func (o operator) NeedSplitString() (ok bool) {
-	return o.IsMultiVal() && !o.Is(operatorInArray)
+	if inner, negated := o.operand(); negated {
+		return inner.NeedSplitString()
+	}
+
+	return o.IsMultiVal() && !o.Is(operatorInArray) || o.IsRange()
+}
+
+// IsRange checks if a value of an operator is a range of the "gte" and
+// the "lte" bounds, i.e. "range" or "between".
+func (o operator) IsRange() (ok bool) {
+	return o == operatorRange || o == operatorBetween ||
+		o == operatorDateBetween
 }
 
 // SingleValueOperator returns a single value operator.
 func (o operator) SingleValueOperator() (op operator) {
 	commonOp := o.CommonOperator()
+	if commonOp == operatorNotIn {
+		return operatorNotEquals
+	}
+
 	if commonOp == operatorIn ||
 		commonOp == operatorAll ||
 		commonOp == operatorEquals {
@@ -162,6 +441,10 @@ func (o operator) Is(op operator) (ok bool) {
 }
 
 func (o operator) CommonOperator() (op operator) {
+	if inner, negated := o.operand(); negated {
+		return notModifier + inner.CommonOperator()
+	}
+
 	if !o.Is(operatorInArray) {
 		return o
 	}
@@ -174,46 +457,159 @@ func (o operator) CommonOperator() (op operator) {
 		string(operatorInArray))) + operatorIn
 }
 
+// IsComparison checks if an operator compares a field with a single value
+// and thus is meaningless with an empty value, i.e. "gt" or "ne".
+func (o operator) IsComparison() (ok bool) {
+	switch o {
+	case operatorGreaterThan, operatorGreaterThanOrEquals,
+		operatorLessThan, operatorLessThanOrEquals, operatorNotEquals:
+		return true
+	}
+
+	return false
+}
+
+// IsBool checks if an operator always takes a boolean value regardless of
+// the field type, i.e. "exists" or "null".
+func (o operator) IsBool() (ok bool) {
+	return o == operatorExists || o == operatorNull
+}
+
+// bound is a single condition of a range.
+type bound struct {
+	op    operator
+	value interface{}
+}
+
+// valueRange is a converted value of the range operators. It holds
+// the "gte" bound, the "lte" bound or both of them.
+type valueRange []bound
+
+// nullCondition converts a "null" condition to an equality with null for
+// true and to an inequality for false. Other conditions are returned as is.
+func nullCondition(o operator, value interface{}) (
+	op operator, val interface{}) {
+	if o != operatorNull {
+		return o, value
+	}
+
+	if isNull, _ := value.(bool); isNull {
+		return operatorEquals, nil
+	}
+
+	return operatorNotEquals, nil
+}
+
 // IsRegex checks if an operator is a RegEx operator, i.e. "re", "ire",
 // "rein" and "irein".
 func (o operator) IsRegex() (ok bool) {
-	return o.Is(operatorRegex)
+	op, _ := o.positive()
+
+	return op.Is(operatorRegex)
 }
 
 // IsStartsWith checks if an operator checks for the beginning of
 // a string.
 func (o operator) IsStartsWith() (ok bool) {
-	return o.Is(operatorStartsWith)
+	op, _ := o.positive()
+
+	return op.Is(operatorStartsWith)
 }
 
 // IsContains checks if an operator checks for the content of a string.
 func (o operator) IsContains() (ok bool) {
-	return o.Is(operatorContains)
+	op, _ := o.positive()
+
+	return op.Is(operatorContains)
+}
+
+// IsEqualFold checks if an operator is a case insensitive equality, i.e.
+// "ieq", "ieqin" and "ieq[]".
+func (o operator) IsEqualFold() (ok bool) {
+	return o.Is(operatorEqualsIgnoreCase)
+}
+
+// IsPattern checks if an operator builds a regular expression, i.e. "re",
+// "co" or "sw" and their variants including the negated ones.
+func (o operator) IsPattern() (ok bool) {
+	return o.IsRegex() || o.IsContains() || o.IsStartsWith()
 }
 
 // IsIgnoreCaseOperator checks if an operator has the Ignore Case flag.
 func (o operator) IsIgnoreCaseOperator() (ok bool) {
+	o, _ = o.positive()
+	o = o.CommonOperator()
+
 	return o == operatorContainsInIgnoreCase ||
 		o == operatorContainsIgnoreCase ||
+		o == operatorEqualsIgnoreCase ||
+		o == operatorEqualsInIgnoreCase ||
 		o == operatorRegexIgnoreCase ||
 		o == operatorRegexInIgnoreCase ||
 		o == operatorStartsWithIgnoreCase ||
 		o == operatorStartsWithInIgnoreCase
 }
 
+// simpleMongoOperators maps the most common operators to mongo operators
+// without the classification and the string concatenation overhead.
+var simpleMongoOperators = map[operator]string{
+	operatorEquals:              mongoOpPrefix + string(operatorEquals),
+	operatorExists:              mongoOpPrefix + string(operatorExists),
+	operatorGreaterThan:         mongoOpPrefix + string(operatorGreaterThan),
+	operatorGreaterThanOrEquals: mongoOpPrefix + string(operatorGreaterThanOrEquals),
+	operatorIn:                  mongoOpPrefix + string(operatorIn),
+	operatorLessThan:            mongoOpPrefix + string(operatorLessThan),
+	operatorLessThanOrEquals:    mongoOpPrefix + string(operatorLessThanOrEquals),
+	operatorNotEquals:           mongoOpPrefix + string(operatorNotEquals),
+	operatorNotIn:               mongoOpPrefix + string(operatorNotIn),
+	operatorMod:                 mongoOpPrefix + string(operatorMod),
+	operatorBitsAllClear:        mongoOpPrefix + "bitsAllClear",
+	operatorBitsAllSet:          mongoOpPrefix + "bitsAllSet",
+	operatorBitsAnyClear:        mongoOpPrefix + "bitsAnyClear",
+	operatorBitsAnySet:          mongoOpPrefix + "bitsAnySet",
+}
+
 // MongoOperator converts an operator to the mongo operator.
 func (o operator) MongoOperator() (mongoOp string) {
+	if mongoOp, ok := simpleMongoOperators[o]; ok {
+		return mongoOp
+	}
+
+	if _, negated := o.operand(); negated {
+		return operatorNot.MongoOperator()
+	}
+
+	if o.IsNegated() {
+		if o.IsMultiVal() {
+			return operatorNotIn.MongoOperator()
+		}
+
+		return operatorNot.MongoOperator()
+	}
+
 	if o == operatorAllArray {
 		return operatorAll.MongoOperator()
 	}
 
+	if o == operatorElemMatch {
+		return mongoOpPrefix + "elemMatch"
+	}
+
+	if o == operatorGeoWithin || o == operatorWithin {
+		return mongoOpPrefix + "geoWithin"
+	}
+
+	if o == operatorNearSphere {
+		return mongoOpPrefix + "nearSphere"
+	}
+
 	if o.IsMultiVal() && o != operatorAll && o != operatorEqualArray &&
 		o != operatorNotIn {
 		return mongoOpPrefix + string(operatorIn)
 	}
 
 	if o == operatorEqualArray || o.IsContains() ||
-		o.IsRegex() || o.IsStartsWith() {
+		o.IsRegex() || o.IsStartsWith() || o.IsEqualFold() {
 		return mongoOpPrefix + string(operatorEquals)
 	}
 
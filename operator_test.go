@@ -10,7 +10,10 @@ import (
 //nolint:paralleltest
 func TestOperatorValidation(t *testing.T) {
 	validOperators := []string{"all", "exists", "irein", "coin", "co"}
-	invalidOperators := []string{"call", "nexists", "reini", "icon"}
+	invalidOperators := []string{
+		"call", "nexists", "reini", "icon",
+		"", "e", "t", "q", "n", "_", "__", "gt__lt", "__gte",
+	}
 
 	for _, valid := range validOperators {
 		assert.True(t, operator(valid).IsValid())
@@ -25,16 +28,19 @@ func TestOperatorValidation(t *testing.T) {
 func TestOperatorMultiVal(t *testing.T) {
 	multiValOperators := []string{
 		"all", "eqa", "nin", "in", "rein",
-		"icoin", "[]", "ire[]", "sw[]",
+		"icoin", "[]", "ire[]", "sw[]", "mod", "banyset",
+	}
+	nonMultiValOperators := []string{
+		"eq", "exists", "gt", "lte", "ne", "size", "type",
+		"near", "nearsphere", "geowithin", "within",
 	}
-	nonMultiValOperators := []string{"eq", "exists", "gt", "lte", "ne"}
 
 	for _, op := range multiValOperators {
 		assert.True(t, operator(op).IsValid())
 		assert.True(t, operator(op).IsMultiVal(),
 			"operator: %v", op)
 		assert.Equal(t, strings.HasSuffix(op, "in") ||
-			op == "all" || op == "eqa",
+			op == "all" || op == "eqa" || operator(op).IsArguments(),
 			operator(op).NeedSplitString(),
 			"operator %s needs string splitting: %v",
 			op, !operator(op).NeedSplitString())
@@ -103,6 +109,43 @@ func TestOperatorIs(ts *testing.T) {
 	})
 }
 
+//nolint:paralleltest
+func TestOperatorArray(t *testing.T) {
+	for _, op := range []string{"all", "all[]"} {
+		assert.True(t, operator(op).IsArrayOperator(), "operator: %s", op)
+	}
+
+	for _, op := range []string{"in", "[]", "eqa", "nin", "rein", "eq"} {
+		assert.False(t, operator(op).IsArrayOperator(), "operator: %s", op)
+	}
+}
+
+//nolint:paralleltest
+func TestOperatorBool(t *testing.T) {
+	assert.True(t, operatorExists.IsBool())
+	assert.True(t, operatorNull.IsBool())
+	assert.True(t, operatorNull.IsValid())
+
+	for _, op := range []string{"eq", "in", "ne", "re", "all"} {
+		assert.False(t, operator(op).IsBool(), "operator: %s", op)
+	}
+}
+
+//nolint:paralleltest
+func TestNullCondition(t *testing.T) {
+	op, val := nullCondition(operatorNull, true)
+	assert.Equal(t, operatorEquals, op)
+	assert.Nil(t, val)
+
+	op, val = nullCondition(operatorNull, false)
+	assert.Equal(t, operatorNotEquals, op)
+	assert.Nil(t, val)
+
+	op, val = nullCondition(operatorExists, true)
+	assert.Equal(t, operatorExists, op)
+	assert.Equal(t, true, val)
+}
+
 //nolint:paralleltest
 func TestOperatorRegex(t *testing.T) {
 	regexOps := []string{"re", "ire", "rein", "irein"}
@@ -155,9 +198,119 @@ func TestOperatorContains(t *testing.T) {
 	}
 }
 
+//nolint:paralleltest
+func TestOperatorPattern(t *testing.T) {
+	patternOps := []string{"re", "ire[]", "co", "icoin", "sw", "sw[]"}
+	nonPatternOps := []string{
+		"all", "eq", "in", "nin", "gte", "exists", "size", "type", "ieq",
+	}
+
+	for _, op := range patternOps {
+		assert.True(t, operator(op).IsValid())
+		assert.True(t, operator(op).IsPattern())
+	}
+
+	for _, op := range nonPatternOps {
+		assert.True(t, operator(op).IsValid())
+		assert.False(t, operator(op).IsPattern())
+	}
+}
+
+//nolint:paralleltest
+func TestOperatorNegated(t *testing.T) {
+	negated := map[string]string{
+		"nre":    "$not",
+		"inre":   "$not",
+		"nco":    "$not",
+		"inco":   "$not",
+		"nsw":    "$not",
+		"insw":   "$not",
+		"nrein":  "$nin",
+		"inrein": "$nin",
+		"ncoin":  "$nin",
+		"nco[]":  "$nin",
+		"inco[]": "$nin",
+		"nswin":  "$nin",
+		"insw[]": "$nin",
+	}
+
+	for op, mOp := range negated {
+		assert.True(t, operator(op).IsValid(), op)
+		assert.True(t, operator(op).IsNegated(), op)
+		assert.True(t, operator(op).IsPattern(), op)
+		assert.Equal(t, mOp == "$nin", operator(op).IsMultiVal(), op)
+		assert.Equal(t, mOp, operator(op).MongoOperator(), op)
+		assert.Equal(t, strings.HasPrefix(op, "i"),
+			operator(op).IsIgnoreCaseOperator(), op)
+	}
+
+	assert.True(t, operator("nco").IsContains())
+	assert.True(t, operator("insw").IsStartsWith())
+	assert.True(t, operator("nre[]").IsRegex())
+	assert.Equal(t, operator("nco"), operator("ncoin").SingleValueOperator())
+	assert.Equal(t, operator("incoin"), operator("inco[]").CommonOperator())
+
+	for _, op := range []string{"nin", "ne", "null", "nnco", "nico", "n", "in", "neq"} {
+		assert.False(t, operator(op).IsNegated(), op)
+		assert.False(t, operator(op).IsPattern(), op)
+	}
+
+	for _, op := range []string{"nnco", "nico", "n", "neq", "ngte"} {
+		assert.False(t, operator(op).IsValid(), op)
+	}
+}
+
+//nolint:paralleltest
+func TestOperatorNotModifier(t *testing.T) {
+	resolved := map[string]string{
+		"not__re":    "nre",
+		"not__ire":   "inre",
+		"not__coin":  "ncoin",
+		"not__isw[]": "insw[]",
+		"not__nre":   "re",
+		"not__inco":  "ico",
+		"not__eq":    "ne",
+		"not__ne":    "eq",
+		"not__in":    "nin",
+		"not__nin":   "in",
+		"not__gt":    "not__gt",
+		"not__all[]": "not__all[]",
+		"not__null":  "not__null",
+		"gte":        "gte",
+	}
+
+	for op, expected := range resolved {
+		assert.Equal(t, operator(expected), operator(op).resolveNot(), op)
+	}
+
+	for _, op := range []string{
+		"not__gt", "not__lte", "not__size", "not__type", "not__exists",
+		"not__all", "not__all[]", "not__range", "not__mod", "not__banyset",
+		"not__ieq",
+	} {
+		assert.True(t, operator(op).IsValid(), op)
+		assert.Equal(t, "$not", operator(op).MongoOperator(), op)
+	}
+
+	for _, op := range []string{
+		"not", "not__", "not__null", "not__near", "not__geowithin",
+		"not__ieqin", "not__eqa", "not__not__gt", "not__foo", "not__gt__lt",
+	} {
+		assert.False(t, operator(op).IsValid(), op)
+	}
+
+	assert.Equal(t, operator("not__all"), operator("not__all[]").CommonOperator())
+	assert.True(t, operator("not__all").NeedSplitString())
+	assert.False(t, operator("not__gt").NeedSplitString())
+	assert.False(t, operator("not__all").IsMultiVal())
+}
+
 //nolint:paralleltest
 func TestOperatorIgnoreCase(t *testing.T) {
-	icOps := []string{"ire", "irein", "ico", "icoin", "isw", "iswin"}
+	icOps := []string{
+		"ire", "irein", "ire[]", "ico", "icoin", "ico[]", "isw", "iswin", "isw[]",
+		"ieq", "ieqin", "ieq[]",
+	}
 	nonICOps := []string{"rein", "co", "all", "eqa", "nin", "in"}
 
 	for _, op := range icOps {
@@ -188,6 +341,21 @@ func TestOperatorMongoOp(t *testing.T) {
 		"co":    "$eq",
 		"icoin": "$in",
 		"isw":   "$eq",
+		"ieq":   "$eq",
+		"ieqin": "$in",
+		"ieq[]": "$in",
+		"size":  "$size",
+		"type":  "$type",
+		"near":  "$near",
+
+		"geowithin":  "$geoWithin",
+		"nearsphere": "$nearSphere",
+		"within":     "$geoWithin",
+		"mod":        "$mod",
+		"ballclear":  "$bitsAllClear",
+		"ballset":    "$bitsAllSet",
+		"banyclear":  "$bitsAnyClear",
+		"banyset":    "$bitsAnySet",
 	}
 
 	for op, mOp := range ops {
@@ -244,4 +412,63 @@ func TestParseOperator(t *testing.T) {
 	assert.True(t, op.IsRegex())
 	assert.False(t, op.IsStartsWith())
 	assert.False(t, op.IsContains())
+
+	assert.Equal(t, operatorNotEquals, operatorNotIn.SingleValueOperator())
+}
+
+//nolint:paralleltest
+func TestParseOperatorCase(t *testing.T) {
+	cases := map[string]operator{
+		"created__GTE":  operatorGreaterThanOrEquals,
+		"created__Gte":  operatorGreaterThanOrEquals,
+		"name__IRE":     operatorRegexIgnoreCase,
+		"name__iRe":     operatorRegexIgnoreCase,
+		"name__Re":      operatorRegex,
+		"name__IREIN":   operatorRegexInIgnoreCase,
+		"name__ReIn":    operatorRegexIn,
+		"name__ICOIN":   operatorContainsInIgnoreCase,
+		"name__CoIn":    operatorContainsIn,
+		"name__ISW":     operatorStartsWithIgnoreCase,
+		"name__IRE[]":   operatorRegexInArrayIgnoreCase,
+		"name__IN":      operatorIn,
+		"name__NIN":     operatorNotIn,
+		"name__ALL[]":   operatorAllArray,
+		"name__Exists":  operatorExists,
+		"Name__eq":      operatorEquals,
+		"Name__\u0130N": operator("\u0130n"),
+	}
+
+	for key, expected := range cases {
+		field, op := parseOperator(key)
+
+		assert.Equal(t, key[:strings.Index(key, delimiter)], field, key)
+		assert.Equal(t, expected, op, key)
+	}
+
+	_, op := parseOperator("name__\u0130N")
+	assert.False(t, op.IsValid())
+}
+
+func FuzzParseOperator(f *testing.F) {
+	seeds := []string{
+		"field[]", "field__all[]", "field__ire[]", "field__in", "field",
+		"__", "field__", "____", "name____gte", "a__b__c", "[]", "__[]",
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, key string) {
+		field, op := parseOperator(key)
+
+		assert.True(t, strings.HasPrefix(key, field))
+
+		if op.IsValid() {
+			_ = op.MongoOperator()
+			_ = op.SingleValueOperator()
+			_ = op.CommonOperator()
+			_ = op.RegexOpts()
+		}
+	})
 }
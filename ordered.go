@@ -0,0 +1,88 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// docElemFunc makes an element of an ordered document, i.e. a bson.E.
+type docElemFunc = func(key string, val interface{}) (elem interface{},
+	err error)
+
+// OrderedFilter returns the filter as an ordered document: a slice of
+// the elements made by docElem, i.e. Primitives.DocElem, with the keys
+// sorted, so the same filter always has the same shape, i.e. for the query
+// plan cache or in tests. The nested documents, the ones in the arrays too,
+// are ordered the same way, the empty documents are kept as they are.
+// The slice has the type of the elements, i.e. []bson.E, see
+// mongodriver.OrderedFilter for a bson.D.
+func (f Query) OrderedFilter(
+	docElem func(string, interface{}) (interface{}, error)) (
+	filter interface{}, err error) {
+	if len(f.Filter) == 0 {
+		return nil, nil
+	}
+
+	return orderedValue(f.Filter, docElem)
+}
+
+// orderedValue converts the documents of a value to the ordered ones.
+func orderedValue(val interface{}, docElem docElemFunc) (
+	ordered interface{}, err error) {
+	switch v := val.(type) {
+	case M:
+		return orderedDoc(v, docElem)
+	case []M:
+		arr := make([]interface{}, len(v))
+		for i, doc := range v {
+			if arr[i], err = orderedDoc(doc, docElem); err != nil {
+				return nil, err
+			}
+		}
+
+		return arr, nil
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, elem := range v {
+			if arr[i], err = orderedValue(elem, docElem); err != nil {
+				return nil, err
+			}
+		}
+
+		return arr, nil
+	}
+
+	return val, nil
+}
+
+// orderedDoc converts a document to a slice of its elements.
+func orderedDoc(doc M, docElem docElemFunc) (ordered interface{},
+	err error) {
+	if len(doc) == 0 {
+		return doc, nil
+	}
+
+	var elems reflect.Value
+
+	for _, key := range sortedFields(doc) {
+		val, err := orderedValue(doc[key], docElem)
+		if err != nil {
+			return nil, err
+		}
+
+		elem, err := docElem(key, val)
+		if err != nil {
+			return nil, fmt.Errorf("ordered filter: %s: %w", key, err)
+		}
+
+		elemVal := reflect.ValueOf(elem)
+		if !elems.IsValid() {
+			elems = reflect.MakeSlice(reflect.SliceOf(elemVal.Type()), 0,
+				len(doc))
+		}
+
+		elems = reflect.Append(elems, elemVal)
+	}
+
+	return elems.Interface(), nil
+}
@@ -0,0 +1,85 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+)
+
+// parsePage converts the __page and __per_page directives to the limit and
+// the skip, i.e. "__page=3&__per_page=25" to the limit of 25 and the skip
+// of 50. The page size defaults to __limit or DefaultLimit and a missing
+// __page means the first page. The pages are not combined with __skip.
+func (p *Parser) parsePage(params url.Values, filter *Query) (errs []error) {
+	str := params.Get(delimiter + pageParam)
+	perPage := params.Get(delimiter + perPageParam)
+
+	if len(str) == 0 && len(perPage) == 0 {
+		return nil
+	}
+
+	for _, param := range [...]string{skipParam, limitParam} {
+		if len(params.Get(delimiter+param)) > 0 {
+			errs = append(errs, fmt.Errorf("%w: %s with %s", ErrBadPage,
+				delimiter+pageParam, delimiter+param))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	limit, err := p.parseBound(params, perPageParam, p.MaxLimit)
+
+	// the page size divides the maximum skip, so it is at least 1
+	var rangeErr *RangeError
+
+	switch {
+	case errors.As(err, &rangeErr) && rangeErr.isNegative() ||
+		err == nil && len(perPage) > 0 && limit < 1:
+		return []error{fmt.Errorf("%s parameter: %w: %s is less than 1",
+			perPageParam, ErrOutOfRange, perPage)}
+	case err != nil:
+		return []error{err}
+	case limit != 0:
+		filter.Limit = limit
+	}
+
+	page, err := parseIntParam(params, pageParam, 0)
+
+	switch {
+	case err != nil:
+		return []error{err}
+	case len(str) == 0:
+		page = 1
+	case page < 1:
+		return []error{fmt.Errorf("%s parameter: %w: %s is less than 1",
+			pageParam, ErrOutOfRange, str)}
+	case page > 1 && filter.Limit == 0:
+		return []error{fmt.Errorf("%w: %s needs a page size", ErrBadPage,
+			delimiter+pageParam)}
+	}
+
+	if page > 1 {
+		maxSkip := p.MaxSkip
+		if maxSkip <= 0 {
+			maxSkip = math.MaxInt64
+		}
+
+		if maxPage := maxSkip/filter.Limit + 1; page > maxPage {
+			if !p.ClampLimit {
+				return []error{&RangeError{
+					Param: pageParam, Value: str, Max: maxPage,
+				}}
+			}
+
+			page = maxPage
+		}
+	}
+
+	filter.Page = page
+	filter.Skip = (page - 1) * filter.Limit
+
+	return nil
+}
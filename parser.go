@@ -1,13 +1,16 @@
 package query
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/url"
+	"reflect"
+	"regexp/syntax"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
-
-	"github.com/hashicorp/go-multierror"
+	"time"
 )
 
 const (
@@ -20,77 +23,586 @@ const (
 	skipParam  = "skip"
 	sortParam  = "sort"
 
+	projectionParam = "fields"
+	searchParam     = "search"
+	searchLangParam = "search_lang"
+	searchCaseParam = "search_case"
+	diacriticParam  = "search_diacritic"
+	afterParam      = "after"
+	pageParam       = "page"
+	perPageParam    = "per_page"
+	countParam      = "count"
+	beforeParam     = "before"
+	idField         = "_id"
+
 	// Sort constraints.
 	sortAscPrefix  = "+"
 	sortDescPrefix = "-"
 	sortAsc        = 1
 	sortDesc       = -1
+
+	// sortAscSpace is the "+" prefix that is decoded as a space from
+	// a query string.
+	sortAscSpace = " "
+
+	// The direction suffixes of the "field:asc" and "field:desc" syntax.
+	sortDirectionDelimiter = ":"
+	sortAscSuffix          = "asc"
+	sortDescSuffix         = "desc"
+
+	// startAnchor anchors a regular expression at the beginning of a string.
+	startAnchor = "^"
+	// endAnchor anchors a regular expression at the end of a string.
+	endAnchor = "$"
 )
 
 // Parser is a structure that parses url queries.
+//
+// A Parser is safe for concurrent use by multiple goroutines once its
+// configuration is complete: all the exported fields must be set before
+// the first call to Parse and must not be modified afterwards. Converters
+// and Primitives used by the Parser must be safe for concurrent use too.
 type Parser struct {
 	// Converter is a TypeConverter that converts unspecified fields.
 	Converter *TypeConverter
+	// Bool overrides the boolean converter of the Converter, i.e.
+	// BoolTokens([]string{"true", "1"}, []string{"false", "0"}). It
+	// converts the values of the boolean operators and directives and
+	// the boolean values of the unspecified fields. When nil, Converter.Bool
+	// or Bool is used.
+	Bool ConvertFunc
 	// Fields is a fields specification.
 	Fields Fields
 	// ValidateFields enables or disables field specification validator.
 	// When true, the parser will return ErrNoFieldSpec for every
 	// unspecified field in url query.
 	ValidateFields bool
+	// SortFields lists the fields that a query can be sorted by. When it
+	// is not empty it is consulted instead of Fields, so sorting by any
+	// other field is reported with ErrNoSortField even without
+	// ValidateFields.
+	SortFields []string
+	// DefaultSort is applied when a query has no __sort directive, i.e.
+	// []string{"-created", "_id"}, so that the results have a stable order
+	// for pagination. Its fields are neither checked against SortFields
+	// nor against Fields.
+	DefaultSort []string
+	// RequireOneOf lists the groups of fields where at least one field of
+	// every group must have a condition, i.e. [][]string{{"customerId",
+	// "orderId"}}. A violated group is reported with ErrMissingField.
+	RequireOneOf [][]string
+	// BaseFilter holds the mandatory conditions, i.e. M{"deleted": false},
+	// that are added to every parsed query. A client condition on the same
+	// field never replaces a base one, both of them are moved to an $and.
+	// The base conditions are neither validated nor satisfy the Required
+	// fields.
+	BaseFilter M
+	// MaxSortFields limits the number of distinct fields of the __sort
+	// directive, more fields are reported with ErrTooManySortFields. Zero
+	// means no limit.
+	MaxSortFields int
+	// MaxValues limits the total number of values in a query, directives
+	// included, after comma-separated values are split. Zero means no
+	// limit.
+	MaxValues int
+	// MaxValuesSize limits the total size in bytes of the query keys and
+	// values, directives included. Zero means no limit.
+	MaxValuesSize int
+	// MaxLimit is the maximum value of the __limit parameter. Zero means
+	// no limit other than the int64 range.
+	MaxLimit int64
+	// MaxSkip is the maximum value of the __skip parameter. Zero means
+	// no limit other than the int64 range.
+	MaxSkip int64
+	// DefaultLimit is the value of Query.Limit when the __limit parameter
+	// is absent or zero. It never exceeds MaxLimit.
+	DefaultLimit int64
+	// ClampLimit makes __limit and __skip values that exceed MaxLimit and
+	// MaxSkip clamp to the maximum instead of returning a RangeError.
+	ClampLimit bool
+	// CountAll makes the __count directive count all the matching
+	// documents: Limit, Skip and Page of a count query are reset, so
+	// DefaultLimit does not cap the count.
+	CountAll bool
+	// LenientBrackets restores the legacy handling of the bracket syntax:
+	// all the brackets are replaced with dots, so unbalanced brackets never
+	// cause ErrBadBrackets.
+	LenientBrackets bool
+	// NullLiteral is a value that means null for the "eq" and "ne"
+	// operators regardless of the field converter, i.e. "null" makes
+	// "deletedAt=null" a {"deletedAt": nil} filter. Empty disables it.
+	NullLiteral string
+	// StrictDirectives makes Parse report every query parameter that
+	// starts with the delimiter but is not a known directive, i.e.
+	// "__limt", with ErrUnknownDirective instead of ignoring it.
+	StrictDirectives bool
+	// CursorTokens makes the __after and __before directives take the
+	// opaque tokens of CursorToken instead of the raw values of a single
+	// sort field, so a cursor follows a sort on several fields.
+	CursorTokens bool
+	// CursorKey signs the cursor tokens of Parser.CursorToken with
+	// HMAC-SHA256, so the tokens without a valid signature are rejected
+	// with ErrInvalidCursor. Empty disables the signatures.
+	CursorKey []byte
+	// DisabledOperators lists the public names of the operators that are
+	// disabled for all the fields, i.e. "re" and "co", they are reported
+	// with ErrOperatorDisabled. A disabled operator is disabled with the
+	// "not" modifier too, while the other variants, i.e. "ire", are listed
+	// separately.
+	DisabledOperators []string
+	// ErrorFormatter rewrites the messages of the problems of
+	// the ParseErrors, i.e. localizes them by ParseError.Code. The messages
+	// are joined with newlines. Nil keeps the default messages.
+	ErrorFormatter func(e ParseError) string
+	// DateRangeAware makes the conditions on date-only values, i.e.
+	// "created__lte=2021-01-01", cover the whole day: "eq" matches any time
+	// of the day, "ne" excludes the whole day, "lte" and "gt" compare with
+	// the next day midnight. Other values are compared as is, as are
+	// the values of "in" and "nin" even when a single one is given, i.e.
+	// "created__in=2021-01-01" matches the midnight only.
+	DateRangeAware bool
+	// MaxArrayValues limits the number of values of a multi-value operator,
+	// i.e. "in" or "[]", of a single field. Comma-separated values are
+	// counted after they are split and merged. Zero means no limit.
+	MaxArrayValues int
+	// ValidateRegex makes the parser check the patterns of the regex
+	// operators, i.e. "re", "rein" and "re[]", with the regexp/syntax
+	// package and report the invalid ones with ErrBadRegex. The patterns of
+	// the co and sw operators are escaped and never checked.
+	ValidateRegex bool
+	// MaxRegexLength limits the length in bytes of the patterns of
+	// the regex operators, longer patterns are reported with
+	// ErrRegexTooLong. Zero means no limit.
+	MaxRegexLength int
+	// EmptyValues is a policy of the empty values, i.e. "name=" or
+	// the empty elements of "id__in=1,,2": EmptyKeep (the default),
+	// EmptyIgnore or EmptyError. Fields with AllowEmpty keep them.
+	EmptyValues EmptyValues
+	// PreferForm makes ParseRequest take the form values instead of the URL
+	// query values of the same key.
+	PreferForm bool
+	// AllowTextSearch enables the __search directive that is converted to
+	// a $text condition, which needs a text index. Otherwise the directive
+	// is reported with ErrTextSearchDisabled.
+	AllowTextSearch bool
+	// PartialResults makes Parse return the valid part of a query along
+	// with an error: the converted filter conditions, the valid sort
+	// fields, limit and skip. By default the Query is zero on any error.
+	PartialResults bool
+
+	cache     *queryCache
+	operators map[operator]OperatorSpec
+}
+
+// budget limits the amount of work done while parsing a single query.
+type budget struct {
+	maxValues, maxBytes int
+	values, bytes       int
+	// failFast stops the parsing at the first error.
+	failFast bool
+}
+
+func (p *Parser) budget() (b *budget) {
+	return &budget{maxValues: p.MaxValues, maxBytes: p.MaxValuesSize}
+}
+
+// stop checks if the parsing stops at the errors.
+func (b *budget) stop(errs []error) (ok bool) {
+	return b.failFast && len(errs) > 0
+}
+
+func (b *budget) spend(values, bytes int) (err error) {
+	b.values += values
+	b.bytes += bytes
+
+	if b.maxBytes > 0 && b.bytes > b.maxBytes {
+		return fmt.Errorf("%w: more than %d bytes",
+			ErrQueryTooLarge, b.maxBytes)
+	}
+
+	if b.maxValues > 0 && b.values > b.maxValues {
+		return fmt.Errorf("%w: more than %d values",
+			ErrQueryTooLarge, b.maxValues)
+	}
+
+	return nil
+}
+
+// spendDirectives charges the keys and the values of the directives to
+// the budget, so they are limited with the conditions. The values of
+// the list directives, i.e. __sort and __fields, are split like the values
+// of the multi-value operators. The group conditions are charged by their
+// own pipeline.
+func (b *budget) spendDirectives(query url.Values) (err error) {
+	for _, k := range sortedKeys(query) {
+		name := strings.TrimPrefix(k, delimiter)
+		if len(name) == len(k) || isGroupDirective(name) {
+			continue
+		}
+
+		isList := name == sortParam || name == projectionParam
+
+		if err = b.spend(0, len(k)); err != nil {
+			return err
+		}
+
+		for _, val := range query[k] {
+			n := 1
+			if isList {
+				n = countSplit(val, b.valuesLeft())
+			}
+
+			if err = b.spend(n, len(val)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isGroupDirective checks if a name without the delimiter is a key of
+// the __or or __and group, i.e. "or[0][status]".
+func isGroupDirective(name string) (ok bool) {
+	for _, group := range [...]string{orParam, andParam} {
+		if name == group || strings.HasPrefix(name, group+"[") {
+			return true
+		}
+	}
 
-	initRegescape sync.Once
-	rxRegEscape   *strings.Replacer
+	return false
 }
 
 type operatorsMap = map[operator][]string
 
 type fieldsMap = map[string]map[operator][]string
 
-func normailzeFields(fields fieldsMap) (normalized fieldsMap) {
-	normalized = make(fieldsMap)
+// valuesLeft returns the number of values that can still be spent or -1
+// when the number of values is not limited.
+func (b *budget) valuesLeft() (n int) {
+	if b.maxValues <= 0 {
+		return -1
+	}
 
-	for field, ops := range fields {
-		ff := make(operatorsMap)
+	if n = b.maxValues - b.values; n < 0 {
+		n = 0
+	}
+
+	return n
+}
+
+// countSplit counts comma-separated values in s, but stops as soon as the
+// count exceeds max, so that huge values are rejected early. A negative
+// max means no limit.
+func countSplit(s string, max int) (n int) {
+	for n = 1; max < 0 || n <= max; n++ {
+		pos := strings.Index(s, arrayDelimiter)
+		if pos < 0 {
+			break
+		}
+
+		s = s[pos+len(arrayDelimiter):]
+	}
 
-		for op, arr := range ops {
-			cop := op.CommonOperator()
+	return n
+}
 
-			if len(arr) == 1 && op.NeedSplitString() {
-				arr = strings.Split(arr[0], arrayDelimiter)
+// normailzeFields splits the comma-separated values and merges the sources
+// of every common operator, i.e. "in" and "[]". The fields map is updated
+// in place and the operators maps that are already normalized are kept.
+// With keepDays a multi-value operator with a single date-only or
+// month-only value is not replaced with the single value one.
+func normailzeFields(fields fieldsMap, b *budget, keepDays bool) (
+	normalized fieldsMap, err error) {
+	for field, ops := range fields {
+		if isNormalized(ops) {
+			for _, arr := range ops {
+				if err = b.spend(len(arr), 0); err != nil {
+					return nil, err
+				}
 			}
 
-			ff[cop] = append(ff[cop], arr...)
+			continue
+		}
+
+		if fields[field], err = normalizeOperators(ops, b, keepDays); err != nil {
+			return nil, err
 		}
+	}
 
-		for op, arr := range ff {
-			if len(arr) != 1 || !op.IsMultiVal() {
-				continue
-			}
+	return fields, nil
+}
+
+// isNormalized checks that every operator is a common one and there is
+// neither a value to split nor a multi-value operator with a single value.
+func isNormalized(ops operatorsMap) (ok bool) {
+	for op, arr := range ops {
+		if op.CommonOperator() != op || len(arr) == 1 &&
+			(op.NeedSplitString() || op.IsMultiVal() && !op.IsArrayOperator()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func normalizeOperators(ops operatorsMap, b *budget, keepDays bool) (
+	ff operatorsMap, err error) {
+	ff = make(operatorsMap, len(ops))
+
+	// Merge the sources of every common operator (i.e. "in" and "[]")
+	// in a stable order with a single final copy.
+	for _, op := range sortedOperators(ops) {
+		arr := ops[op]
+		cop := op.CommonOperator()
+
+		split := len(arr) == 1 && op.NeedSplitString()
+
+		n := len(arr)
+		if split {
+			n = countSplit(arr[0], b.valuesLeft())
+		}
 
-			ff[op.SingleValueOperator()] = arr
-			delete(ff, op)
+		if err = b.spend(n, 0); err != nil {
+			return nil, err
 		}
 
-		normalized[field] = ff
+		if split {
+			arr = strings.Split(arr[0], arrayDelimiter)
+		}
+
+		if prev, hasOperator := ff[cop]; hasOperator {
+			merged := make([]string, 0, len(prev)+len(arr))
+			arr = append(append(merged, prev...), arr...)
+		}
+
+		ff[cop] = arr
+	}
+
+	for op, arr := range ff {
+		if len(arr) != 1 || !op.IsMultiVal() || op.IsArrayOperator() ||
+			keepDays && isDayValue(arr[0]) {
+			continue
+		}
+
+		// keep the multi-value operator when the single value one
+		// is already given, i.e. for "nin" and "ne" on the same field
+		single := op.SingleValueOperator()
+		if _, hasSingle := ff[single]; hasSingle {
+			continue
+		}
+
+		ff[single] = arr
+		delete(ff, op)
+	}
+
+	return ff, nil
+}
+
+// sortedOperators returns the operators in the ascending order. There are
+// a few operators per field, so they are sorted by insertion.
+func sortedOperators(ops operatorsMap) (sorted []operator) {
+	sorted = make([]operator, 0, len(ops))
+
+	for op := range ops {
+		i := len(sorted)
+		sorted = append(sorted, op)
+
+		for ; i > 0 && sorted[i-1] > op; i-- {
+			sorted[i] = sorted[i-1]
+		}
+
+		sorted[i] = op
+	}
+
+	return sorted
+}
+
+// sortedFieldNames returns the fields in the ascending order, so the
+// conditions are converted and the first error is found in the same order
+// every time.
+func sortedFieldNames(fields fieldsMap) (sorted []string) {
+	sorted = make([]string, 0, len(fields))
+
+	for field := range fields {
+		sorted = append(sorted, field)
+	}
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func sortedKeys(query url.Values) (keys []string) {
+	keys = make([]string, 0, len(query))
+
+	for k := range query {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// flattenField converts map[like][field] to struct.like.field. Brackets
+// must be balanced and every segment must be non-empty.
+func flattenField(field string) (flat string, err error) {
+	pos := strings.IndexAny(field, "[]")
+	if pos < 0 {
+		return field, nil
+	}
+
+	if pos == 0 || field[pos] == ']' {
+		return "", ErrBadBrackets
+	}
+
+	var b strings.Builder
+
+	b.Grow(len(field))
+	b.WriteString(field[:pos])
+
+	for rest := field[pos:]; len(rest) > 0; {
+		end := strings.IndexAny(rest[1:], "[]") + 1
+		if rest[0] != '[' || end == 0 || rest[end] != ']' || end == 1 {
+			return "", ErrBadBrackets
+		}
+
+		b.WriteByte('.')
+		b.WriteString(rest[1:end])
+
+		rest = rest[end+1:]
+	}
+
+	return b.String(), nil
+}
+
+// lenientFlattenField converts map[like][field] to struct.like.field just
+// dropping all the brackets.
+func lenientFlattenField(field string) (flat string) {
+	pos := strings.IndexAny(field, "[]")
+	if pos < 0 {
+		return field
+	}
+
+	var b strings.Builder
+
+	b.Grow(len(field))
+	b.WriteString(field[:pos])
+
+	for i := pos; i < len(field); i++ {
+		switch c := field[i]; c {
+		case '[':
+			b.WriteByte('.')
+		case ']':
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func (p *Parser) flattenField(field string) (flat string, err error) {
+	if p.LenientBrackets {
+		return lenientFlattenField(field), nil
+	}
+
+	return flattenField(field)
+}
+
+// lookupField resolves a field name, either dotted or in the bracket
+// notation, to its specification. Filter and sort fields are resolved the
+// same way, so every filterable field is also sortable.
+func (p *Parser) lookupField(name string) (spec Field, ok bool) {
+	field, err := p.flattenField(name)
+	if err != nil {
+		return spec, false
+	}
+
+	return p.Fields.lookup(field)
+}
+
+func (p *Parser) isDeclared(key string) (ok bool) {
+	_, ok = p.lookupField(key)
+
+	return ok
+}
+
+// parseKey splits a query key to a field name and an operator. Declared
+// fields win over the operator parsing, so field names that contain the
+// delimiter (i.e. "legacy__code" or "legacy__code__gte") are supported.
+func (p *Parser) parseKey(key string) (field string, op operator) {
+	if len(p.Fields) == 0 {
+		return parseOperator(key)
+	}
+
+	if p.isDeclared(key) {
+		return key, operatorEquals
 	}
 
-	return normalized
+	prefix := strings.TrimSuffix(key, string(operatorInArray))
+	if len(prefix) < len(key) && p.isDeclared(prefix) {
+		return prefix, operatorInArray
+	}
+
+	pos := strings.LastIndex(key, delimiter)
+	for ; pos > 0; pos = strings.LastIndex(key[:pos], delimiter) {
+		if p.isDeclared(key[:pos]) {
+			return key[:pos], foldOperator(key[pos+len(delimiter):])
+		}
+	}
+
+	return parseOperator(key)
 }
 
-func extractFields(query url.Values) (fields fieldsMap) {
+// extractFields groups query values by fields and operators. Malformed
+// keys are skipped and reported with errs, fields is nil when the query
+// exceeds the budget.
+func (p *Parser) extractFields(query url.Values, b *budget) (
+	fields fieldsMap, errs []error) {
 	fields = make(fieldsMap)
 
-	for k, v := range query {
+	for _, k := range sortedKeys(query) {
 		if strings.HasPrefix(k, delimiter) {
 			continue
 		}
 
-		field, op := parseOperator(k)
+		// the elem conditions are parsed by parseElemMatches
+		if _, _, isElem, _ := elemMatchKey(k); isElem {
+			continue
+		}
+
+		v := query[k]
 
-		// convert map[like][field] to struct.like.field
-		field = strings.ReplaceAll(
-			strings.ReplaceAll(field, "[", "."),
-			"]", "")
+		size := len(k)
+		for _, val := range v {
+			size += len(val)
+		}
+
+		if err := b.spend(0, size); err != nil {
+			return nil, append(errs, err)
+		}
+
+		field, op := p.parseKey(k)
+		op = op.resolveNot()
+
+		field, err := p.flattenField(field)
+
+		switch {
+		case err != nil:
+		case field == "" && op == operatorInArray:
+			err = ErrBadBrackets
+		case op == "":
+			// a trailing delimiter ("name__") is never an equality
+			err = ErrUnknownOperator
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %q", err, k))
+
+			continue
+		}
 
 		f, ok := fields[field]
 		if !ok {
@@ -98,7 +610,8 @@ func extractFields(query url.Values) (fields fieldsMap) {
 		}
 
 		if arr, hasOperator := f[op]; hasOperator {
-			f[op] = append(arr, v...)
+			// never append to the caller's url.Values backing array
+			f[op] = append(arr[:len(arr):len(arr)], v...)
 		} else {
 			f[op] = v
 		}
@@ -106,7 +619,18 @@ func extractFields(query url.Values) (fields fieldsMap) {
 		fields[field] = f
 	}
 
-	return normailzeFields(fields)
+	custom := p.cutCustom(fields)
+
+	fields, err := normailzeFields(fields, b, p.DateRangeAware)
+	if err == nil {
+		err = p.addCustom(fields, custom, b)
+	}
+
+	if err != nil {
+		return nil, append(errs, err)
+	}
+
+	return fields, errs
 }
 
 func mapValues(values []string, c Converter) (i []interface{}, err error) {
@@ -114,7 +638,7 @@ func mapValues(values []string, c Converter) (i []interface{}, err error) {
 
 	for n, val := range values {
 		if i[n], err = c.Convert(val); err != nil {
-			return nil, fmt.Errorf("map: %w", err)
+			return nil, fmt.Errorf("map: %w: %q", err, val)
 		}
 	}
 
@@ -123,7 +647,7 @@ func mapValues(values []string, c Converter) (i []interface{}, err error) {
 
 func convertArray(v []string, op operator, c Converter) (
 	value interface{}, err error) {
-	if c == nil {
+	if isNilConverter(c) {
 		return nil, ErrNoConverter
 	}
 
@@ -132,7 +656,7 @@ func convertArray(v []string, op operator, c Converter) (
 	}
 
 	if len(v) > 1 {
-		err = ErrTooManyValues
+		return convertDistinct(v, op, c)
 	} else if len(v) == 1 {
 		value, err = c.Convert(v[0])
 	}
@@ -140,187 +664,1260 @@ func convertArray(v []string, op operator, c Converter) (
 	return value, err
 }
 
-func parseIntParam(params url.Values, name string) (val int64, err error) {
-	str := params.Get(delimiter + name)
-	if len(str) != 0 {
-		val, err = strconv.ParseInt(str, 10, 31)
-		if err != nil {
-			err = fmt.Errorf("%s parameter: %w", name, err)
+// convertDistinct converts multiple values of a single value operator.
+// Duplicates are collapsed, so "a=1&a=1" is the same as "a=1", while
+// distinct values are reported as conflicting for the equality operators
+// and as too many values for the others.
+func convertDistinct(v []string, op operator, c Converter) (
+	value interface{}, err error) {
+	values, err := mapValues(v, c)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range values[1:] {
+		if !reflect.DeepEqual(values[0], values[i+1]) {
+			if op.MongoOperator() != operatorEquals.MongoOperator() {
+				return nil, newParseError(op, v, ErrTooManyValues)
+			}
+
+			parseErr := newParseError(op, v, ErrConflictingValues)
+			parseErr.RawValues = []string{v[0], v[i+1]}
+
+			return nil, parseErr
 		}
 	}
 
-	return
+	return values[0], nil
 }
 
-func (p *Parser) regEscape(val string) (escaped string) {
-	p.initRegescape.Do(
-		func() {
-			const (
-				replaceChars = ".*?+^$[](){}|-"
-				escapeSymbol = "\\"
+// convertRange converts the "min,max" values of the range operator with
+// a converter. Either of the values may be empty for an open range, i.e.
+// "10," is only the "gte" bound.
+func convertRange(v []string, c Converter) (value interface{}, err error) {
+	if isNilConverter(c) {
+		return nil, ErrNoConverter
+	}
+
+	switch {
+	// a value is split only when the range is given once, so a comma is
+	// left in the values of "price__range=1,2&price__range=3,4"
+	case len(v) > 2 || strings.Contains(strings.Join(v, ""), arrayDelimiter):
+		return nil, newParseError(operatorRange, v, ErrTooManyValues)
+	case len(v) < 2 || len(v[0]) == 0 && len(v[1]) == 0:
+		return nil, newParseError(operatorRange, v, ErrBadRange)
+	}
 
-				mul2 = 2
-			)
+	r := make(valueRange, 0, len(v))
 
-			oldNew := make([]string, 0, len(replaceChars)*mul2)
+	for i, op := range []operator{
+		operatorGreaterThanOrEquals, operatorLessThanOrEquals,
+	} {
+		if len(v[i]) == 0 {
+			continue
+		}
 
-			for _, c := range replaceChars {
-				oldNew = append(oldNew, string(c),
-					escapeSymbol+string(c))
-			}
+		val, err := c.Convert(v[i])
+		if err != nil {
+			return nil, err
+		}
 
-			p.rxRegEscape = strings.NewReplacer(oldNew...)
-		},
-	)
+		r = append(r, bound{op: op, value: val})
+	}
 
-	return p.rxRegEscape.Replace(val)
+	return r, nil
 }
 
-func (p *Parser) regex(reOptions string, translate func(string) string) (
-	conv ConvertFunc) {
-	if p.Converter == nil || p.Converter.Primitives == nil {
-		return nil
+// convertBetween converts the "lower,upper" values of the between
+// operators with a converter. Both of the values are required and the lower
+// one must not exceed the upper one when they are comparable, see
+// compareValues.
+func convertBetween(op operator, v []string, c Converter) (
+	value interface{}, err error) {
+	if isNilConverter(c) {
+		return nil, ErrNoConverter
 	}
 
-	return func(val string) (rx interface{}, err error) {
-		return p.Converter.Primitives.RegEx(
-			translate(val), reOptions)
+	switch {
+	case len(v) > 2 || strings.Contains(strings.Join(v, ""), arrayDelimiter):
+		return nil, newParseError(op, v, ErrTooManyValues)
+	case len(v) < 2 || len(v[0]) == 0 || len(v[1]) == 0:
+		return nil, newParseError(op, v, ErrBadRange)
 	}
-}
 
-func nop() (translate func(string) string) {
-	return func(a string) string { return a }
-}
+	values, err := mapValues(v, c)
+	if err != nil {
+		return nil, err
+	}
 
-func sw(f func(string) string) (translate func(string) string) {
-	return func(a string) string { return "^" + f(a) }
-}
+	if cmp, ok := compareValues(values[0], values[1]); ok && cmp > 0 {
+		return nil, newParseError(op, v, ErrInvertedRange)
+	}
 
-func (p *Parser) convert(field string, op operator, v []string) (
-	value interface{}, err error) {
-	const errMsg = "convert: %w: %v"
+	return valueRange{
+		{op: operatorGreaterThanOrEquals, value: values[0]},
+		{op: operatorLessThanOrEquals, value: values[1]},
+	}, nil
+}
 
-	if !op.IsValid() {
-		return nil, fmt.Errorf(errMsg, ErrUnknownOperator, op)
+// compareValues compares the numbers, the strings and the time values. Other
+// values and the values of different types are not comparable.
+func compareValues(a, b interface{}) (cmp int, ok bool) {
+	// the int64 values are compared as is, so the large ones keep precision
+	if x, isInt := a.(int64); isInt {
+		if y, isInt := b.(int64); isInt {
+			return compareInts(x, y), true
+		}
 	}
 
-	conv, hasField := p.Fields.Converter(field)
-	if !hasField {
-		if p.ValidateFields {
-			return nil,
-				fmt.Errorf(errMsg, ErrNoFieldSpec, field)
+	if x, isNum := toFloat(a); isNum {
+		y, isNum := toFloat(b)
+
+		switch {
+		case !isNum:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
 		}
 
-		conv = p.Converter
+		return 0, true
+	}
 
-		if op == operatorExists {
-			conv = p.Converter.Bool
+	switch x := a.(type) {
+	case string:
+		if y, isString := b.(string); isString {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, isTime := b.(time.Time); isTime {
+			return x.Compare(y), true
 		}
 	}
 
+	return 0, false
+}
+
+func compareInts(x, y int64) (cmp int) {
 	switch {
-	case op.IsRegex():
-		conv = p.regex(op.RegexOpts(), nop())
-	case op.IsContains():
-		conv = p.regex(op.RegexOpts(), p.regEscape)
-	case op.IsStartsWith():
-		conv = p.regex(op.RegexOpts(), sw(p.regEscape))
+	case x < y:
+		return -1
+	case x > y:
+		return 1
 	}
 
-	value, err = convertArray(v, op, conv)
-	if err != nil {
-		return nil, fmt.Errorf(errMsg, err, field)
+	return 0
+}
+
+// toFloat converts the numbers made by the converters to float64.
+func toFloat(val interface{}) (f float64, ok bool) {
+	switch n := val.(type) {
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
 	}
 
-	return value, err
+	return 0, false
 }
 
-func getSortFields(params url.Values) (sortFields []string) {
-	sortParams, hasSortParam := params[delimiter+sortParam]
+// convertArguments converts the values of the mod operator to a [divisor,
+// remainder] array and of the bitwise operators either to a single mask or
+// to an array of bit positions.
+func convertArguments(op operator, v []string, c Converter) (
+	value interface{}, err error) {
+	values, err := mapValues(v, c)
+	if err != nil {
+		return nil, err
+	}
 
-	if !hasSortParam {
-		return
+	if op != operatorMod {
+		if len(values) == 1 {
+			return values[0], nil
+		}
+
+		return values, nil
+	}
+
+	switch {
+	case len(values) > 2:
+		return nil, newParseError(op, v,
+			fmt.Errorf("%w: %w", ErrBadModArgs, ErrTooManyValues))
+	case len(values) < 2:
+		return nil, newParseError(op, v, ErrBadModArgs)
+	case values[0] == int64(0):
+		return nil, newParseError(op, v,
+			fmt.Errorf("%w: zero divisor", ErrBadModArgs))
 	}
 
-	sortFields = make([]string, 0, len(sortParams))
+	return values, nil
+}
 
-	for _, param := range sortParams {
-		split := strings.Split(param, arrayDelimiter)
-		sortFields = append(sortFields, split...)
+func isNilConverter(c Converter) (ok bool) {
+	switch conv := c.(type) {
+	case nil:
+		return true
+	case ConvertFunc:
+		return conv == nil
+	case *TypeConverter:
+		return conv == nil
 	}
 
-	return
+	return false
 }
 
-func (p *Parser) parseFilter(query url.Values) (
-	filter Query, errs *multierror.Error) {
-	fields := extractFields(query)
+func parseIntParam(params url.Values, name string, max int64) (
+	val int64, err error) {
+	str := params.Get(delimiter + name)
+	if len(str) == 0 {
+		return 0, nil
+	}
 
-	for field, operators := range fields {
-		for op, values := range operators {
-			value, parseErr := p.convert(field, op, values)
-			if parseErr != nil {
-				errs = multierror.Append(errs,
-					fmt.Errorf("filter: %w: %s[%v]",
-						parseErr, field, op))
-			} else {
-				filter.AddFilter(field, op, value)
-			}
-		}
+	if max <= 0 {
+		max = math.MaxInt64
 	}
 
-	for fieldName, field := range p.Fields {
-		if field.Required {
-			if _, hasField := filter.Filter[fieldName]; !hasField {
-				errs = multierror.Append(errs,
-					fmt.Errorf("filter: %w: %s",
-						ErrMissingField, fieldName))
-			}
-		}
+	val, err = strconv.ParseInt(str, 10, 64)
+
+	switch {
+	case errors.Is(err, strconv.ErrRange) ||
+		err == nil && (val < 0 || val > max):
+		return 0, &RangeError{Param: name, Value: str, Max: max}
+	case err != nil:
+		return 0, fmt.Errorf("%s parameter: %w", name, err)
 	}
 
-	return filter, errs
+	return val, nil
 }
 
-// Parse parses a given url query.
-func (p *Parser) Parse(params url.Values) (filter Query, err error) {
-	var errs *multierror.Error
+// parseBound parses the __limit or __skip parameter. Too large values are
+// clamped to the maximum with ClampLimit, the negative ones are always
+// reported, so a negative limit never bypasses MaxLimit.
+func (p *Parser) parseBound(params url.Values, name string, max int64) (
+	val int64, err error) {
+	val, err = parseIntParam(params, name, max)
 
-	filter, errs = p.parseFilter(params)
+	var rangeErr *RangeError
+	if p.ClampLimit && errors.As(err, &rangeErr) && !rangeErr.isNegative() {
+		return rangeErr.Max, nil
+	}
 
-	filter.Limit, err = parseIntParam(params, limitParam)
-	if err != nil {
-		errs = multierror.Append(errs, err)
+	return val, err
+}
+
+// parseCount parses the boolean __count directive to Query.CountOnly.
+func (p *Parser) parseCount(params url.Values, filter *Query) (err error) {
+	str := params.Get(delimiter + countParam)
+	if len(str) == 0 {
+		return nil
 	}
 
-	filter.Skip, err = parseIntParam(params, skipParam)
+	count, err := p.boolConverter().Convert(str)
 	if err != nil {
-		errs = multierror.Append(errs, err)
+		return fmt.Errorf("%s parameter: %w", countParam, err)
 	}
 
-	sortFields := getSortFields(params)
+	filter.CountOnly, _ = count.(bool)
 
-	if len(sortFields) > 0 &&
-		(p.Converter == nil || p.Converter.Primitives == nil) {
-		errs = multierror.Append(errs, fmt.Errorf("no primitives: %w",
-			ErrNoSortField))
-	} else {
-		for _, sort := range sortFields {
-			sortField, sortErr := filter.AddSort(sort,
-				p.Converter.Primitives.DocElem)
+	if filter.CountOnly && p.CountAll {
+		filter.Limit, filter.Skip, filter.Page = 0, 0, 0
+	}
 
-			if sortErr != nil {
-				errs = multierror.Append(errs, sortErr)
-			} else if p.ValidateFields && !p.Fields.HasField(sortField) {
-				errs = multierror.Append(errs, fmt.Errorf(
-					"%w: %s", ErrNoSortField, sortField))
+	return nil
+}
+
+// regEscape escapes all the regular expression metacharacters in val, so
+// the result matches val literally. It does not allocate when val has
+// nothing to escape.
+func regEscape(val string) (escaped string) {
+	const escapeSymbol = '\\'
+
+	start := 0
+	for start < len(val) && !isRegexMeta(val[start]) {
+		start++
+	}
+
+	if start == len(val) {
+		return val
+	}
+
+	var b strings.Builder
+
+	b.Grow(len(val) + len(val) - start)
+	b.WriteString(val[:start])
+
+	for i := start; i < len(val); i++ {
+		c := val[i]
+		if isRegexMeta(c) {
+			b.WriteByte(escapeSymbol)
+		}
+
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func isRegexMeta(c byte) (ok bool) {
+	switch c {
+	case '\\', '.', '*', '?', '+', '^', '$', '[', ']',
+		'(', ')', '{', '}', '|', '-':
+		return true
+	}
+
+	return false
+}
+
+func (p *Parser) regex(reOptions string, translate func(string) string) (
+	conv Converter) {
+	if p.Converter == nil || p.Converter.Primitives == nil {
+		return nil
+	}
+
+	return ConvertFunc(func(val string) (rx interface{}, err error) {
+		return p.Converter.Primitives.RegEx(
+			translate(val), reOptions)
+	})
+}
+
+// hasEmptyValue checks if an operator gets an empty value. A bare anchor
+// is an empty value of the starts-with operators.
+func hasEmptyValue(op operator, values []string) (ok bool) {
+	for _, val := range values {
+		if len(val) == 0 || op.IsStartsWith() && val == startAnchor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EmptyValues defines how the parser handles empty values, i.e. "name=" or
+// the empty elements of "id__in=1,,2".
+type EmptyValues int
+
+const (
+	// EmptyKeep converts empty values with the converters like any other
+	// value. It is the default.
+	EmptyKeep EmptyValues = iota
+	// EmptyIgnore drops empty values, a condition without other values is
+	// dropped entirely.
+	EmptyIgnore
+	// EmptyError reports empty values with ErrEmptyValue.
+	EmptyError
+)
+
+// emptyValues applies the EmptyValues policy to the values of a condition.
+// The fields with AllowEmpty and the range operators, whose empty values are
+// open ends or errors, keep the values as is.
+func (p *Parser) emptyValues(field string, op operator, v []string) (
+	values []string, err error) {
+	if p.EmptyValues == EmptyKeep || op.IsRange() {
+		return v, nil
+	}
+
+	if spec, _ := p.lookupField(field); spec.AllowEmpty {
+		return v, nil
+	}
+
+	n := 0
+	for _, val := range v {
+		if len(val) > 0 {
+			n++
+		}
+	}
+
+	switch {
+	case n == len(v):
+		return v, nil
+	case p.EmptyValues == EmptyError:
+		parseErr := newParseError(op, v, ErrEmptyValue)
+		parseErr.Field = field
+
+		return nil, fmt.Errorf("convert: %w", parseErr)
+	}
+
+	values = make([]string, 0, n)
+	for _, val := range v {
+		if len(val) > 0 {
+			values = append(values, val)
+		}
+	}
+
+	return values, nil
+}
+
+// isNullLiteral checks if a single value of the "eq" or "ne" operator is
+// the NullLiteral.
+func (p *Parser) isNullLiteral(op operator, v []string) (ok bool) {
+	return len(p.NullLiteral) > 0 && len(v) == 1 && v[0] == p.NullLiteral &&
+		(op == operatorEquals || op == operatorNotEquals)
+}
+
+// boolConverter returns the boolean converter of the parser or the default
+// one.
+func (p *Parser) boolConverter() (conv Converter) {
+	if p.Bool != nil {
+		return p.Bool
+	}
+
+	if p.Converter != nil && p.Converter.Bool != nil {
+		return p.Converter.Bool
+	}
+
+	return Bool()
+}
+
+// fieldValues checks the values converted by a converter with the Validate
+// function of a field and replaces them with the Transform function.
+func fieldValues(op operator, c Converter, spec Field) (conv ConvertFunc) {
+	return func(val string) (i interface{}, err error) {
+		if i, err = c.Convert(val); err != nil || i == nil {
+			return i, err
+		}
+
+		if spec.Validate != nil {
+			err = spec.Validate(i)
+		}
+
+		if err == nil && spec.Transform != nil {
+			i, err = spec.Transform(i)
+		}
+
+		if err != nil {
+			return nil, newParseError(op, []string{val},
+				fmt.Errorf("%w: %w", ErrInvalidValue, err))
+		}
+
+		return i, nil
+	}
+}
+
+// defaultConverter returns the Converter with the Bool override of
+// the parser.
+func (p *Parser) defaultConverter() (conv Converter) {
+	if p.Bool == nil {
+		return p.Converter
+	}
+
+	c := *p.Converter
+	c.Bool = p.Bool
+
+	return &c
+}
+
+func nop() (translate func(string) string) {
+	return func(a string) string { return a }
+}
+
+// sw anchors a pattern at the beginning of a string. A single leading
+// anchor given by a user is dropped, so "^abc" is the same as "abc".
+func sw(f func(string) string) (translate func(string) string) {
+	return func(a string) string {
+		return startAnchor + f(strings.TrimPrefix(a, startAnchor))
+	}
+}
+
+// checkRegex checks the patterns of the regex operators against
+// MaxRegexLength and with ValidateRegex against the regexp syntax.
+func (p *Parser) checkRegex(patterns []string) (pattern string, err error) {
+	for _, pattern = range patterns {
+		if p.MaxRegexLength > 0 && len(pattern) > p.MaxRegexLength {
+			return pattern, fmt.Errorf("%w: more than %d bytes",
+				ErrRegexTooLong, p.MaxRegexLength)
+		}
+
+		if !p.ValidateRegex {
+			continue
+		}
+
+		if _, err = syntax.Parse(pattern, syntax.Perl); err != nil {
+			return pattern, fmt.Errorf("%w: %v", ErrBadRegex, err)
+		}
+	}
+
+	return "", nil
+}
+
+// exact anchors a pattern at both the beginning and the end of a string.
+func exact(f func(string) string) (translate func(string) string) {
+	return func(a string) string {
+		return startAnchor + f(a) + endAnchor
+	}
+}
+
+func (p *Parser) convert(field string, op operator, v []string) (
+	value interface{}, err error) {
+	const errMsg = "convert: %w: %v"
+
+	// registered operators are consulted before the built-in ones
+	opSpec, isCustom := p.operators[op]
+
+	if !isCustom && !op.IsValid() {
+		return nil, fmt.Errorf(errMsg, ErrUnknownOperator, op)
+	}
+
+	if !isCustom && (op.IsComparison() || op.IsPattern()) && hasEmptyValue(op, v) {
+		parseErr := newParseError(op, v, ErrEmptyValue)
+		parseErr.Field = field
+
+		return nil, fmt.Errorf("convert: %w", parseErr)
+	}
+
+	if p.isNullLiteral(op, v) {
+		if spec, _ := p.lookupField(field); !spec.Strict {
+			return nil, nil
+		}
+	}
+
+	isMultiVal := op.IsMultiVal() && !isCustom || opSpec.MultiValue
+	if isMultiVal && p.MaxArrayValues > 0 && len(v) > p.MaxArrayValues {
+		parseErr := newParseError(op, v, fmt.Errorf("%w: more than %d",
+			ErrTooManyArrayValues, p.MaxArrayValues))
+		parseErr.Field = field
+
+		return nil, fmt.Errorf("convert: %w", parseErr)
+	}
+
+	if !isCustom && op.IsRegex() {
+		if pattern, err := p.checkRegex(v); err != nil {
+			parseErr := newParseError(op, v, err)
+			parseErr.Field = field
+			parseErr.RawValues = []string{pattern}
+
+			return nil, fmt.Errorf("convert: %w", parseErr)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf(errMsg,
+				fmt.Errorf("%w: %v", ErrConverterPanic, r), field)
+		}
+	}()
+
+	spec, hasField := p.lookupField(field)
+	conv := spec.Converter
+
+	if !hasField && p.ValidateFields {
+		return nil, fmt.Errorf(errMsg, ErrNoFieldSpec, field)
+	}
+
+	if spec.NoRegex && !isCustom && (op.IsRegex() || op.IsContains()) {
+		parseErr := newParseError(op, v, ErrExpensiveOperator)
+		parseErr.Field = field
+
+		return nil, fmt.Errorf("convert: %w", parseErr)
+	}
+
+	if p.ValidateFields && !spec.GeoPoint && !isCustom && op.IsGeo() {
+		parseErr := newParseError(op, v, ErrNotGeoPoint)
+		parseErr.Field = field
+
+		return nil, fmt.Errorf("convert: %w", parseErr)
+	}
+
+	// fields without a specified converter use the default one unless
+	// they are strict
+	switch {
+	case !isNilConverter(conv) || spec.Strict:
+	case op == operatorDateBetween:
+		conv = Date()
+	case p.Converter != nil:
+		conv = p.defaultConverter()
+	}
+
+	if (spec.Validate != nil || spec.Transform != nil) &&
+		!isNilConverter(conv) {
+		conv = fieldValues(op, conv, spec)
+	}
+
+	switch {
+	case isCustom:
+	case op.IsBool():
+		conv = p.boolConverter()
+	case op == operatorSize:
+		conv = arraySize()
+	case op == operatorType:
+		conv = bsonType()
+	case op == operatorMod:
+		conv = Int()
+	case op.IsBitwise():
+		conv = arraySize()
+	case op.IsRegex():
+		conv = p.regex(op.RegexOpts(), nop())
+	case op.IsContains():
+		conv = p.regex(op.RegexOpts(), regEscape)
+	case op.IsStartsWith():
+		conv = p.regex(op.RegexOpts(), sw(regEscape))
+	case op.IsEqualFold():
+		conv = p.regex(op.RegexOpts(), exact(regEscape))
+	}
+
+	switch {
+	case isCustom:
+		value, err = convertCustom(field, opSpec, v, conv)
+	case op == operatorRange:
+		value, err = convertRange(v, conv)
+	case op.IsRange():
+		value, err = convertBetween(op, v, conv)
+	case op.IsGeo():
+		value, err = convertGeo(op, v)
+	case op.IsArguments():
+		value, err = convertArguments(op, v, conv)
+	default:
+		value, err = convertArray(v, op, conv)
+	}
+
+	if err != nil {
+		var parseErr ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.Field = field
+
+			return nil, fmt.Errorf("convert: %w", parseErr)
+		}
+
+		return nil, fmt.Errorf(errMsg, err, field)
+	}
+
+	return value, err
+}
+
+func getSortFields(params url.Values) (sortFields []string) {
+	return getListParam(params, sortParam)
+}
+
+// getListParam merges comma separated values of all the directives with
+// a given name.
+func getListParam(params url.Values, name string) (list []string) {
+	values, hasParam := params[delimiter+name]
+
+	if !hasParam {
+		return
+	}
+
+	list = make([]string, 0, len(values))
+
+	for _, param := range values {
+		split := strings.Split(param, arrayDelimiter)
+		list = append(list, split...)
+	}
+
+	return
+}
+
+// isDirective checks if a name without the delimiter is a known directive.
+func isDirective(name string) (ok bool) {
+	switch name {
+	case limitParam, skipParam, sortParam, projectionParam, orParam,
+		andParam, searchParam, searchLangParam, searchCaseParam,
+		diacriticParam, afterParam, beforeParam, pageParam, perPageParam,
+		countParam:
+		return true
+	}
+
+	return strings.HasPrefix(name, orParam+"[") ||
+		strings.HasPrefix(name, andParam+"[")
+}
+
+// unknownDirectives reports the query parameters that start with
+// the delimiter but are not known directives.
+func unknownDirectives(params url.Values) (errs []error) {
+	for _, key := range sortedKeys(params) {
+		name := strings.TrimPrefix(key, delimiter)
+		if len(name) < len(key) && !isDirective(name) {
+			errs = append(errs, fmt.Errorf("%w: %s",
+				ErrUnknownDirective, key))
+		}
+	}
+
+	return errs
+}
+
+// parseProjection parses the __fields directive, i.e. "name,email,-_id".
+// Fields with the "-" prefix are excluded, the others are included. With
+// ValidateFields every projected field except _id must be specified.
+func (p *Parser) parseProjection(params url.Values) (
+	projection map[string]int, errs []error) {
+	fields := getListParam(params, projectionParam)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	projection = make(map[string]int, len(fields))
+
+	var included, excluded int
+
+	for _, val := range fields {
+		flat, err := p.flattenField(val)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("projection: %w: %q", err, val))
+
+			continue
+		}
+
+		field, direction := parseSort(flat)
+		if field == "" {
+			errs = append(errs, fmt.Errorf(
+				"projection: %w: empty field name: %q",
+				ErrNoProjectionField, val))
+
+			continue
+		}
+
+		if p.ValidateFields && field != idField && !p.isDeclared(field) {
+			errs = append(errs,
+				fmt.Errorf("%w: %s", ErrNoProjectionField, field))
+
+			continue
+		}
+
+		include := 1
+		if direction == sortDesc {
+			include = 0
+		}
+
+		projection[p.Fields.DBName(field)] = include
+
+		switch {
+		case field == idField:
+		case include == 1:
+			included++
+		default:
+			excluded++
+		}
+	}
+
+	if included > 0 && excluded > 0 {
+		return nil, append(errs, fmt.Errorf("projection: %w",
+			ErrMixedProjection))
+	}
+
+	if len(projection) == 0 {
+		return nil, errs
+	}
+
+	return projection, errs
+}
+
+func (p *Parser) parseFilter(query url.Values, failFast bool) (
+	filter Query, errs []error) {
+	b := p.budget()
+	b.failFast = failFast
+
+	if err := b.spendDirectives(query); err != nil {
+		return filter, []error{err}
+	}
+
+	filter, errs, complete := p.parseConditions(query, b)
+	if !complete || b.stop(errs) {
+		return filter, errs
+	}
+
+	groups, groupErrs := p.parseGroups(query, orParam, b)
+	if errs = append(errs, groupErrs...); b.stop(errs) {
+		return filter, errs
+	}
+
+	and, andErrs := p.parseGroups(query, andParam, b)
+	if errs = append(errs, andErrs...); b.stop(errs) {
+		return filter, errs
+	}
+
+	text, err := p.parseTextSearch(query)
+	if err != nil {
+		errs = append(errs, err)
+	} else if text != nil {
+		if filter.Filter == nil {
+			filter.Filter = make(M, 1)
+		}
+
+		filter.Filter[textOperator] = text
+	}
+
+	if len(groups) > 0 {
+		if filter.Filter == nil {
+			filter.Filter = make(M, 1)
+		}
+
+		filter.Filter[mongoOpPrefix+orParam] = groups
+	}
+
+	filter.AddAnd(and...)
+
+	errs = append(errs, p.checkRequired(filter.Filter, groups, and)...)
+	if b.stop(errs) {
+		return filter, errs
+	}
+
+	errs = append(errs, p.addDefaults(&filter, groups, and)...)
+
+	return filter, errs
+}
+
+// addDefaults adds the Default conditions of the fields that have no
+// condition in the filter or in its groups.
+func (p *Parser) addDefaults(filter *Query, or, and []M) (errs []error) {
+	defaults := make(url.Values)
+
+	for fieldName, field := range p.Fields {
+		if field.Default == nil || isPattern(fieldName) ||
+			mentionsField(filter.Filter, or, and, p.Fields.DBName(fieldName)) {
+			continue
+		}
+
+		key := fieldName
+		if len(field.Default.Operator) > 0 {
+			key += delimiter + field.Default.Operator
+		}
+
+		defaults[key] = []string{field.Default.Value}
+	}
+
+	if len(defaults) == 0 {
+		return nil
+	}
+
+	// the defaults are not a part of the query budget
+	conditions, errs, _ := p.parseConditions(defaults, &budget{})
+
+	for field, condition := range conditions.Filter {
+		if filter.Filter == nil {
+			filter.Filter = make(M, len(conditions.Filter))
+		}
+
+		filter.Filter[field] = condition
+	}
+
+	return errs
+}
+
+// checkRequired checks that the filter has the conditions on the Required
+// fields, on the RequiredWith fields when their other fields are given and
+// on at least one field of every RequireOneOf group.
+func (p *Parser) checkRequired(filter M, or, and []M) (errs []error) {
+	has := func(fieldName string) (ok bool) {
+		return hasCondition(filter, or, and, p.Fields.DBName(fieldName))
+	}
+
+	for fieldName, field := range p.Fields {
+		switch {
+		case isPattern(fieldName) || has(fieldName):
+		case field.Required:
+			errs = append(errs, fmt.Errorf("filter: %w",
+				ParseError{Field: fieldName, Err: ErrMissingField}))
+		default:
+			for _, other := range field.RequiredWith {
+				if !has(other) {
+					continue
+				}
+
+				errs = append(errs, fmt.Errorf("filter: %w", ParseError{
+					Field: fieldName,
+					Err: fmt.Errorf("%w: required with %s",
+						ErrMissingField, other),
+				}))
+
+				break
+			}
+		}
+	}
+
+	for _, group := range p.RequireOneOf {
+		found := false
+		for _, fieldName := range group {
+			if found = has(fieldName); found {
+				break
+			}
+		}
+
+		if !found {
+			errs = append(errs, fmt.Errorf("filter: %w: one of %v",
+				ErrMissingField, group))
+		}
+	}
+
+	return errs
+}
+
+// checkOperator reports an operator that is in the DisabledOperators of
+// the parser or is not in the AllowedOperators of a field.
+func (p *Parser) checkOperator(field string, op operator) (err error) {
+	inner, _ := op.operand()
+
+	for _, disabled := range p.DisabledOperators {
+		if disabled == op.String() || disabled == inner.String() {
+			return fmt.Errorf("convert: %w: %v", ErrOperatorDisabled, op)
+		}
+	}
+
+	spec, _ := p.lookupField(field)
+	if len(spec.AllowedOperators) == 0 {
+		return nil
+	}
+
+	for _, allowed := range spec.AllowedOperators {
+		if allowed == op.String() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("convert: %w: %v", ErrOperatorNotAllowed, op)
+}
+
+// parseConditions converts the field conditions of a query including
+// the elem conditions, directives are skipped. The result is not complete
+// when the query exceeds the budget.
+func (p *Parser) parseConditions(query url.Values, b *budget) (
+	filter Query, errs []error, complete bool) {
+	fields, extractErrs := p.extractFields(query, b)
+	for _, err := range extractErrs {
+		errs = append(errs, fmt.Errorf("filter: %w", err))
+	}
+
+	if fields == nil || b.stop(errs) {
+		return filter, errs, false
+	}
+
+	for _, field := range sortedFieldNames(fields) {
+		operators := fields[field]
+		for _, op := range sortedOperators(operators) {
+			if b.stop(errs) {
+				return filter, errs, false
+			}
+
+			inner, negated := op.operand()
+			if negated && !inner.isNegatable() {
+				errs = append(errs, fmt.Errorf("filter: %w",
+					asParseError(field, op, operators[op], fmt.Errorf(
+						"convert: %w: %v", ErrUnknownOperator, op))))
+
+				continue
+			}
+
+			if err := p.checkOperator(field, op); err != nil {
+				errs = append(errs, fmt.Errorf("filter: %w",
+					asParseError(field, op, operators[op], err)))
+
+				continue
+			}
+
+			values, parseErr := p.emptyValues(field, inner, operators[op])
+			if parseErr == nil && len(values) == 0 {
+				continue
+			}
+
+			var value interface{}
+			if parseErr == nil {
+				value, parseErr = p.convert(field, inner, values)
+			}
+
+			if parseErr == nil {
+				condOp, condValue := nullCondition(inner, value)
+				if p.DateRangeAware {
+					condOp, condValue = dayCondition(condOp,
+						operators[op], condValue)
+				}
+
+				if negated {
+					condOp, condValue = notCondition(condOp, condValue)
+				}
+
+				parseErr = filter.addFilter(p.Fields.DBName(field),
+					condOp, condValue)
+			}
+
+			if parseErr != nil {
+				errs = append(errs, fmt.Errorf("filter: %w",
+					asParseError(field, op, operators[op], parseErr)))
 			}
 		}
 	}
 
-	if errs != nil {
-		err = fmt.Errorf("parse: %w", errs.ErrorOrNil())
+	if b.stop(errs) {
+		return filter, errs, false
+	}
+
+	elems, elemErrs, complete := p.parseElemMatches(query, b)
+	errs = append(errs, elemErrs...)
+
+	if !complete || b.stop(errs) {
+		return filter, errs, false
+	}
+
+	for field, match := range elems {
+		err := filter.addFilter(p.Fields.DBName(field), operatorElemMatch,
+			match)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("filter: %w", asParseError(
+				field, operatorElemMatch, nil, err)))
+		}
+	}
+
+	return filter, errs, true
+}
+
+// isSortable checks if a query can be sorted by a field.
+func (p *Parser) isSortable(field string) (ok bool) {
+	if len(p.SortFields) == 0 {
+		return !p.ValidateFields || p.isDeclared(field)
+	}
+
+	for _, sortField := range p.SortFields {
+		if matchPattern(sortField, field) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addSort validates a sort field and adds it to the filter. Invalid sort
+// fields are never added, the trusted ones (i.e. DefaultSort) are not
+// validated.
+func (p *Parser) addSort(filter *Query, sort string, trusted bool) (
+	err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("add sort: %w: %v: %s",
+				ErrConverterPanic, r, sort)
+		}
+	}()
+
+	field, direction := parseSortSpec(sort)
+
+	sortField, err := p.flattenField(field)
+	if err != nil {
+		return fmt.Errorf("add sort: %w: %q", err, sort)
+	}
+
+	if sortField == "" {
+		return fmt.Errorf("add sort: %w: empty field name: %q",
+			ErrNoSortField, sort)
+	}
+
+	if sortField == scoreSortField {
+		return p.addScoreSort(filter)
+	}
+
+	if !trusted && !p.isSortable(sortField) {
+		spec := "Fields"
+		if len(p.SortFields) > 0 {
+			spec = "SortFields"
+		}
+
+		return fmt.Errorf("%w: %s is not in %s", ErrNoSortField, sortField,
+			spec)
+	}
+
+	sortField = p.Fields.DBName(sortField)
+	if direction == sortDesc {
+		sortField = sortDescPrefix + sortField
+	}
+
+	_, err = filter.AddSort(sortField, p.Converter.Primitives.DocElem)
+
+	return err
+}
+
+// Parse parses a given url query.
+func (p *Parser) Parse(params url.Values) (filter Query, err error) {
+	if !p.useCache(params) {
+		return p.parse(params)
+	}
+
+	key := cacheKey(params)
+
+	if filter, ok := p.cache.Get(key); ok {
+		return filter, nil
+	}
+
+	if filter, err = p.parse(params); err == nil {
+		p.cache.Put(key, filter)
+	}
+
+	return filter, err
+}
+
+// ParseLenient parses a given url query like Parse with PartialResults,
+// but reports the problems as warnings instead of an error: the invalid
+// conditions, operators and directives are skipped, so a caller serves
+// the valid part of the query and surfaces the warnings without a 4xx
+// response. The BaseFilter is applied as usual.
+func (p *Parser) ParseLenient(params url.Values) (filter Query,
+	warnings []ParseError) {
+	if p.useCache(params) {
+		if filter, ok := p.cache.Get(cacheKey(params)); ok {
+			return filter, nil
+		}
+	}
+
+	filter, errs := p.parseQuery(params, false)
+	if len(errs) > 0 {
+		warnings = (&ParseErrors{errs: errs}).Errors()
+	}
+
+	return filter, warnings
+}
+
+// ParseStrict parses a given url query like Parse, but stops at the first
+// problem and returns it as is instead of collecting all of them into
+// ParseErrors, so the hot APIs reject invalid queries early. The Query is
+// zero on any error.
+func (p *Parser) ParseStrict(params url.Values) (filter Query, err error) {
+	cached := p.useCache(params)
+	if cached {
+		if filter, ok := p.cache.Get(cacheKey(params)); ok {
+			return filter, nil
+		}
+	}
+
+	filter, errs := p.parseQuery(params, true)
+	if len(errs) > 0 {
+		return Query{}, errs[0]
+	}
+
+	if cached {
+		p.cache.Put(cacheKey(params), filter)
+	}
+
+	return filter, nil
+}
+
+// useCache reports whether the parsed query of params is looked up in and
+// stored to the cache.
+func (p *Parser) useCache(params url.Values) (ok bool) {
+	return p.cache != nil && !p.hasRelativeDefaults() && isCacheable(params)
+}
+
+func (p *Parser) parse(params url.Values) (filter Query, err error) {
+	filter, errs := p.parseQuery(params, false)
+
+	if len(errs) > 0 {
+		err = &ParseErrors{errs: errs, format: p.ErrorFormatter}
+
+		if !p.PartialResults {
+			filter = Query{}
+		}
 	}
 
 	return filter, err
 }
+
+// parseQuery parses the valid part of a query and returns all
+// the problems or only the first one when it fails fast.
+// isTooLarge checks if some of the errors is ErrQueryTooLarge.
+func isTooLarge(errs []error) (ok bool) {
+	for _, err := range errs {
+		if errors.Is(err, ErrQueryTooLarge) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Parser) parseQuery(params url.Values, failFast bool) (
+	filter Query, errs []error) {
+	var err error
+
+	failed := func() bool { return failFast && len(errs) > 0 }
+
+	// a query over the budget is never parsed further
+	if filter, errs = p.parseFilter(params, failFast); failed() ||
+		isTooLarge(errs) {
+		return filter, errs
+	}
+
+	if len(p.BaseFilter) > 0 {
+		// MergeAnd never fails without a sort
+		_ = filter.Merge(Query{Filter: p.BaseFilter}, MergeAnd)
+	}
+
+	filter.Limit, err = p.parseBound(params, limitParam, p.MaxLimit)
+	if err != nil {
+		if errs = append(errs, err); failed() {
+			return filter, errs
+		}
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = p.DefaultLimit
+
+		if p.MaxLimit > 0 && filter.Limit > p.MaxLimit {
+			filter.Limit = p.MaxLimit
+		}
+	}
+
+	filter.Skip, err = p.parseBound(params, skipParam, p.MaxSkip)
+	if err != nil {
+		if errs = append(errs, err); failed() {
+			return filter, errs
+		}
+	}
+
+	if errs = append(errs, p.parsePage(params, &filter)...); failed() {
+		return filter, errs
+	}
+
+	if err = p.parseCount(params, &filter); err != nil {
+		if errs = append(errs, err); failed() {
+			return filter, errs
+		}
+	}
+
+	if p.StrictDirectives {
+		if errs = append(errs, unknownDirectives(params)...); failed() {
+			return filter, errs
+		}
+	}
+
+	projection, projectionErrs := p.parseProjection(params)
+	filter.Projection = projection
+
+	if errs = append(errs, projectionErrs...); failed() {
+		return filter, errs
+	}
+
+	sortFields, isDefault := getSortFields(params), false
+	if len(sortFields) == 0 {
+		sortFields, isDefault = p.DefaultSort, true
+	}
+
+	if len(sortFields) > 0 &&
+		(p.Converter == nil || p.Converter.Primitives == nil) {
+		errs = append(errs, fmt.Errorf("no primitives: %w",
+			ErrNoSortField))
+	} else {
+		for _, sort := range sortFields {
+			sortErr := p.addSort(&filter, sort, isDefault)
+			if sortErr != nil {
+				if errs = append(errs, sortErr); failed() {
+					return filter, errs
+				}
+			}
+
+			if !isDefault && p.MaxSortFields > 0 &&
+				filter.sortLen() > p.MaxSortFields {
+				filter.truncateSort(p.MaxSortFields)
+				errs = append(errs, fmt.Errorf("%w: more than %d",
+					ErrTooManySortFields, p.MaxSortFields))
+
+				break
+			}
+		}
+	}
+
+	if failed() {
+		return filter, errs
+	}
+
+	errs = append(errs, p.parseCursor(params, &filter, sortFields)...)
+
+	return filter, errs
+}
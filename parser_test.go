@@ -3,11 +3,16 @@ package query
 import (
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"net/url"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -59,7 +64,14 @@ func TestConvertArray(ts *testing.T) {
 		t.Parallel()
 
 		_, err := convertArray(testValues, operatorEquals, conv)
-		assert.EqualError(t, err, ErrTooManyValues.Error())
+		assert.True(t, errors.Is(err, ErrTooManyValues))
+
+		var parseErr ParseError
+
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, "eq", parseErr.Operator)
+		assert.Equal(t, len(testValues), parseErr.Count)
+		assert.Equal(t, testValues[:2], parseErr.RawValues)
 	})
 
 	ts.Run("$eq for a string returns that string", func(t *testing.T) {
@@ -101,22 +113,65 @@ func TestParseIntParam(t *testing.T) {
 		"__test1": []string{"10"},
 		"__test2": []string{"20", "30"},
 		"__test3": []string{"yes", "40"},
+		"__test5": []string{"2147483648"},
+		"__test6": []string{"99999999999999999999999"},
+		"__test7": []string{"-3"},
+		"__test8": []string{"-99999999999999999999"},
 	}
 
-	i, err := parseIntParam(params, "test1")
+	i, err := parseIntParam(params, "test1", 0)
 	assert.NoError(t, err)
 	assert.EqualValues(t, 10, i)
 
-	i, err = parseIntParam(params, "test2")
+	i, err = parseIntParam(params, "test2", 0)
 	assert.NoError(t, err)
 	assert.EqualValues(t, 20, i)
 
-	_, err = parseIntParam(params, "test3")
+	_, err = parseIntParam(params, "test3", 0)
 	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrOutOfRange))
 
-	i, err = parseIntParam(params, "test4")
+	i, err = parseIntParam(params, "test4", 0)
 	assert.NoError(t, err)
 	assert.Zero(t, i)
+
+	i, err = parseIntParam(params, "test5", 0)
+	assert.NoError(t, err)
+	assert.EqualValues(t, int64(1)<<31, i)
+
+	var rangeErr *RangeError
+
+	_, err = parseIntParam(params, "test6", 0)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	assert.True(t, errors.As(err, &rangeErr))
+	assert.Equal(t, RangeError{
+		Param: "test6",
+		Value: "99999999999999999999999",
+		Max:   math.MaxInt64,
+	}, *rangeErr)
+
+	i, err = parseIntParam(params, "test1", 10)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10, i)
+
+	_, err = parseIntParam(params, "test2", 10)
+	assert.True(t, errors.As(err, &rangeErr))
+	assert.Equal(t, RangeError{Param: "test2", Value: "20", Max: 10},
+		*rangeErr)
+	assert.EqualError(t, err,
+		"test2 parameter: out of range: 20 exceeds the maximum of 10")
+
+	_, err = parseIntParam(params, "test7", 10)
+	assert.True(t, errors.As(err, &rangeErr))
+	assert.Equal(t, RangeError{Param: "test7", Value: "-3", Max: 10},
+		*rangeErr)
+	assert.EqualError(t, err,
+		"test7 parameter: out of range: -3 is less than 0")
+
+	_, err = parseIntParam(params, "test8", 0)
+	assert.True(t, errors.Is(err, ErrOutOfRange))
+	assert.EqualError(t, err, "test8 parameter: out of range: "+
+		"-99999999999999999999 is less than 0")
 }
 
 func TestParserRegexEscape(ts *testing.T) {
@@ -130,18 +185,51 @@ func TestParserRegexEscape(ts *testing.T) {
 		test := "^([0-9]?.*){1,2}|n/a+$"
 		expected := "\\^\\(\\[0\\-9\\]\\?\\.\\*\\)\\{1,2\\}\\|n/a\\+\\$"
 
-		acquired := p.regEscape(test)
+		acquired := regEscape(test)
 		assert.Equal(t, expected, acquired)
 	})
 
+	ts.Run("backslash", func(t *testing.T) {
+		t.Parallel()
+
+		acquired := regEscape("foo\\d")
+		assert.Equal(t, "foo\\\\d", acquired)
+	})
+
 	ts.Run("noescape", func(t *testing.T) {
 		t.Parallel()
 
 		test := "0xabcdef"
-		acquired := p.regEscape(test)
+		acquired := regEscape(test)
 		assert.Equal(t, test, acquired)
 	})
 
+	ts.Run("escaped pattern matches the literal input", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []string{
+			"", "plain", "foo\\d", "\\", "a.b*c?d+e", "^$",
+			"[a-z]{2,3}", "(x|y)", "\\Q.*\\E", "тест.+", "a\\\\.b",
+			"^([0-9]?.*){1,2}|n/a+$",
+		}
+
+		for _, test := range tests {
+			rx, err := regexp.Compile("^" + regEscape(test) + "$")
+			if !assert.NoError(t, err, "input: %q", test) {
+				continue
+			}
+
+			assert.True(t, rx.MatchString(test), "input: %q", test)
+
+			for _, other := range tests {
+				if other != test {
+					assert.False(t, rx.MatchString(other),
+						"pattern for %q matches %q", test, other)
+				}
+			}
+		}
+	})
+
 	ts.Run("regex should return nil", func(t *testing.T) {
 		t.Parallel()
 
@@ -158,6 +246,50 @@ func TestParserRegexEscape(ts *testing.T) {
 	})
 }
 
+func legacyRegEscape() (escape func(string) string) {
+	const (
+		replaceChars = ".*?+^$[](){}|-"
+		escapeSymbol = "\\"
+	)
+
+	oldNew := make([]string, 0, len(replaceChars)*2)
+
+	for _, c := range replaceChars {
+		oldNew = append(oldNew, string(c), escapeSymbol+string(c))
+	}
+
+	return strings.NewReplacer(oldNew...).Replace
+}
+
+func BenchmarkRegexEscape(b *testing.B) {
+	inputs := map[string]string{
+		"noescape": "0xabcdef_plain_value",
+		"escaped":  "^([0-9]?.*){1,2}|n/a+$",
+	}
+
+	for name, input := range inputs {
+		input := input
+
+		b.Run(name+"/legacy", func(b *testing.B) {
+			escape := legacyRegEscape()
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_ = escape(input)
+			}
+		})
+
+		b.Run(name+"/single-pass", func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				_ = regEscape(input)
+			}
+		})
+	}
+}
+
 func TestParserConvert(ts *testing.T) {
 	ts.Parallel()
 
@@ -207,6 +339,30 @@ func TestParserConvert(ts *testing.T) {
 			fmt.Sprintf("convert: %v: test", ErrNoMatch))
 	})
 
+	ts.Run("operator exists must be boolean for declared fields",
+		func(t *testing.T) {
+			t.Parallel()
+
+			val, err := p.convert("field2", operatorExists,
+				[]string{"false"})
+			assert.NoError(t, err)
+			assert.Equal(t, false, val)
+
+			_, err = p.convert("field2", operatorExists, []string{"1"})
+			assert.True(t, errors.Is(err, ErrNoMatch),
+				"unexpected err: %v", err)
+
+			q, err := p2.Parse(url.Values{
+				"field1":         []string{"x"},
+				"field3":         []string{"yes"},
+				"field2__exists": []string{"true"},
+				"field2__gte":    []string{"5"},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"$exists": true, "$gte": int64(5)},
+				q.Filter["field2"])
+		})
+
 	ts.Run("regex operator", func(t *testing.T) {
 		t.Parallel()
 
@@ -222,9 +378,58 @@ func TestParserConvert(ts *testing.T) {
 		t.Parallel()
 
 		val, err := p.convert("test", operatorStartsWithIgnoreCase,
-			[]string{"^"})
+			[]string{"^^"})
 		assert.NoError(t, err)
 		assert.Equal(t, testRegEx{regex: "^\\^", options: "i"}, val)
+
+		val, err = p.convert("test", operatorStartsWith, []string{"^abc"})
+		assert.NoError(t, err)
+		assert.Equal(t, testRegEx{regex: "^abc"}, val)
+
+		val, err = p.convert("test", operatorStartsWithIn,
+			[]string{"a.b", "^c"})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{
+			testRegEx{regex: "^a\\.b"}, testRegEx{regex: "^c"},
+		}, val)
+	})
+
+	ts.Run("contains operator is literal", func(t *testing.T) {
+		t.Parallel()
+
+		val, err := p.convert("test", operatorContains, []string{"^"})
+		assert.NoError(t, err)
+		assert.Equal(t, testRegEx{regex: "\\^"}, val)
+
+		val, err = p.convert("test", operatorContainsIgnoreCase,
+			[]string{"^abc"})
+		assert.NoError(t, err)
+		assert.Equal(t, testRegEx{regex: "\\^abc", options: "i"}, val)
+	})
+
+	ts.Run("empty values of pattern operators", func(t *testing.T) {
+		t.Parallel()
+
+		cases := []struct {
+			op     operator
+			values []string
+		}{
+			{operatorStartsWith, []string{""}},
+			{operatorStartsWith, []string{"^"}},
+			{operatorStartsWithIgnoreCase, []string{"^"}},
+			{operatorStartsWithIn, []string{"a", ""}},
+			{operatorStartsWithInArray, []string{"a", "^"}},
+			{operatorContains, []string{""}},
+			{operatorContainsInIgnoreCase, []string{""}},
+			{operatorRegex, []string{""}},
+			{operatorRegexInArray, []string{"a", ""}},
+		}
+
+		for _, c := range cases {
+			_, err := p.convert("test", c.op, c.values)
+			assert.True(t, errors.Is(err, ErrEmptyValue),
+				"%v: unexpected err: %v", c, err)
+		}
 	})
 
 	ts.Run("contains operator", func(t *testing.T) {
@@ -238,6 +443,56 @@ func TestParserConvert(ts *testing.T) {
 		}, val)
 	})
 
+	ts.Run("empty values of comparison operators", func(t *testing.T) {
+		t.Parallel()
+
+		ops := []operator{
+			operatorGreaterThan, operatorGreaterThanOrEquals,
+			operatorLessThan, operatorLessThanOrEquals,
+			operatorNotEquals,
+		}
+
+		for _, op := range ops {
+			for _, field := range []string{"test", "field2"} {
+				_, err := p.convert(field, op, []string{""})
+				assert.True(t, errors.Is(err, ErrEmptyValue),
+					"unexpected err: %v", err)
+
+				var parseErr ParseError
+
+				if assert.True(t, errors.As(err, &parseErr)) {
+					assert.Equal(t, field, parseErr.Field)
+					assert.Equal(t, op.String(), parseErr.Operator)
+				}
+			}
+		}
+
+		val, err := p.convert("test", operatorEquals, []string{""})
+		assert.NoError(t, err)
+		assert.Equal(t, "", val)
+	})
+
+	ts.Run("too many values", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.convert("field2", operatorGreaterThan,
+			[]string{"1", "2", "3"})
+		assert.True(t, errors.Is(err, ErrTooManyValues))
+		assert.EqualError(t, err, "convert: too many values: "+
+			`field2[gt]: 3 values: "1", "2", ...`)
+
+		var parseErr ParseError
+
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, ParseError{
+			Field:     "field2",
+			Operator:  "gt",
+			Count:     3,
+			RawValues: []string{"1", "2"},
+			Err:       ErrTooManyValues,
+		}, parseErr)
+	})
+
 	ts.Run("unknown operator", func(t *testing.T) {
 		t.Parallel()
 
@@ -281,7 +536,7 @@ func TestParserParseFields(ts *testing.T) {
 			"__limit":  []string{"25"},
 			"__skip":   []string{"75"},
 			"__sort":   []string{"x,y,z"},
-		})
+		}, false)
 
 		assert.Nil(t, err)
 		assert.NotNil(t, filter.Filter)
@@ -298,10 +553,10 @@ func TestParserParseFields(ts *testing.T) {
 			"__limit": []string{"25"},
 			"__skip":  []string{"75"},
 			"__sort":  []string{"x,y,z"},
-		})
+		}, false)
 
 		assert.NotNil(t, err)
-		assert.True(t, errors.Is(err, ErrMissingField))
+		assert.True(t, errors.Is(errors.Join(err...), ErrMissingField))
 		assert.Nil(t, filter.Filter)
 		assert.Nil(t, filter.Sort)
 		assert.Zero(t, filter.Limit)
@@ -316,10 +571,10 @@ func TestParserParseFields(ts *testing.T) {
 			"__limit":  []string{"25"},
 			"__skip":   []string{"75"},
 			"__sort":   []string{"x,y,z"},
-		})
+		}, false)
 
 		assert.NotNil(t, err)
-		assert.True(t, errors.Is(err, ErrNoMatch))
+		assert.True(t, errors.Is(errors.Join(err...), ErrNoMatch))
 		assert.Nil(t, filter.Filter)
 		assert.Nil(t, filter.Sort)
 		assert.Zero(t, filter.Limit)
@@ -348,10 +603,13 @@ func TestParserParse(ts *testing.T) {
 		},
 	}
 
+	partial := p
+	partial.PartialResults = true
+
 	ts.Run("bad skip parameter", func(t *testing.T) {
 		t.Parallel()
 
-		filter, err := p.Parse(url.Values{
+		filter, err := partial.Parse(url.Values{
 			"required": []string{"yes"},
 			"__skip":   []string{"required"},
 			"__limit":  []string{"10"},
@@ -367,7 +625,7 @@ func TestParserParse(ts *testing.T) {
 	ts.Run("bad limit parameter", func(t *testing.T) {
 		t.Parallel()
 
-		filter, err := p.Parse(url.Values{
+		filter, err := partial.Parse(url.Values{
 			"required": []string{"no"},
 			"__limit":  []string{"ten"},
 			"__skip":   []string{"1000"},
@@ -381,12 +639,191 @@ func TestParserParse(ts *testing.T) {
 		assert.Nil(t, filter.Sort)
 	})
 
-	ts.Run("sort without spec", func(t *testing.T) {
+	ts.Run("too many values", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"required": []string{"yes", "no"}})
+
+		var parseErr ParseError
+
+		assert.True(t, errors.Is(err, ErrTooManyValues))
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, "required", parseErr.Field)
+		assert.Equal(t, "eq", parseErr.Operator)
+		assert.Equal(t, []string{"yes", "no"}, parseErr.RawValues)
+	})
+
+	ts.Run("64-bit skip", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__skip":   []string{"3000000000"},
+			"__limit":  []string{"2147483648"},
+		})
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3000000000, filter.Skip)
+		assert.EqualValues(t, 2147483648, filter.Limit)
+	})
+
+	ts.Run("negative skip", func(t *testing.T) {
+		t.Parallel()
+
+		for _, skip := range []string{"-3", "-99999999999999999999"} {
+			_, err := p.Parse(url.Values{
+				"required": []string{"yes"},
+				"__skip":   []string{skip},
+			})
+
+			assert.True(t, errors.Is(err, ErrOutOfRange), skip)
+			assert.Contains(t, err.Error(),
+				"skip parameter: out of range: "+skip+" is less than 0")
+		}
+	})
+
+	ts.Run("skip and limit maximum", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.MaxSkip, p.MaxLimit = 1000, 100
+
+		_, err := p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__skip":   []string{"1001"},
+			"__limit":  []string{"101"},
+		})
+
+		assert.True(t, errors.Is(err, ErrOutOfRange))
+		assert.Contains(t, err.Error(), "skip parameter")
+		assert.Contains(t, err.Error(), "maximum of 1000")
+		assert.Contains(t, err.Error(), "limit parameter")
+		assert.Contains(t, err.Error(), "maximum of 100")
+	})
+
+	ts.Run("limit too large", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.MaxLimit = 100
+
+		_, err := p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"1000000"},
+		})
+
+		assert.True(t, errors.Is(err, ErrLimitTooLarge))
+		assert.True(t, errors.Is(err, ErrOutOfRange))
+
+		_, err = p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__skip":   []string{"1000000"},
+			"__limit":  []string{"10"},
+		})
+
+		assert.NoError(t, err)
+
+		_, err = p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"-1000000"},
+		})
+
+		assert.True(t, errors.Is(err, ErrOutOfRange))
+		assert.False(t, errors.Is(err, ErrLimitTooLarge))
+		assert.Contains(t, err.Error(),
+			"limit parameter: out of range: -1000000 is less than 0")
+	})
+
+	ts.Run("clamp limit and skip", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.MaxLimit, p.MaxSkip, p.ClampLimit = 100, 1000, true
+
+		filter, err := p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"1000000"},
+			"__skip":   []string{"99999999999999999999999"},
+		})
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 100, filter.Limit)
+		assert.EqualValues(t, 1000, filter.Skip)
+
+		_, err = p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"ten"},
+		})
+
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrOutOfRange))
+
+		_, err = p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__skip":   []string{"-99999999999999999999999"},
+		})
+
+		assert.True(t, errors.Is(err, ErrOutOfRange))
+
+		// the negative values are never clamped
+		filter, err = p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"-1000000"},
+		})
+
+		assert.True(t, errors.Is(err, ErrOutOfRange))
+		assert.Contains(t, err.Error(), "-1000000 is less than 0")
+		assert.Zero(t, filter.Limit)
+	})
+
+	ts.Run("default limit", func(t *testing.T) {
 		t.Parallel()
 
+		p := p
+		p.DefaultLimit, p.MaxLimit = 20, 100
+
+		for _, limit := range []string{"", "0"} {
+			filter, err := p.Parse(url.Values{
+				"required": []string{"yes"},
+				"__limit":  []string{limit},
+			})
+
+			assert.NoError(t, err)
+			assert.EqualValues(t, 20, filter.Limit)
+		}
+
 		filter, err := p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"50"},
+		})
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 50, filter.Limit)
+
+		p.PartialResults = true
+
+		filter, err = p.Parse(url.Values{
+			"required": []string{"yes"},
+			"__limit":  []string{"ten"},
+		})
+
+		assert.Error(t, err)
+		assert.EqualValues(t, 20, filter.Limit)
+
+		p.DefaultLimit = 500
+
+		filter, err = p.Parse(url.Values{"required": []string{"yes"}})
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 100, filter.Limit)
+	})
+
+	ts.Run("sort without spec", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := partial.Parse(url.Values{
 			"required": []string{"no"},
-			"__sort":   []string{"field"},
+			"__sort":   []string{"field", "-required"},
 		})
 
 		assert.Error(t, err)
@@ -395,7 +832,8 @@ func TestParserParse(ts *testing.T) {
 		assert.False(t, filter.Filter["required"].(bool))
 		assert.Zero(t, filter.Limit)
 		assert.Zero(t, filter.Skip)
-		assert.Len(t, filter.Sort, 1)
+		assert.Equal(t, []map[string]interface{}{{"required": -1}},
+			filter.Sort)
 	})
 
 	ts.Run("error on AddSort()", func(t *testing.T) {
@@ -413,7 +851,7 @@ func TestParserParse(ts *testing.T) {
 	ts.Run("bad field conversion", func(t *testing.T) {
 		t.Parallel()
 
-		filter, err := p.Parse(url.Values{
+		filter, err := partial.Parse(url.Values{
 			"required": []string{"nope"},
 		})
 
@@ -426,6 +864,120 @@ func TestParserParse(ts *testing.T) {
 		assert.Nil(t, filter.Sort)
 	})
 
+	ts.Run("all the errors are joined", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"forbidden__bad": []string{"1"},
+			"unknown":        []string{"2"},
+			"__limit":        []string{"ten"},
+			"__sort":         []string{"nope"},
+		})
+
+		for _, target := range []error{
+			ErrUnknownOperator, ErrNoFieldSpec, ErrMissingField,
+			ErrNoSortField, strconv.ErrSyntax,
+		} {
+			assert.True(t, errors.Is(err, target), "%v: %v", target, err)
+		}
+
+		var joined interface{ Unwrap() []error }
+
+		assert.True(t, errors.As(err, &joined))
+		assert.Len(t, joined.Unwrap(), 5)
+
+		fields := map[string]string{}
+
+		for _, e := range joined.Unwrap() {
+			var parseErr ParseError
+			if errors.As(e, &parseErr) {
+				fields[parseErr.Field] = parseErr.Operator
+			}
+		}
+
+		assert.Equal(t, map[string]string{
+			"forbidden": "bad", "unknown": "eq", "required": "",
+		}, fields)
+
+		for _, msg := range []string{
+			"forbidden[bad]", "unknown[eq]", "required", "limit",
+			"nope",
+		} {
+			assert.Contains(t, err.Error(), msg)
+		}
+	})
+
+	ts.Run("structured errors", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"required": []string{"maybe"},
+			"__limit":  []string{"ten"},
+		})
+
+		var parseErr ParseError
+
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, "required", parseErr.Field)
+		assert.Equal(t, "eq", parseErr.Operator)
+		assert.Equal(t, []string{"maybe"}, parseErr.RawValues)
+		assert.True(t, errors.Is(parseErr, ErrNoMatch))
+
+		var parseErrs *ParseErrors
+
+		assert.True(t, errors.As(err, &parseErrs))
+		assert.Equal(t, err.Error(), parseErrs.Error())
+		assert.True(t, strings.HasPrefix(err.Error(), "parse: "))
+
+		all := parseErrs.Errors()
+		assert.Len(t, all, 3)
+
+		fields := make([]string, 0, len(all))
+
+		for _, e := range all {
+			fields = append(fields, e.Field)
+			assert.Error(t, e.Err)
+		}
+
+		assert.ElementsMatch(t, []string{"required", "required", ""},
+			fields)
+	})
+
+	ts.Run("zero query on error", func(t *testing.T) {
+		t.Parallel()
+
+		for _, query := range []url.Values{
+			{"required": {"yes"}, "__skip": {"bad"}, "__limit": {"10"}},
+			{"required": {"yes"}, "__limit": {"bad"}, "__skip": {"10"}},
+			{"required": {"yes"}, "__sort": {"field", "-required"}},
+			{"required": {"yes"}, "__sort": {"-forbidden"}},
+			{"required": {"yes"}, "unknown": {"1"}},
+			{"forbidden": {"1"}, "__limit": {"10"}},
+		} {
+			filter, err := p.Parse(query)
+
+			assert.Error(t, err, "query: %v", query)
+			assert.Zero(t, filter, "query: %v", query)
+		}
+	})
+
+	ts.Run("partial results on a missing required field",
+		func(t *testing.T) {
+			t.Parallel()
+
+			filter, err := partial.Parse(url.Values{
+				"forbidden": []string{"1"},
+				"__limit":   []string{"10"},
+				"__sort":    []string{"required"},
+			})
+
+			assert.True(t, errors.Is(err, ErrMissingField))
+			assert.Equal(t, M{"forbidden": int64(1)}, filter.Filter)
+			assert.EqualValues(t, 10, filter.Limit)
+			assert.Equal(t, []map[string]interface{}{{"required": 1}},
+				filter.Sort)
+		})
+
 	ts.Run("normal request", func(t *testing.T) {
 		t.Parallel()
 
@@ -443,188 +995,3720 @@ func TestParserParse(ts *testing.T) {
 	})
 }
 
-func TestParserParseMultivalue(ts *testing.T) {
+func TestParserParseRequiredGroups(ts *testing.T) {
 	ts.Parallel()
 
 	p := Parser{
 		Converter: NewDefaultConverter(testOidPrimitive{}),
-	}
-
+		Fields: Fields{
+			"customerId": Field{Converter: String(), DBName: "customer"},
+			"orderId":    Field{Converter: String()},
+			"price":      Field{Converter: Int()},
+			"currency": Field{
+				Converter:    String(),
+				RequiredWith: []string{"price", "total"},
+			},
+		},
+		RequireOneOf: [][]string{{"customerId", "orderId"}},
+	}
+
+	ts.Run("satisfied", func(t *testing.T) {
+		t.Parallel()
+
+		for _, query := range []string{
+			"customerId=1",
+			"orderId=2&customerId__ne=3",
+			"__or[0][customerId]=1&__or[1][customerId]=2",
+			"orderId=2&price__gt=10&currency=EUR",
+			"orderId=2&total=10&currency=EUR",
+			"orderId=2&currency=EUR",
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.NoError(t, err, query)
+		}
+	})
+
+	ts.Run("violated", func(t *testing.T) {
+		t.Parallel()
+
+		for query, missing := range map[string]string{
+			"price=10": "one of [customerId orderId]",
+			"__or[0][customerId]=1&__or[1][orderId]=2": "one of [customerId orderId]",
+			"orderId=2&price__gt=10":                   "currency",
+			"orderId=2&total=10":                       "required with total",
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, ErrMissingField), query)
+			assert.Contains(t, err.Error(), missing, query)
+		}
+
+		_, err := p.Parse(url.Values{"price": []string{"10"}})
+
+		var parseErrs *ParseErrors
+		if assert.True(t, errors.As(err, &parseErrs)) {
+			assert.Len(t, parseErrs.Errors(), 2)
+		}
+	})
+}
+
+func TestParserParseWildcardFields(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:      NewDefaultConverter(testOidPrimitive{}),
+		ValidateFields: true,
+		Fields: Fields{
+			"address.*":       Field{Converter: String(), Required: true},
+			"attributes.**":   Field{Converter: String()},
+			"attributes.size": Field{Converter: Int()},
+		},
+	}
+
+	ts.Run("child pattern", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"address[city]": []string{"Moscow"},
+			"__sort":        []string{"-address.city"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"address.city": "Moscow"}, q.Filter)
+		assert.Equal(t, []map[string]interface{}{{"address.city": -1}},
+			q.Sort)
+	})
+
+	ts.Run("child pattern does not match grandchildren", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"address[geo][lat]": []string{"1"}})
+		assert.True(t, errors.Is(err, ErrNoFieldSpec),
+			"unexpected err: %v", err)
+	})
+
+	ts.Run("descendant pattern with operators", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"attributes[color][name]__in": []string{"red,blue"},
+			"attributes.size__gte":        []string{"10"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"attributes.color.name": M{"$in": []interface{}{"red", "blue"}},
+			"attributes.size":       M{"$gte": int64(10)},
+		}, q.Filter)
+	})
+
+	ts.Run("sort fields patterns", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{
+			Converter:  NewDefaultConverter(testOidPrimitive{}),
+			SortFields: []string{"stats.*"},
+		}
+
+		q, err := p.Parse(url.Values{"__sort": []string{"stats.views"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"stats.views": 1}}, q.Sort)
+
+		_, err = p.Parse(url.Values{"__sort": []string{"stats.a.b"}})
+		assert.True(t, errors.Is(err, ErrNoSortField),
+			"unexpected err: %v", err)
+
+		_, err = p.Parse(url.Values{"__sort": []string{"stats.*"}})
+		assert.True(t, errors.Is(err, ErrNoSortField),
+			"unexpected err: %v", err)
+	})
+
+	ts.Run("patterns are not field names", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"address.*=x":             ErrNoFieldSpec,
+			"address.*__in=a,b":       ErrNoFieldSpec,
+			"attributes.**=x":         ErrNoFieldSpec,
+			"address[*]=x":            ErrNoFieldSpec,
+			"__sort=address.*":        ErrNoSortField,
+			"__sort=-attributes.**":   ErrNoSortField,
+			"__fields=address.*":      ErrNoProjectionField,
+			"__fields=-attributes.**": ErrNoProjectionField,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			// the required address pattern never blocks these errors
+			values.Set("address[city]", "Moscow")
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), "%s: %v", query, err)
+		}
+	})
+}
+
+func TestParserParseNestedSort(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:      NewDefaultConverter(testOidPrimitive{}),
+		ValidateFields: true,
+		Fields: Fields{
+			"address.city": Field{Converter: String()},
+		},
+	}
+
+	ts.Run("dotted sort field", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{"__sort": []string{"-address.city"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"address.city": -1}},
+			filter.Sort)
+	})
+
+	ts.Run("bracket sort field", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{
+			"address[city]": []string{"Paris"},
+			"__sort":        []string{"address[city]"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, M{"address.city": "Paris"}, filter.Filter)
+		assert.Equal(t, []map[string]interface{}{{"address.city": 1}},
+			filter.Sort)
+	})
+
+	ts.Run("dotted sort field without spec", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"__sort": []string{"address.zip"}})
+
+		assert.True(t, errors.Is(err, ErrNoSortField))
+		assert.Contains(t, err.Error(), "address.zip")
+	})
+
+	ts.Run("malformed bracket sort field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"__sort": []string{"address[city"}})
+
+		assert.True(t, errors.Is(err, ErrBadBrackets))
+	})
+
+	ts.Run("lenient bracket sort field", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.LenientBrackets = true
+
+		filter, err := p.Parse(url.Values{"__sort": []string{"address[city"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"address.city": 1}},
+			filter.Sort)
+	})
+}
+
+func TestParserParseSortFields(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:   NewDefaultConverter(testOidPrimitive{}),
+		SortFields:  []string{"created", "name"},
+		DefaultSort: []string{"-created", "_id"},
+		Fields: Fields{
+			"created": Field{Converter: Date(), DBName: "createdAt"},
+			"name":    Field{Converter: String()},
+			"status":  Field{Converter: String()},
+		},
+	}
+
+	ts.Run("default sort", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{"status": []string{"open"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{"createdAt": -1}, {"_id": 1},
+		}, filter.Sort)
+	})
+
+	ts.Run("requested sort", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{"__sort": []string{"name"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"name": 1}}, filter.Sort)
+	})
+
+	ts.Run("filter-only field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"__sort": []string{"-status"}})
+
+		assert.True(t, errors.Is(err, ErrNoSortField))
+		assert.Contains(t, err.Error(), "status is not in SortFields")
+
+		_, err = p.Parse(url.Values{"__sort": []string{"_id"}})
+
+		assert.True(t, errors.Is(err, ErrNoSortField))
+
+		p := p
+		p.SortFields, p.ValidateFields = nil, true
+
+		_, err = p.Parse(url.Values{"__sort": []string{"rank"}})
+
+		assert.True(t, errors.Is(err, ErrNoSortField))
+		assert.Contains(t, err.Error(), "rank is not in Fields")
+	})
+
+	ts.Run("sort-only field", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.SortFields = []string{"rank"}
+		p.ValidateFields = true
+
+		filter, err := p.Parse(url.Values{"__sort": []string{"-rank"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"rank": -1}}, filter.Sort)
+
+		_, err = p.Parse(url.Values{"rank": []string{"1"}})
+
+		assert.True(t, errors.Is(err, ErrNoFieldSpec))
+	})
+
+	ts.Run("max sort fields", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.MaxSortFields = 1
+		p.PartialResults = true
+
+		filter, err := p.Parse(url.Values{
+			"__sort": []string{"name:desc,-name,name"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"name": -1}}, filter.Sort)
+
+		filter, err = p.Parse(url.Values{
+			"__sort": []string{"created:asc,name"},
+		})
+
+		assert.True(t, errors.Is(err, ErrTooManySortFields))
+		assert.Equal(t, []map[string]interface{}{{"createdAt": 1}},
+			filter.Sort)
+	})
+
+	ts.Run("default sort without primitives", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{DefaultSort: []string{"_id"}}
+
+		_, err := p.Parse(url.Values{})
+
+		assert.True(t, errors.Is(err, ErrNoSortField))
+	})
+
+	ts.Run("empty field name", func(t *testing.T) {
+		t.Parallel()
+
+		// no fields spec, so any non-empty field name is sortable
+		p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+		for _, sort := range []string{
+			"", ":desc", ":asc", "-", "+", "a,,b", "a,", ",a", "-a,:desc",
+		} {
+			filter, err := p.Parse(url.Values{"__sort": []string{sort}})
+
+			assert.True(t, errors.Is(err, ErrNoSortField), "%q: %v", sort, err)
+			assert.Contains(t, err.Error(), "empty field name")
+			assert.Zero(t, filter, sort)
+		}
+	})
+}
+
+func TestParserParseCursor(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"created": Field{Converter: Date(), DBName: "createdAt"},
+			"name":    Field{Converter: String()},
+		},
+	}
+
+	day := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ts.Run("after and before", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]M{
+			"__sort=created&__after=2021-01-01": {
+				"createdAt": M{"$gt": day},
+			},
+			"__sort=-created&__after=2021-01-01": {
+				"createdAt": M{"$lt": day},
+			},
+			"__sort=created:desc&__before=2021-01-01": {
+				"createdAt": M{"$gt": day},
+			},
+			"__sort=name&__after=123&__before=200&name__ne=150": {
+				"name": M{"$gt": "123", "$lt": "200", "$ne": "150"},
+			},
+			"__sort=created&__after=2021-01-01&created__gte=2020-01-01": {
+				"createdAt": M{
+					"$gt":  day,
+					"$gte": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+			},
+			"__sort=name&__after=a&name=b": {
+				"name": M{"$eq": "b", "$gt": "a"},
+			},
+			"__sort=name&__after=a&name__gt=b": {
+				"name": M{"$gt": "b"},
+				"$and": []M{{"name": M{"$gt": "a"}}},
+			},
+			"__sort=-created&__after=2021-01-01&created__lt=2020-01-01": {
+				"createdAt": M{
+					"$lt": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				"$and": []M{{"createdAt": M{"$lt": day}}},
+			},
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			filter, err := p.Parse(values)
+			assert.NoError(t, err, query)
+			assert.Equal(t, expected, filter.Filter, query)
+		}
+	})
+
+	ts.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"__after=a":                           ErrBadCursor,
+			"__sort=name,created&__after=a":       ErrBadCursor,
+			"__sort=name&__after=a&__skip=10":     ErrBadCursor,
+			"__sort=created&__before=yesterday":   ErrNoMatch,
+			"__sort=name&__after=":                ErrEmptyValue,
+			"__sort=name&__after=a&__after=b":     ErrTooManyValues,
+			"__search=x&__sort=__score&__after=1": ErrBadCursor,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			p := p
+			p.AllowTextSearch = true
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), "%s: %v", query, err)
+		}
+	})
+
+	ts.Run("tokens", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.CursorTokens = true
+
+		q, err := p.Parse(url.Values{"__sort": []string{"-created,name"}})
+		assert.NoError(t, err)
+
+		token, err := CursorToken(q, M{"createdAt": day, "name": "bob"})
+		assert.NoError(t, err)
+
+		q, err = p.Parse(url.Values{
+			"__sort":  []string{"-created,name"},
+			"__after": []string{token},
+			"name":    []string{"x"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name": "x",
+			"$and": []M{{"$or": []M{
+				{"createdAt": M{"$lt": day}},
+				{"createdAt": day, "name": M{"$gt": "bob"}},
+			}}},
+		}, q.Filter)
+
+		token, err = CursorToken(q, map[string]interface{}{
+			"createdAt": day, "name": "bob",
+		})
+		assert.NoError(t, err)
+
+		q, err = p.Parse(url.Values{"__sort": []string{"name"}})
+		assert.NoError(t, err)
+
+		single, err := CursorToken(q, M{"name": "bob"})
+		assert.NoError(t, err)
+
+		q, err = p.Parse(url.Values{
+			"__sort":   []string{"name"},
+			"__before": []string{single},
+			"name__ne": []string{"ann"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": M{"$lt": "bob", "$ne": "ann"}}, q.Filter)
+
+		q, err = p.Parse(url.Values{
+			"__sort":   []string{"name"},
+			"__before": []string{single},
+			"name__lt": []string{"zed"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name": M{"$lt": "zed"},
+			"$and": []M{{"name": M{"$lt": "bob"}}},
+		}, q.Filter)
+
+		bad, err := CursorToken(Query{Sort: []M{{"createdAt": 1}}},
+			M{"createdAt": "yesterday"})
+		assert.NoError(t, err)
+
+		for query, expected := range map[string]error{
+			"__sort=name&__after=%21":                     ErrBadCursor,
+			"__sort=name&__after=e30":                     ErrBadCursor,
+			"__sort=name&__after=" + token:                ErrBadCursor,
+			"__sort=-name,created&__after=" + token:       ErrBadCursor,
+			"__sort=name&__after=" + single + "&__after=": ErrTooManyValues,
+			"__sort=created&__after=" + bad:               ErrNoMatch,
+			"__sort=name&__after=" + single + "&__skip=1": ErrBadCursor,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), "%s: %v", query, err)
+		}
+	})
+}
+
+//nolint:paralleltest
+func TestParserSignedCursor(t *testing.T) {
+	p := Parser{
+		Converter:    NewDefaultConverter(testOidPrimitive{}),
+		CursorTokens: true,
+		CursorKey:    []byte("secret"),
+	}
+
+	q, err := p.Parse(url.Values{"__sort": []string{"name"}})
+	assert.NoError(t, err)
+
+	signed, err := p.CursorToken(q, M{"name": "bob"})
+	assert.NoError(t, err)
+
+	q, err = p.Parse(url.Values{
+		"__sort":  []string{"name"},
+		"__after": []string{signed},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{"name": M{"$gt": "bob"}}, q.Filter)
+
+	unsigned, err := CursorToken(q, M{"name": "bob"})
+	assert.NoError(t, err)
+
+	tampered, err := CursorToken(q, M{"name": "zed"})
+	assert.NoError(t, err)
+
+	other := Parser{CursorKey: []byte("other")}
+
+	forged, err := other.CursorToken(q, M{"name": "bob"})
+	assert.NoError(t, err)
+
+	for _, token := range []string{
+		unsigned, forged, tampered + signed[len(unsigned):], signed + "x",
+	} {
+		_, err = p.Parse(url.Values{
+			"__sort":  []string{"name"},
+			"__after": []string{token},
+		})
+		assert.True(t, errors.Is(err, ErrInvalidCursor), "%s: %v", token, err)
+		assert.True(t, errors.Is(err, ErrBadCursor))
+	}
+}
+
+//nolint:paralleltest
+func TestCursorToken(t *testing.T) {
+	q := Query{Sort: []interface{}{
+		M{"a.b": -1}, testSortElem{Key: "_id", Value: 1},
+	}}
+
+	token, err := CursorToken(q, M{"a": M{"b": 1.5}, "_id": testHexID{}})
+	assert.NoError(t, err)
+
+	c, err := decodeCursorToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, cursorToken{
+		Fields: []string{"a.b", "_id"},
+		Values: []string{"1.5", "5f1d7a"},
+	}, c)
+
+	for name, doc := range map[string]interface{}{
+		"missing field":  M{"a": M{}},
+		"not a document": []int{1},
+		"bad value":      M{"a": M{"b": struct{}{}}, "_id": 1},
+	} {
+		_, err = CursorToken(q, doc)
+		assert.True(t, errors.Is(err, ErrBadCursor), "%s: %v", name, err)
+	}
+
+	for name, sort := range map[string]interface{}{
+		"no sort":  nil,
+		"score":    []M{{"score": M{"$meta": "textScore"}}},
+		"two keys": []M{{"a": 1, "b": 1}},
+	} {
+		_, err = CursorToken(Query{Sort: sort}, M{"a": 1})
+		assert.True(t, errors.Is(err, ErrBadCursor), "%s: %v", name, err)
+	}
+}
+
+func TestParserParsePage(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	ts.Run("pages", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]Query{
+			"__page=3&__per_page=25": {Limit: 25, Skip: 50, Page: 3},
+			"__page=1&__per_page=25": {Limit: 25, Page: 1},
+			"__per_page=10":          {Limit: 10, Page: 1},
+			"__page=2":               {Limit: 20, Skip: 20, Page: 2},
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			p := p
+			p.DefaultLimit = 20
+
+			filter, err := p.Parse(values)
+			assert.NoError(t, err, query)
+
+			filter.Filter = nil
+			assert.Equal(t, expected, filter, query)
+		}
+	})
+
+	ts.Run("maximum", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.MaxLimit, p.MaxSkip = 100, 1000
+
+		values := url.Values{
+			"__page":     []string{"12"},
+			"__per_page": []string{"100"},
+		}
+
+		_, err := p.Parse(values)
+		assert.True(t, errors.Is(err, ErrOutOfRange), "unexpected err: %v", err)
+
+		var rangeErr *RangeError
+		assert.True(t, errors.As(err, &rangeErr))
+		assert.Equal(t, RangeError{Param: "page", Value: "12", Max: 11},
+			*rangeErr)
+
+		p.ClampLimit = true
+		values.Set("__per_page", "1000")
+
+		filter, err := p.Parse(values)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 11, filter.Page)
+		assert.EqualValues(t, 100, filter.Limit)
+		assert.EqualValues(t, 1000, filter.Skip)
+
+		// the page size below 1 is never clamped
+		for _, perPage := range []string{"0", "-50"} {
+			values.Set("__page", "2")
+			values.Set("__per_page", perPage)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, ErrOutOfRange), perPage)
+			assert.Contains(t, err.Error(),
+				"per_page parameter: out of range: "+perPage+" is less than 1")
+		}
+	})
+
+	ts.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"__page=2&__skip=10":                      ErrBadPage,
+			"__page=2&__per_page=5&__limit=10":        ErrBadPage,
+			"__page=2":                                ErrBadPage,
+			"__page=0&__per_page=5":                   ErrOutOfRange,
+			"__page=-1&__per_page=5":                  ErrOutOfRange,
+			"__page=two&__per_page=5":                 strconv.ErrSyntax,
+			"__page=2&__per_page=5000":                ErrLimitTooLarge,
+			"__page=9223372036854775807&__per_page=2": ErrOutOfRange,
+			"__page=2&__per_page=0":                   ErrOutOfRange,
+			"__per_page=0":                            ErrOutOfRange,
+			"__page=2&__per_page=-50":                 ErrOutOfRange,
+			"__per_page=-99999999999999999999":        ErrOutOfRange,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			p := p
+			p.MaxLimit = 1000
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), "%s: %v", query, err)
+		}
+	})
+}
+
+//nolint:paralleltest
+func TestParserParseCount(t *testing.T) {
+	p := Parser{
+		Converter:    NewDefaultConverter(testOidPrimitive{}),
+		DefaultLimit: 20,
+	}
+
+	values := url.Values{"__count": []string{"true"}, "__skip": []string{"5"}}
+
+	q, err := p.Parse(values)
+	assert.NoError(t, err)
+	assert.True(t, q.CountOnly)
+	assert.EqualValues(t, 20, q.Limit)
+	assert.EqualValues(t, 5, q.Skip)
+
+	p.CountAll = true
+
+	q, err = p.Parse(values)
+	assert.NoError(t, err)
+	assert.Equal(t, Query{CountOnly: true}, q)
+
+	q, err = p.Parse(url.Values{"__count": []string{"false"}})
+	assert.NoError(t, err)
+	assert.False(t, q.CountOnly)
+	assert.EqualValues(t, 20, q.Limit)
+
+	_, err = p.Parse(url.Values{"__count": []string{"maybe"}})
+	assert.True(t, errors.Is(err, ErrNoMatch), "unexpected err: %v", err)
+
+	encoded, err := Query{CountOnly: true}.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, url.Values{"__count": {"true"}}, encoded)
+}
+
+func TestParserParseProjection(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:      NewDefaultConverter(testOidPrimitive{}),
+		ValidateFields: true,
+		Fields: Fields{
+			"name":         Field{Converter: String()},
+			"email":        Field{Converter: String()},
+			"address.city": Field{Converter: String()},
+		},
+	}
+
+	ts.Run("inclusion", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"__fields": []string{"name,-_id", "+email", "address[city]"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{
+			"name": 1, "email": 1, "address.city": 1, "_id": 0,
+		}, q.Projection)
+	})
+
+	ts.Run("exclusion", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"__fields": []string{"-name,-email"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"name": 0, "email": 0}, q.Projection)
+	})
+
+	ts.Run("no projection", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"name": []string{"x"}})
+		assert.NoError(t, err)
+		assert.Nil(t, q.Projection)
+	})
+
+	ts.Run("mixed inclusion and exclusion", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"__fields": []string{"name,-email"}})
+		assert.True(t, errors.Is(err, ErrMixedProjection))
+		assert.Zero(t, q)
+	})
+
+	ts.Run("unknown field", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.PartialResults = true
+
+		q, err := p.Parse(url.Values{"__fields": []string{"name,password"}})
+		assert.True(t, errors.Is(err, ErrNoProjectionField))
+		assert.Contains(t, err.Error(), "password")
+		assert.Equal(t, map[string]int{"name": 1}, q.Projection)
+	})
+
+	ts.Run("unknown field without validation", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.ValidateFields = false
+
+		q, err := p.Parse(url.Values{"__fields": []string{"password"}})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"password": 1}, q.Projection)
+	})
+
+	ts.Run("empty field name", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.ValidateFields = false
+
+		for _, fields := range []string{
+			"", "a,,b", "a,", ",a", "-", "+", "-name,-",
+		} {
+			q, err := p.Parse(url.Values{"__fields": []string{fields}})
+			assert.True(t, errors.Is(err, ErrNoProjectionField),
+				"%q: %v", fields, err)
+			assert.Contains(t, err.Error(), "empty field name")
+			assert.Zero(t, q, fields)
+		}
+	})
+}
+
+func TestParserParseAlias(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:      NewDefaultConverter(testOidPrimitive{}),
+		ValidateFields: true,
+		Fields: Fields{
+			"createdAt": Field{
+				Converter: Int(),
+				DBName:    "created_at",
+				Required:  true,
+			},
+			"created_at":        Field{Converter: Int()},
+			"user":              Field{DBName: "usr"},
+			"user.address.city": Field{Converter: String()},
+		},
+	}
+
+	ts.Run("filter and sort", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"createdAt__gte":          []string{"5"},
+			"user[address][city]__in": []string{"a,b"},
+			"__sort":                  []string{"-createdAt,user[address][city]"},
+			"__fields":                []string{"createdAt"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"created_at":       M{"$gte": int64(5)},
+			"usr.address.city": M{"$in": []interface{}{"a", "b"}},
+		}, q.Filter)
+		assert.Equal(t, []map[string]interface{}{
+			{"created_at": -1}, {"usr.address.city": 1},
+		}, q.Sort)
+		assert.Equal(t, map[string]int{"created_at": 1}, q.Projection)
+	})
+
+	ts.Run("dotted path in groups and cursors", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{
+			Converter: NewDefaultConverter(testOidPrimitive{}),
+			Fields: Fields{
+				"createdAt": Field{Converter: Int(), DBName: "meta.created_at"},
+			},
+		}
+
+		q, err := p.Parse(url.Values{
+			"__or[0][createdAt]":     []string{"1"},
+			"__or[1][createdAt__gt]": []string{"5"},
+			"__sort":                 []string{"-createdAt"},
+			"__after":                []string{"10"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"meta.created_at": M{"$lt": int64(10)},
+			"$or": []M{
+				{"meta.created_at": int64(1)},
+				{"meta.created_at": M{"$gt": int64(5)}},
+			},
+		}, q.Filter)
+		assert.Equal(t, []map[string]interface{}{{"meta.created_at": -1}},
+			q.Sort)
+	})
+
+	ts.Run("required alias", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"user[address][city]": []string{"x"}})
+
+		var parseErr ParseError
+
+		assert.True(t, errors.Is(err, ErrMissingField))
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, "createdAt", parseErr.Field)
+	})
+
+	ts.Run("validation uses the public name", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"createdAt": []string{"1"},
+			"usr":       []string{"x"},
+			"__sort":    []string{"usr.address.city"},
+		})
+		assert.True(t, errors.Is(err, ErrNoFieldSpec))
+		assert.True(t, errors.Is(err, ErrNoSortField))
+	})
+
+	ts.Run("alias and target conflict", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"createdAt":  []string{"1"},
+			"created_at": []string{"2"},
+		})
+		assert.True(t, errors.Is(err, ErrConflictingValues))
+
+		q, err := p.Parse(url.Values{
+			"createdAt":  []string{"1"},
+			"created_at": []string{"1"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"created_at": int64(1)}, q.Filter)
+	})
+}
+
+func TestParserParseNull(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"count":     Field{Converter: Int()},
+			"deletedAt": Field{Converter: Date()},
+		},
+	}
+
+	ts.Run("null operator", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"deletedAt__null": []string{"true"},
+			"count__null":     []string{"no"},
+			"other__null":     []string{"yes"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"deletedAt": nil,
+			"count":     M{"$ne": nil},
+			"other":     nil,
+		}, q.Filter)
+
+		_, err = p.Parse(url.Values{"count__null": []string{"maybe"}})
+		assert.True(t, errors.Is(err, ErrNoMatch))
+	})
+
+	ts.Run("null with other operators", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"count__null":   []string{"true"},
+			"count__exists": []string{"true"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"count": M{"$eq": nil, "$exists": true}},
+			q.Filter)
+
+		_, err = p.Parse(url.Values{
+			"count__null": []string{"true"},
+			"count":       []string{"5"},
+		})
+		assert.True(t, errors.Is(err, ErrConflictingValues))
+	})
+
+	ts.Run("null literal", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.NullLiteral = "null"
+
+		q, err := p.Parse(url.Values{
+			"count":         []string{"null"},
+			"deletedAt__ne": []string{"null"},
+			"name":          []string{"null"},
+			"tags__in":      []string{"null,x"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"count":     nil,
+			"deletedAt": M{"$ne": nil},
+			"name":      nil,
+			"tags":      M{"$in": []interface{}{"null", "x"}},
+		}, q.Filter)
+	})
+
+	ts.Run("null literal is disabled by default", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"name": []string{"null"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "null"}, q.Filter)
+
+		_, err = p.Parse(url.Values{"count": []string{"null"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestParserParseRange(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"price": Field{Converter: Int()},
+			"cost":  Field{Converter: Int(), DBName: "c"},
+		},
+	}
+
+	ts.Run("closed and open ranges", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"price__range": []string{"10,20"},
+			"cost__range":  []string{"5,"},
+			"size__range":  []string{",1.5"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"price": M{"$gte": int64(10), "$lte": int64(20)},
+			"c":     M{"$gte": int64(5)},
+			"size":  M{"$lte": 1.5},
+		}, q.Filter)
+	})
+
+	ts.Run("merge with other operators", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"price__range": []string{"10,20"},
+			"price__ne":    []string{"15"},
+			"price__gte":   []string{"10"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"price": M{
+			"$gte": int64(10),
+			"$lte": int64(20),
+			"$ne":  int64(15),
+		}}, q.Filter)
+
+		_, err = p.Parse(url.Values{
+			"price__range": []string{"10,20"},
+			"price__lte":   []string{"30"},
+		})
+		assert.True(t, errors.Is(err, ErrConflictingValues))
+	})
+
+	ts.Run("malformed ranges", func(t *testing.T) {
+		t.Parallel()
+
+		for val, expected := range map[string]error{
+			"10":     ErrBadRange,
+			",":      ErrBadRange,
+			"":       ErrBadRange,
+			"1,2,3":  ErrTooManyValues,
+			"1,x":    strconv.ErrSyntax,
+			"10,,20": ErrTooManyValues,
+		} {
+			_, err := p.Parse(url.Values{"price__range": []string{val}})
+			assert.True(t, errors.Is(err, expected), val)
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), val) {
+				assert.Equal(t, "price", parseErr.Field)
+				assert.Equal(t, "range", parseErr.Operator)
+			}
+		}
+
+		_, err := p.Parse(url.Values{"price__range": []string{"1,2", "3,4"}})
+		assert.True(t, errors.Is(err, ErrTooManyValues))
+	})
+}
+
+func TestParserParseBetween(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"price":   Field{Converter: Int(), DBName: "cost"},
+			"name":    Field{Converter: String()},
+			"updated": Field{Converter: Date(AcceptUnixSeconds)},
+		},
+	}
+
+	day := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	ts.Run("closed ranges", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"price__between":       []string{"10,20"},
+			"size__between":        []string{"1,2.5"},
+			"name__between":        []string{"a,m"},
+			"created__datebetween": []string{"2021-01-01,2021-01-31"},
+			"updated__datebetween": []string{"1609459200,2021-01-02"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"cost": M{"$gte": int64(10), "$lte": int64(20)},
+			"size": M{"$gte": int64(1), "$lte": 2.5},
+			"name": M{"$gte": "a", "$lte": "m"},
+			"created": M{
+				"$gte": day, "$lte": day.AddDate(0, 0, 30),
+			},
+			"updated": M{
+				"$gte": day, "$lte": day.AddDate(0, 0, 1),
+			},
+		}, q.Filter)
+	})
+
+	ts.Run("equal bounds", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"price__between": []string{"10,10"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"cost": M{"$gte": int64(10), "$lte": int64(10)}},
+			q.Filter)
+	})
+
+	ts.Run("negated", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"price__not__between": []string{"10,20"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"cost": M{"$not": M{
+			"$gte": int64(10), "$lte": int64(20),
+		}}}, q.Filter)
+	})
+
+	ts.Run("malformed ranges", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"price__between=10":                          ErrBadRange,
+			"price__between=10,":                         ErrBadRange,
+			"price__between=,20":                         ErrBadRange,
+			"price__between=":                            ErrBadRange,
+			"price__between=1,2,3":                       ErrTooManyValues,
+			"price__between=1,2&price__between=3,4":      ErrTooManyValues,
+			"price__between=1,x":                         strconv.ErrSyntax,
+			"price__between=20,10":                       ErrInvertedRange,
+			"name__between=m,a":                          ErrInvertedRange,
+			"size__between=2.5,1":                        ErrInvertedRange,
+			"created__datebetween=2021-02-01,2021-01-01": ErrInvertedRange,
+			"created__datebetween=10,20":                 ErrNoMatch,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected),
+				fmt.Sprintf("%s: %v", query, err))
+		}
+
+		_, err := p.Parse(url.Values{"price__between": []string{"20,10"}})
+		assert.True(t, errors.Is(err, ErrBadRange))
+
+		var parseErr ParseError
+		if assert.True(t, errors.As(err, &parseErr)) {
+			assert.Equal(t, "price", parseErr.Field)
+			assert.Equal(t, "between", parseErr.Operator)
+		}
+	})
+
+	ts.Run("incomparable bounds", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"size__between": []string{"b,1"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"size": M{"$gte": "b", "$lte": int64(1)}}, q.Filter)
+	})
+}
+
+func TestParserParseUnixDate(t *testing.T) {
+	t.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"updated": Field{Converter: Date(AcceptUnixSeconds, AcceptUnixMillis)},
+		},
+	}
+
+	q, err := p.Parse(url.Values{
+		"updated__gte": []string{"1672531200"},
+		"updated__lt":  []string{"1672617600000"},
+		"count__gte":   []string{"1672531200"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{
+		"updated": M{
+			"$gte": time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+			"$lt":  time.Date(2023, time.January, 2, 0, 0, 0, 0, time.UTC),
+		},
+		"count": M{"$gte": int64(1672531200)},
+	}, q.Filter)
+}
+
+func TestParserParseSizeType(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields:    Fields{"tags": Field{Converter: String()}},
+	}
+
+	ts.Run("size and type", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"tags__size":    []string{"3"},
+			"tags__type":    []string{"array"},
+			"tags__exists":  []string{"true"},
+			"other__type":   []string{"objectId"},
+			"other__ne":     []string{"x"},
+			"missing__size": []string{"0"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"tags": M{
+				"$size":   int64(3),
+				"$type":   "array",
+				"$exists": true,
+			},
+			"other":   M{"$type": "objectId", "$ne": "x"},
+			"missing": M{"$size": int64(0)},
+		}, q.Filter)
+	})
+
+	ts.Run("bad values", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"tags__size=x":              strconv.ErrSyntax,
+			"tags__size=-1":             ErrOutOfRange,
+			"tags__size=1.5":            strconv.ErrSyntax,
+			"tags__size=1&tags__size=2": ErrTooManyValues,
+			"tags__type=text":           ErrNoMatch,
+			"tags__type=String":         ErrNoMatch,
+			"tags__type=":               ErrNoMatch,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), query)
+		}
+	})
+}
+
+func TestParserParseModBits(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields:    Fields{"seq": Field{Converter: String()}},
+	}
+
+	ts.Run("conditions", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{
+			"seq__mod":         []string{"4,1"},
+			"seq__gte":         []string{"10"},
+			"flags__banyset":   []string{"5"},
+			"flags__ballset":   []string{"1,4"},
+			"flags__ne":        []string{"0"},
+			"perms__banyclear": []string{"0"},
+			"perms__ballclear": []string{"2", "3"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"seq": M{
+				"$mod": []interface{}{int64(4), int64(1)},
+				"$gte": "10",
+			},
+			"flags": M{
+				"$bitsAnySet": int64(5),
+				"$bitsAllSet": []interface{}{int64(1), int64(4)},
+				"$ne":         int64(0),
+			},
+			"perms": M{
+				"$bitsAnyClear": int64(0),
+				"$bitsAllClear": []interface{}{int64(2), int64(3)},
+			},
+		}, filter.Filter)
+	})
+
+	ts.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"seq__mod=4":         ErrBadModArgs,
+			"seq__mod=0,1":       ErrBadModArgs,
+			"seq__mod=4,1,2":     ErrTooManyValues,
+			"seq__mod=4,1,3":     ErrBadModArgs,
+			"seq__mod=4,x":       strconv.ErrSyntax,
+			"seq__mod=4.5,1":     strconv.ErrSyntax,
+			"flags__banyset=-1":  ErrOutOfRange,
+			"flags__ballset=1,x": strconv.ErrSyntax,
+			"flags__ballclear=":  strconv.ErrSyntax,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), "%s: %v", query, err)
+		}
+	})
+}
+
+func TestParserParseGeo(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields:    Fields{"location": Field{Converter: String(), DBName: "loc"}},
+	}
+
+	ts.Run("near and geowithin", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"location__near":   []string{"37.61,55.75,5000"},
+			"area__GeoWithin":  []string{"-73.9,40.7,6378.1"},
+			"spot__nearsphere": []string{"2.35,48.85,100"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"loc": M{"$near": M{
+				"$geometry": M{
+					"type":        "Point",
+					"coordinates": []interface{}{37.61, 55.75},
+				},
+				"$maxDistance": 5000.0,
+			}},
+			"spot": M{"$nearSphere": M{
+				"$geometry": M{
+					"type":        "Point",
+					"coordinates": []interface{}{2.35, 48.85},
+				},
+				"$maxDistance": 100.0,
+			}},
+			"area": M{"$geoWithin": M{"$centerSphere": []interface{}{
+				[]interface{}{-73.9, 40.7}, 0.001,
+			}}},
+		}, q.Filter)
+	})
+
+	ts.Run("bad values", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"location__near=37.61,55.75":                          ErrBadCoordinates,
+			"location__near=37.61,55.75,1,2":                      ErrBadCoordinates,
+			"location__near=":                                     ErrBadCoordinates,
+			"location__near=east,55.75,1":                         strconv.ErrSyntax,
+			"location__geowithin=1,2,x":                           ErrBadCoordinates,
+			"location__near=181,0,1":                              ErrOutOfRange,
+			"location__near=0,-91,1":                              ErrOutOfRange,
+			"location__near=NaN,NaN,Inf":                          ErrBadCoordinates,
+			"location__near=0,0,Inf":                              ErrBadCoordinates,
+			"location__geowithin=0,NaN,1":                         ErrBadCoordinates,
+			"location__geowithin=0,0,-1":                          ErrOutOfRange,
+			"location__near=1,2,3&location__near=1,2,4":           ErrTooManyValues,
+			"location__geowithin=1,2,3&location__geowithin=1,2,3": ErrTooManyValues,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), query)
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), query) {
+				assert.Equal(t, "location", parseErr.Field, query)
+			}
+		}
+	})
+
+	ts.Run("within", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"location__within": []string{"2.2,48.8,2.5,48.9"},
+			"area__within":     []string{"0,0,3,6,6,1"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"loc": M{"$geoWithin": M{"$box": []interface{}{
+				[]interface{}{2.2, 48.8}, []interface{}{2.5, 48.9},
+			}}},
+			"area": M{"$geoWithin": M{"$polygon": []interface{}{
+				[]interface{}{0.0, 0.0}, []interface{}{3.0, 6.0},
+				[]interface{}{6.0, 1.0},
+			}}},
+		}, q.Filter)
+
+		for query, expected := range map[string]error{
+			"location__within=1,2,3":         ErrBadCoordinates,
+			"location__within=1,2,3,4,5":     ErrBadCoordinates,
+			"location__within=1,2,3,4,5,6,7": ErrBadCoordinates,
+			"location__within=3,2,1,4":       ErrBadCoordinates,
+			"location__within=1,x,3,4":       strconv.ErrSyntax,
+			"location__within=1,2,181,4":     ErrOutOfRange,
+			"location__within=0,0,1,1,1,91":  ErrOutOfRange,
+			"location__within=NaN,0,1,1":     ErrBadCoordinates,
+			"location__within=0,0,1,Inf":     ErrBadCoordinates,
+			"location__within=0,0,1,1,NaN,1": ErrBadCoordinates,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), "%s: %v", query, err)
+		}
+	})
+
+	ts.Run("geo point fields", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{
+			Converter: NewDefaultConverter(testOidPrimitive{}),
+			Fields: Fields{
+				"location": Field{GeoPoint: true},
+				"name":     Field{Converter: String()},
+			},
+			ValidateFields: true,
+		}
+
+		q, err := p.Parse(url.Values{
+			"location__nearsphere": []string{"2.35,48.85,5000"},
+		})
+		assert.NoError(t, err)
+		assert.Contains(t, q.Filter["location"], "$nearSphere")
+
+		for _, key := range []string{
+			"name__near", "name__nearsphere", "name__geowithin",
+			"name__within",
+		} {
+			_, err = p.Parse(url.Values{key: []string{"2.35,48.85,5000"}})
+			assert.True(t, errors.Is(err, ErrNotGeoPoint), key)
+		}
+	})
+}
+
+func TestParserParseTextSearch(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:       NewDefaultConverter(testOidPrimitive{}),
+		Fields:          Fields{"name": Field{Converter: String()}},
+		ValidateFields:  true,
+		AllowTextSearch: true,
+	}
+
+	ts.Run("search", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"__search":      []string{"coffee", " shop ", ""},
+			"__search_lang": []string{"en"},
+			"__sort":        []string{"__score,-name"},
+			"name__ne":      []string{"closed"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"$text": M{"$search": "coffee shop", "$language": "en"},
+			"name":  M{"$ne": "closed"},
+		}, q.Filter)
+		assert.Equal(t, []M{
+			{"score": M{"$meta": "textScore"}},
+			{"name": -1},
+		}, q.Sort)
+	})
+
+	ts.Run("sensitivity flags", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"__search":           []string{"café"},
+			"__search_case":      []string{"true"},
+			"__search_diacritic": []string{"false"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"$text": M{
+			"$search":             "café",
+			"$caseSensitive":      true,
+			"$diacriticSensitive": false,
+		}}, q.Filter)
+	})
+
+	ts.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		for query, expected := range map[string]error{
+			"__search=x&__search_case=maybe":  ErrNoMatch,
+			"__search=x&__search_diacritic=2": ErrNoMatch,
+			"__search=":                       ErrEmptyValue,
+			"__search=+&__search=":            ErrEmptyValue,
+			"__sort=__score":                  ErrNoSortField,
+			"__sort=-__score&name=x":          ErrNoSortField,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected), query)
+		}
+	})
+
+	ts.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		disabled := Parser{StrictDirectives: true}
+
+		_, err := disabled.Parse(url.Values{"__search": []string{"coffee"}})
+		assert.True(t, errors.Is(err, ErrTextSearchDisabled))
+		assert.False(t, errors.Is(err, ErrUnknownDirective))
+
+		q, err := disabled.Parse(url.Values{"__search_lang": []string{"en"}})
+		assert.NoError(t, err)
+		assert.Nil(t, q.Filter)
+	})
+}
+
+func TestParserParseNegatedPatterns(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	ts.Run("single negation", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"name__nco":   []string{"a.b"},
+			"code__insw":  []string{"^x"},
+			"email__nre":  []string{"@test$"},
+			"email__ne":   []string{"me@example.com"},
+			"title__inco": []string{"draft"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name": M{"$not": testRegEx{regex: `a\.b`}},
+			"code": M{"$not": testRegEx{regex: "^x", options: "i"}},
+			"email": M{
+				"$not": testRegEx{regex: "@test$"},
+				"$ne":  "me@example.com",
+			},
+			"title": M{"$not": testRegEx{regex: "draft", options: "i"}},
+		}, q.Filter)
+	})
+
+	ts.Run("multiple negations", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"name__ncoin": []string{"a,b"},
+			"name__nsw":   []string{"c"},
+			"tag__nco":    []string{"x"},
+			"tag__nre":    []string{"y"},
+			"kind__nin":   []string{"d,e"},
+			"kind__nco[]": []string{"f"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name": M{"$nin": []interface{}{
+				testRegEx{regex: "a"}, testRegEx{regex: "b"},
+				testRegEx{regex: "^c"},
+			}},
+			"tag": M{"$nin": []interface{}{
+				testRegEx{regex: "x"}, testRegEx{regex: "y"},
+			}},
+			"kind": M{"$nin": []interface{}{
+				testRegEx{regex: "f"}, "d", "e",
+			}},
+		}, q.Filter)
+	})
+
+	ts.Run("empty values", func(t *testing.T) {
+		t.Parallel()
+
+		for _, key := range []string{"name__nco", "name__nre", "name__insw"} {
+			_, err := p.Parse(url.Values{key: []string{""}})
+			assert.True(t, errors.Is(err, ErrEmptyValue), key)
+		}
+	})
+}
+
+func TestParserParseNot(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"age":  Field{Converter: Int()},
+			"name": Field{Converter: String()},
+			"tags": Field{Converter: String()},
+			"born": Field{Converter: Date()},
+		},
+		ValidateFields: true,
+	}
+
+	ts.Run("wrapped conditions", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"age__not__gt":      []string{"30"},
+			"age__ne":           []string{"5"},
+			"tags__not__all":    []string{"a,b"},
+			"name__NOT__exists": []string{"true"},
+			"born__not__range":  []string{"2020-01-01T00:00:00Z,2021-01-01T00:00:00Z"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"age":  M{"$not": M{"$gt": int64(30)}, "$ne": int64(5)},
+			"tags": M{"$not": M{"$all": []interface{}{"a", "b"}}},
+			"name": M{"$not": M{"$exists": true}},
+			"born": M{"$not": M{
+				"$gte": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+				"$lte": time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+			}},
+		}, q.Filter)
+	})
+
+	ts.Run("built-in negations", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"name__not__re": []string{"foo.*"},
+			"tags__not__in": []string{"a,b"},
+			"age__not__eq":  []string{"3"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name": M{"$not": testRegEx{regex: "foo.*"}},
+			"tags": M{"$nin": []interface{}{"a", "b"}},
+			"age":  M{"$ne": int64(3)},
+		}, q.Filter)
+	})
+
+	ts.Run("invalid negations", func(t *testing.T) {
+		t.Parallel()
+
+		for _, key := range []string{
+			"name__not__null", "name__not__near", "name__not__not__gt",
+			"name__not__foo", "name__not",
+		} {
+			_, err := p.Parse(url.Values{key: []string{"1"}})
+			assert.True(t, errors.Is(err, ErrUnknownOperator),
+				"key %s: unexpected err: %v", key, err)
+		}
+	})
+
+	ts.Run("conflicting negations", func(t *testing.T) {
+		t.Parallel()
+
+		for _, other := range []string{"name__nsw", "name__not__lt"} {
+			_, err := p.Parse(url.Values{
+				"name__not__gt": []string{"a"},
+				other:           []string{"b"},
+			})
+			assert.True(t, errors.Is(err, ErrConflictingValues),
+				"key %s: unexpected err: %v", other, err)
+		}
+	})
+}
+
+func TestParserParseEqualFold(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	ts.Run("single and multiple values", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"email__ieq":   []string{"Foo@Bar.com"},
+			"user__ieqin":  []string{"Ann,^bob$"},
+			"login__ieq[]": []string{"a+b"},
+			"login__ne":    []string{"root"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"email": M{"$eq": testRegEx{regex: `^Foo@Bar\.com$`, options: "i"}},
+			"user": M{"$in": []interface{}{
+				testRegEx{regex: "^Ann$", options: "i"},
+				testRegEx{regex: `^\^bob\$$`, options: "i"},
+			}},
+			"login": M{
+				"$eq": testRegEx{regex: `^a\+b$`, options: "i"},
+				"$ne": "root",
+			},
+		}, q.Filter)
+	})
+
+	ts.Run("no primitives", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{Converter: NewDefaultConverter(nil)}
+
+		_, err := p.Parse(url.Values{"email__ieq": []string{"a@b.c"}})
+		assert.True(t, errors.Is(err, ErrNoConverter))
+	})
+}
+
+func TestParserParseRegexSafety(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:      NewDefaultConverter(testOidPrimitive{}),
+		ValidateRegex:  true,
+		MaxRegexLength: 16,
+	}
+
+	ts.Run("valid patterns", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"name__ire":  []string{"^jo(hn|e)$"},
+			"tags__rein": []string{"a+,b*"},
+			"code__co":   []string{"(unbalanced"},
+			"path__sw":   []string{"[x"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, testRegEx{regex: "^jo(hn|e)$", options: "i"},
+			q.Filter["name"].(M)["$eq"])
+	})
+
+	ts.Run("bad patterns", func(t *testing.T) {
+		t.Parallel()
+
+		for key, val := range map[string]string{
+			"name__re":   "(unbalanced",
+			"name__ire":  "[x",
+			"name__rein": "a,b)",
+			"name__re[]": "*",
+			"name__nre":  "x{2,1}",
+		} {
+			_, err := p.Parse(url.Values{key: []string{val}})
+			assert.True(t, errors.Is(err, ErrBadRegex), key)
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), key) {
+				assert.Equal(t, "name", parseErr.Field)
+			}
+		}
+	})
+
+	ts.Run("long patterns", func(t *testing.T) {
+		t.Parallel()
+
+		long := strings.Repeat("a", 17)
+
+		_, err := p.Parse(url.Values{"name__re": []string{long}})
+		assert.True(t, errors.Is(err, ErrRegexTooLong))
+
+		_, err = p.Parse(url.Values{"name__rein": []string{"a," + long}})
+		assert.True(t, errors.Is(err, ErrRegexTooLong))
+
+		_, err = p.Parse(url.Values{"name__co": []string{long}})
+		assert.NoError(t, err)
+	})
+
+	ts.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+		_, err := p.Parse(url.Values{
+			"name__re": []string{"(unbalanced" + strings.Repeat("a", 100)},
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func TestParserParseNumericFields(t *testing.T) {
+	t.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testExtendedPrimitive{}),
+		Fields: Fields{
+			"price":   Field{Converter: Decimal(testExtendedPrimitive{})},
+			"counter": Field{Converter: Int32()},
+			"zip":     Field{Converter: NumericString()},
+		},
+	}
+
+	filter, err := p.Parse(url.Values{
+		"price__gte":  []string{"9.99"},
+		"counter__in": []string{"1,2"},
+		"zip":         []string{"00420"},
+		"other":       []string{"00420"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{
+		"price":   M{"$gte": testDecimal{dec: "9.99"}},
+		"counter": M{"$in": []interface{}{int32(1), int32(2)}},
+		"zip":     "00420",
+		"other":   int64(420),
+	}, filter.Filter)
+
+	_, err = p.Parse(url.Values{"counter": []string{"3000000000"}})
+	assert.True(t, errors.Is(err, strconv.ErrRange))
+
+	_, err = p.Parse(url.Values{"zip": []string{"0042O"}})
+	assert.True(t, errors.Is(err, ErrNoMatch))
+}
+
+func TestParserParseEnum(t *testing.T) {
+	t.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testExtendedPrimitive{}),
+		Fields: Fields{
+			"status": Field{Converter: EnumIgnoreCase("active", "blocked")},
+			"ref":    Field{Converter: UUID(testExtendedPrimitive{})},
+		},
+	}
+
+	filter, err := p.Parse(url.Values{
+		"status__in": []string{"Active,BLOCKED"},
+		"ref":        []string{"00000000000000000000000000000001"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{
+		"status": M{"$in": []interface{}{"active", "blocked"}},
+		"ref": testBinary{
+			subtype: 4,
+			data:    append(make([]byte, 15), 1),
+		},
+	}, filter.Filter)
+
+	_, err = p.Parse(url.Values{"status__in": []string{"active,deleted"}})
+	assert.True(t, errors.Is(err, ErrNoMatch))
+	assert.Contains(t, err.Error(), `"deleted"`)
+}
+
+func TestParserParseEmptyValues(ts *testing.T) {
+	ts.Parallel()
+
+	fields := Fields{
+		"id":      Field{Converter: Int()},
+		"name":    Field{Converter: String(), Required: true},
+		"comment": Field{Converter: String(), AllowEmpty: true},
+	}
+
+	ts.Run("keep", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{Fields: fields}
+
+		filter, err := p.Parse(url.Values{
+			"name": []string{""}, "comment": []string{""},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "", "comment": ""}, filter.Filter)
+
+		_, err = p.Parse(url.Values{
+			"name": []string{"x"}, "id__in": []string{"1,,2"},
+		})
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	})
+
+	ts.Run("ignore", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{
+			Converter:   NewDefaultConverter(nil),
+			Fields:      fields,
+			EmptyValues: EmptyIgnore,
+		}
+
+		filter, err := p.Parse(url.Values{
+			"name":         []string{"x"},
+			"id__in":       []string{"1,,2"},
+			"id[]":         []string{"", "3"},
+			"id__ne":       []string{""},
+			"comment":      []string{""},
+			"other__range": []string{"1,"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name":    "x",
+			"id":      M{"$in": []interface{}{int64(3), int64(1), int64(2)}},
+			"comment": "",
+			"other":   M{"$gte": int64(1)},
+		}, filter.Filter)
+
+		_, err = p.Parse(url.Values{"name": []string{""}})
+		assert.True(t, errors.Is(err, ErrMissingField))
+	})
+
+	ts.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{Fields: fields, EmptyValues: EmptyError}
+
+		for _, query := range []string{
+			"name=", "name=x&id__in=1,,2", "name=x&id[]=&id[]=1", "name=x&id__gt=",
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, ErrEmptyValue), query)
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), query) {
+				assert.NotEmpty(t, parseErr.Field, query)
+			}
+		}
+
+		filter, err := p.Parse(url.Values{
+			"name": []string{"x"}, "comment": []string{""},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "x", "comment": ""}, filter.Filter)
+	})
+}
+
+func TestParserParseNoRegex(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"description": Field{Converter: String(), NoRegex: true},
+			"title":       Field{Converter: String()},
+		},
+	}
+
+	ts.Run("allowed", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{
+			"description__isw": []string{"abc"},
+			"description__ne":  []string{"x"},
+			"title__co":        []string{"abc"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"description": M{
+				"$eq": testRegEx{regex: "^abc", options: "i"},
+				"$ne": "x",
+			},
+			"title": M{"$eq": testRegEx{regex: "abc"}},
+		}, filter.Filter)
+	})
+
+	ts.Run("forbidden", func(t *testing.T) {
+		t.Parallel()
+
+		for _, key := range []string{
+			"description__co", "description__ico[]", "description__re",
+			"description__irein", "description__nco", "description__nre[]",
+		} {
+			_, err := p.Parse(url.Values{key: []string{"abc"}})
+			assert.True(t, errors.Is(err, ErrExpensiveOperator), key)
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), key) {
+				assert.Equal(t, "description", parseErr.Field, key)
+				assert.NotEmpty(t, parseErr.Operator, key)
+			}
+		}
+	})
+}
+
+func TestParserParseAllowedOperators(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"status": Field{
+				Converter:        String(),
+				AllowedOperators: []string{"eq", "in", "nin", "not__gt"},
+			},
+			"title": Field{Converter: String()},
+		},
+	}
+
+	ts.Run("allowed", func(t *testing.T) {
+		t.Parallel()
+
+		filter, err := p.Parse(url.Values{
+			"status[]":        []string{"a", "b"},
+			"__or[0][status]": []string{"c"},
+			"title__co":       []string{"x"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"status": M{"$in": []interface{}{"a", "b"}},
+			"title":  M{"$eq": testRegEx{regex: "x"}},
+			"$or":    []M{{"status": "c"}},
+		}, filter.Filter)
+
+		filter, err = p.Parse(url.Values{
+			"status__not__in": []string{"a,b"},
+			"status__not__gt": []string{"c"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"status": M{
+			"$nin": []interface{}{"a", "b"},
+			"$not": M{"$gt": "c"},
+		}}, filter.Filter)
+	})
+
+	ts.Run("forbidden", func(t *testing.T) {
+		t.Parallel()
+
+		for _, key := range []string{
+			"status__co", "status__re", "status__ne", "status__gt",
+			"status__not__eq", "status__not__lt", "__or[0][status__ico]",
+		} {
+			_, err := p.Parse(url.Values{key: []string{"abc"}})
+			assert.True(t, errors.Is(err, ErrOperatorNotAllowed), key)
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), key) {
+				assert.Equal(t, "status", parseErr.Field, key)
+				assert.NotEmpty(t, parseErr.Operator, key)
+			}
+		}
+	})
+}
+
+func TestParserParseDefault(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"status": Field{
+				Converter: String(),
+				Default:   &FieldDefault{Value: "active"},
+			},
+			"deleted": Field{
+				Converter: Bool(),
+				DBName:    "deletedAt",
+				Default:   &FieldDefault{Operator: "null", Value: "true"},
+			},
+			"name": Field{Converter: String()},
+		},
+	}
+
+	ts.Run("added", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"name": []string{"x"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"name":      "x",
+			"status":    "active",
+			"deletedAt": nil,
+		}, q.Filter)
+
+		q, err = p.Parse(url.Values{})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"status": "active", "deletedAt": nil}, q.Filter)
+	})
+
+	ts.Run("replaced", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"status__in":             []string{"active,blocked"},
+			"__or[0][deleted__null]": []string{"false"},
+			"__or[1][name]":          []string{"x"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"status": M{"$in": []interface{}{"active", "blocked"}},
+			"$or": []M{
+				{"deletedAt": M{"$ne": nil}},
+				{"name": "x"},
+			},
+		}, q.Filter)
+	})
+
+	ts.Run("bad default", func(t *testing.T) {
+		t.Parallel()
+
+		p := Parser{
+			Converter: NewDefaultConverter(testOidPrimitive{}),
+			Fields: Fields{"age": Field{
+				Converter: Int(),
+				Default:   &FieldDefault{Operator: "gte", Value: "x"},
+			}},
+		}
+
+		_, err := p.Parse(url.Values{})
+		assert.True(t, errors.Is(err, strconv.ErrSyntax),
+			"unexpected err: %v", err)
+	})
+}
+
+//nolint:paralleltest
+func TestParserParseDisabledOperators(t *testing.T) {
+	p := Parser{
+		Converter:         NewDefaultConverter(testOidPrimitive{}),
+		DisabledOperators: []string{"re", "co", "gt"},
+	}
+
+	filter, err := p.Parse(url.Values{
+		"name__sw":   []string{"a"},
+		"title__ico": []string{"b"},
+		"age__gte":   []string{"1"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{
+		"name":  M{"$eq": testRegEx{regex: "^a"}},
+		"title": M{"$eq": testRegEx{regex: "b", options: "i"}},
+		"age":   M{"$gte": int64(1)},
+	}, filter.Filter)
+
+	for _, key := range []string{
+		"name__re", "name__co", "age__gt", "age__not__gt",
+		"__or[0][name__co]", "items__elem[name__re]",
+	} {
+		_, err = p.Parse(url.Values{key: []string{"1"}})
+		assert.True(t, errors.Is(err, ErrOperatorDisabled), key)
+		assert.False(t, errors.Is(err, ErrOperatorNotAllowed), key)
+	}
+
+	_, err = p.Parse(url.Values{
+		"__sort":  []string{"age"},
+		"__after": []string{"1"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestParserParseMaxArrayValues(t *testing.T) {
+	t.Parallel()
+
+	p := Parser{
+		Converter:      NewDefaultConverter(testOidPrimitive{}),
+		MaxArrayValues: 3,
+	}
+
+	q, err := p.Parse(url.Values{
+		"a__in":   []string{"1,2"},
+		"a[]":     []string{"3"},
+		"b__nin":  []string{"1,2,3"},
+		"b__all":  []string{"4,5,6"},
+		"c__rein": []string{"x,y"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(3), int64(1), int64(2)},
+		q.Filter["a"].(M)["$in"])
+
+	for _, query := range []string{
+		"a__in=1,2,3,4",
+		"a__in=1,2&a[]=3&a[]=4",
+		"a__in=1&a__in=2&a__in=3&a__in=4",
+		"a__all=1,2,3,4",
+		"a__ncoin=1,2,3,4",
+	} {
+		values, err := url.ParseQuery(query)
+		assert.NoError(t, err)
+
+		_, err = p.Parse(values)
+		assert.True(t, errors.Is(err, ErrTooManyArrayValues), query)
+
+		var parseErr ParseError
+		if assert.True(t, errors.As(err, &parseErr), query) {
+			assert.Equal(t, "a", parseErr.Field)
+			assert.Equal(t, 4, parseErr.Count)
+		}
+	}
+
+	// the limit is per field and per operator
+	_, err = p.Parse(url.Values{
+		"a__in":  []string{"1,2,3"},
+		"a__nin": []string{"4,5,6"},
+		"b__in":  []string{"1,2,3"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestParserParseStrictDirectives(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:        NewDefaultConverter(testOidPrimitive{}),
+		Fields:           Fields{"a__b": Field{}},
+		StrictDirectives: true,
+	}
+
+	ts.Run("known directives", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"a__b__gte":       []string{"1"},
+			"__limit":         []string{"10"},
+			"__skip":          []string{"10"},
+			"__sort":          []string{"a"},
+			"__fields":        []string{"a"},
+			"__or[0][status]": []string{"open"},
+		})
+		assert.NoError(t, err)
+	})
+
+	ts.Run("unknown directives", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"__limt":  []string{"10"},
+			"__srot":  []string{"name"},
+			"__":      []string{"x"},
+			"__LIMIT": []string{"10"},
+			"__ora":   []string{"x"},
+		})
+		assert.True(t, errors.Is(err, ErrUnknownDirective))
+
+		for _, key := range []string{"__limt", "__srot", "__LIMIT", "__ora"} {
+			assert.Contains(t, err.Error(), "unknown directive: "+key)
+		}
+
+		var parseErrs *ParseErrors
+
+		assert.True(t, errors.As(err, &parseErrs))
+		assert.Len(t, parseErrs.Errors(), 5)
+	})
+
+	ts.Run("unknown directives are ignored by default", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.StrictDirectives = false
+
+		_, err := p.Parse(url.Values{"__limt": []string{"10"}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestParserParseMultivalue(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+	}
+
 	ts.Run("__in with single value should be treated as eq",
 		func(t *testing.T) {
 			t.Parallel()
 
-			q, err := p.Parse(url.Values{"field__in": []string{"a"}})
-			assert.NoError(t, err)
-			assert.Equal(t, M{"field": "a"}, q.Filter)
+			q, err := p.Parse(url.Values{"field__in": []string{"a"}})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"field": "a"}, q.Filter)
+		})
+
+	ts.Run("__nin with single value should be treated as ne",
+		func(t *testing.T) {
+			t.Parallel()
+
+			q, err := p.Parse(url.Values{"field__nin": []string{"abc"}})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"field": M{"$ne": "abc"}}, q.Filter)
+		})
+
+	ts.Run("__nin with multiple values stays nin", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"field__nin": []string{"a,b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"field": M{"$nin": []interface{}{"a", "b"}}},
+			q.Filter)
+	})
+
+	ts.Run("__nin with single value and __ne on the same field",
+		func(t *testing.T) {
+			t.Parallel()
+
+			q, err := p.Parse(url.Values{
+				"field__nin": []string{"a"},
+				"field__ne":  []string{"b"},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"field": M{
+				"$ne":  "b",
+				"$nin": []interface{}{"a"},
+			}}, q.Filter)
+		})
+
+	ts.Run("__all with single value should keep $all", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"tags__all": []string{"urgent"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"tags": M{"$all": []interface{}{"urgent"}}},
+			q.Filter)
+
+		q, err = p.Parse(url.Values{"tags__all[]": []string{"a,b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"tags": M{"$all": []interface{}{"a,b"}}},
+			q.Filter)
+	})
+
+	ts.Run("operators are case insensitive", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"created__GTE": []string{"5"},
+			"name__IREIN":  []string{"a,b"},
+			"Tags__IN":     []string{"x,y"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"created": M{"$gte": int64(5)},
+			"name": M{"$in": []interface{}{
+				testRegEx{regex: "a", options: "i"},
+				testRegEx{regex: "b", options: "i"},
+			}},
+			"Tags": M{"$in": []interface{}{"x", "y"}},
+		}, q.Filter)
+	})
+
+	ts.Run("__in parameter should split string with commas",
+		func(t *testing.T) {
+			t.Parallel()
+
+			q, err := p.Parse(url.Values{"field__in": []string{"a,b"}})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"field": M{"$in": []interface{}{"a", "b"}}},
+				q.Filter)
+		})
+
+	ts.Run("[] should be treated as __in", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"field[]": []string{"a", "b"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"field": M{"$in": []interface{}{"a", "b"}}},
+			q.Filter)
+	})
+
+	ts.Run("[] parameter should not split string with commas",
+		func(t *testing.T) {
+			t.Parallel()
+
+			q, err := p.Parse(url.Values{"field[]": []string{"a,b"}})
+			assert.NoError(t, err)
+			assert.Equal(t, M{"field": "a,b"}, q.Filter)
+		})
+
+	ts.Run("malformed brackets are reported", func(t *testing.T) {
+		t.Parallel()
+
+		p := p
+		p.PartialResults = true
+
+		q, err := p.Parse(url.Values{
+			"field[a":   []string{"x"},
+			"field[b]":  []string{"y"},
+			"field[[c]": []string{"z"},
+		})
+		assert.True(t, errors.Is(err, ErrBadBrackets),
+			"unexpected err: %v", err)
+		assert.Contains(t, err.Error(), `"field[a"`)
+		assert.Contains(t, err.Error(), `"field[[c]"`)
+		assert.Equal(t, M{"field.b": "y"}, q.Filter)
+	})
+
+	ts.Run("treat re[] as rein", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"field__rein": []string{"a"},
+			"field__re[]": []string{"b"},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, q.Filter, 1)
+		assert.NotNil(t, q.Filter["field"])
+		assert.NotNil(t, q.Filter["field"].(M))
+		assert.Len(t, q.Filter["field"], 1)
+
+		in := q.Filter["field"].(M)["$in"]
+		assert.NotNil(t, in)
+
+		inArr := in.([]interface{})
+		assert.Len(t, inArr, 2)
+
+		i1, i2 := inArr[0].(testRegEx), inArr[1].(testRegEx)
+		assert.True(t, i1.regex != i2.regex && (i1.regex == "a" || i1.regex == "b"))
+		assert.True(t, i1.regex != i2.regex && (i2.regex == "a" || i2.regex == "b"))
+		assert.Zero(t, i1.options)
+		assert.Zero(t, i2.options)
+	})
+}
+
+func TestParserParseDuplicates(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"n":      Field{Converter: Int()},
+			"status": Field{Converter: String()},
+			"name":   Field{Converter: String()},
+		},
+	}
+
+	ts.Run("identical duplicates are collapsed", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"status":     []string{"open", "open"},
+			"status__eq": []string{"open"},
+			"n":          []string{"1", "01"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"status": "open", "n": int64(1)}, q.Filter)
+	})
+
+	ts.Run("conflicting equality conditions", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"status":     []string{"open"},
+			"status__eq": []string{"closed"},
+		})
+
+		var parseErr ParseError
+
+		assert.True(t, errors.Is(err, ErrConflictingValues))
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, "status", parseErr.Field)
+		assert.ElementsMatch(t, []string{"open", "closed"}, parseErr.RawValues)
+	})
+
+	ts.Run("conflicting equality operators", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{
+			"name":     []string{"x"},
+			"name__re": []string{"y"},
+		})
+
+		var parseErr ParseError
+
+		assert.True(t, errors.Is(err, ErrConflictingValues))
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, "name", parseErr.Field)
+		assert.Len(t, parseErr.RawValues, 2)
+	})
+
+	ts.Run("equality and in are both kept", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"status[]": []string{"a"},
+			"status":   []string{"b"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"status": M{
+			"$eq": "b",
+			"$in": []interface{}{"a"},
+		}}, q.Filter)
+	})
+}
+
+//nolint:paralleltest
+func TestParserObjectIDSpecWins(t *testing.T) {
+	const oid = "0123456789abcdef01234567"
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"code": Field{Converter: String()},
+			"ref":  Field{Converter: ObjectID(testOidPrimitive{})},
+		},
+	}
+
+	p.Converter.ObjectIDMode = ObjectIDNever
+
+	q, err := p.Parse(url.Values{
+		"code":  []string{oid},
+		"ref":   []string{oid},
+		"other": []string{oid},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, M{
+		"code":  oid,
+		"ref":   testObjectID{oid: oid},
+		"other": oid,
+	}, q.Filter)
+}
+
+//nolint:paralleltest
+func TestParserParseLargeInStableOrder(t *testing.T) {
+	const n = 300
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	// every key gets its own range of n values, the "[]" sources come
+	// before the "in" ones and the sources of an operator are merged in
+	// the order of their keys
+	keys := []string{
+		"id[]", "id__in", "id.nested[]", "id[nested][]", "id[nested]__in",
+	}
+	params := make(url.Values, len(keys))
+	expected := M{
+		"id":        M{"$in": make([]interface{}, 0, 2*n)},
+		"id.nested": M{"$in": make([]interface{}, 0, 3*n)},
+	}
+
+	for k, key := range keys {
+		values := make([]string, n)
+		for i := range values {
+			values[i] = strconv.Itoa(k*n + i)
+		}
+
+		if strings.HasSuffix(key, "[]") {
+			params[key] = values
+		} else {
+			params[key] = []string{strings.Join(values, ",")}
+		}
+
+		field := "id"
+		if k > 1 {
+			field = "id.nested"
+		}
+
+		cond := expected[field].(M)
+		for _, val := range values {
+			num, _ := strconv.ParseInt(val, 10, 64)
+			cond["$in"] = append(cond["$in"].([]interface{}), num)
+		}
+	}
+
+	idArray := append([]string(nil), params["id[]"]...)
+
+	for i := 0; i < 100; i++ {
+		q, err := p.Parse(params)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, q.Filter)
+	}
+
+	assert.Equal(t, idArray, params["id[]"], "url.Values must not be modified")
+}
+
+func objectIDValues(n int) (values []string) {
+	values = make([]string, n)
+
+	for i := range values {
+		values[i] = fmt.Sprintf("%024x", i)
+	}
+
+	return values
+}
+
+// benchmarkQuery is a realistic query of a listing API.
+const benchmarkQuery = "status=open&status__ne=archived&age__gte=18&" +
+	"age__lte=65&tags__in=red,green,blue&tags[]=black&name__ico=john&" +
+	"address[city]=Paris&address[zip]__sw=75&created__gt=2021-01-01&" +
+	"owner=5f1a2b3c4d5e6f7a8b9c0d1e&deleted__exists=false&" +
+	"__sort=-created,name&__limit=20&__skip=40"
+
+func BenchmarkParse(b *testing.B) {
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"name":         Field{Converter: String()},
+			"age":          Field{Converter: Int()},
+			"address.city": Field{Converter: String()},
+			"address.zip":  Field{Converter: String()},
+			"created":      Field{Converter: Date()},
+		},
+	}
+
+	query, err := url.ParseQuery(benchmarkQuery)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseLargeIn(b *testing.B) {
+	const n = 10000
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"oid": Field{Converter: ObjectID(testOidPrimitive{})},
+		},
+	}
+
+	ids := objectIDValues(n)
+	joined := strings.Join(ids, ",")
+
+	params := map[string]url.Values{
+		"in/unspecified": {"id__in": []string{joined}},
+		"in/specified":   {"oid__in": []string{joined}},
+		"in+[]/unspecified": {
+			"id__in": []string{strings.Join(ids[:n/2], ",")},
+			"id[]":   ids[n/2:],
+		},
+	}
+
+	for name, query := range params {
+		query := query
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Parse(query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParserConcurrentParse(t *testing.T) {
+	t.Parallel()
+
+	const goroutines = 300
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"name":  Field{Converter: String()},
+			"age":   Field{Converter: Int()},
+			"email": Field{Converter: String(), Required: true},
+		},
+		ValidateFields: true,
+	}
+
+	params := []url.Values{
+		{
+			"email__ico":  []string{"@example.com"},
+			"name__isw[]": []string{"jo", "ja"},
+			"__sort":      []string{"-age,name"},
+		},
+		{
+			"email__rein": []string{"^a.*,^b.*"},
+			"age__gte":    []string{"18"},
+			"__sort":      []string{"email"},
+		},
+		{
+			"email":   []string{"j.doe@example.com"},
+			"unknown": []string{"x"},
+			"__sort":  []string{"unknown"},
+		},
+	}
+
+	expected := make([]Query, len(params))
+	expectedErr := make([]error, len(params))
+
+	for i, param := range params {
+		expected[i], expectedErr[i] = p.Parse(param)
+	}
+
+	var wg sync.WaitGroup
+
+	wg.Add(goroutines)
+
+	for i := 0; i < goroutines; i++ {
+		go func(n int) {
+			defer wg.Done()
+
+			q, err := p.Parse(params[n%len(params)])
+
+			assert.Equal(t, expected[n%len(params)], q)
+			assert.Equal(t, expectedErr[n%len(params)] == nil, err == nil)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+//nolint:paralleltest
+func TestNormalizeFields(t *testing.T) {
+	expected := fieldsMap{
+		"field1": operatorsMap{
+			operatorIn: []string{"a", "b", "c"},
+		},
+		"field2": operatorsMap{
+			operatorEquals: []string{"a,b,c"},
+		},
+		"field3": operatorsMap{
+			operatorIn: []string{"a,b,c", "d"},
+		},
+		"field4": operatorsMap{
+			operatorIn: []string{"a", "b"},
+		},
+		"field5": operatorsMap{
+			operatorEquals: []string{"a"},
+		},
+		"field6": operatorsMap{
+			operatorAll: []string{"a"},
+		},
+	}
+
+	acquired, err := normailzeFields(fieldsMap{
+		// split string
+		"field1": operatorsMap{
+			operatorIn: []string{"a,b,c"},
+		},
+		// convert $in to $eq, do not split string for []
+		"field2": operatorsMap{
+			operatorInArray: []string{"a,b,c"},
+		},
+		// do not split string
+		"field3": operatorsMap{
+			operatorIn: []string{"a,b,c", "d"},
+		},
+		// merge __in and [] to $in
+		"field4": operatorsMap{
+			operatorInArray: []string{"a"},
+			operatorIn:      []string{"b"},
+		},
+		// convert $in to $eq
+		"field5": operatorsMap{
+			operatorIn: []string{"a"},
+		},
+		// keep $all with a single value
+		"field6": operatorsMap{
+			operatorAllArray: []string{"a"},
+		},
+	}, &budget{}, false)
+
+	assert.NoError(t, err)
+	sort.Strings(acquired["field4"][operatorIn])
+	assert.Equal(t, expected, acquired)
+}
+
+// referenceNormalizeFields is the two-pass implementation of
+// normailzeFields that the single-pass one must match.
+func referenceNormalizeFields(fields fieldsMap, b *budget) (
+	normalized fieldsMap, err error) {
+	normalized = make(fieldsMap, len(fields))
+
+	for field, ops := range fields {
+		ff := make(operatorsMap, len(ops))
+
+		sorted := make([]operator, 0, len(ops))
+		for op := range ops {
+			sorted = append(sorted, op)
+		}
+
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		for _, op := range sorted {
+			arr := ops[op]
+			cop := op.CommonOperator()
+
+			if err = b.spend(len(arr), 0); err != nil {
+				return nil, err
+			}
+
+			if len(arr) == 1 && op.NeedSplitString() {
+				arr = strings.Split(arr[0], arrayDelimiter)
+				if err = b.spend(len(arr)-1, 0); err != nil {
+					return nil, err
+				}
+			}
+
+			if prev, hasOperator := ff[cop]; hasOperator {
+				arr = append(append([]string{}, prev...), arr...)
+			}
+
+			ff[cop] = arr
+		}
+
+		for op, arr := range ff {
+			if len(arr) != 1 || !op.IsMultiVal() || op.IsArrayOperator() {
+				continue
+			}
+
+			single := op.SingleValueOperator()
+			if _, hasSingle := ff[single]; hasSingle {
+				continue
+			}
+
+			ff[single] = arr
+			delete(ff, op)
+		}
+
+		normalized[field] = ff
+	}
+
+	return normalized, nil
+}
+
+//nolint:paralleltest
+func TestNormalizeFieldsReference(t *testing.T) {
+	ops := []operator{
+		"eq", "ne", "in", "[]", "nin", "all", "all[]", "eqa", "co[]",
+		"coin", "re", "range", "near", "geowithin", "gt", "ieq[]", "nco",
+	}
+	values := []string{"a", "b", "a,b", "", "c,d,e", ","}
+
+	rnd := rand.New(rand.NewSource(1)) //nolint:gosec
+
+	for i := 0; i < 2000; i++ {
+		fields, clone := make(fieldsMap), make(fieldsMap)
+
+		for f := rnd.Intn(3) + 1; f > 0; f-- {
+			field := fmt.Sprintf("f%d", f)
+			fields[field], clone[field] = make(operatorsMap), make(operatorsMap)
+
+			for n := rnd.Intn(4) + 1; n > 0; n-- {
+				op := ops[rnd.Intn(len(ops))]
+
+				arr := make([]string, rnd.Intn(3)+1)
+				for k := range arr {
+					arr[k] = values[rnd.Intn(len(values))]
+				}
+
+				fields[field][op] = arr
+				clone[field][op] = append([]string(nil), arr...)
+			}
+		}
+
+		maxValues := rnd.Intn(12)
+
+		expected, expectedErr := referenceNormalizeFields(clone,
+			&budget{maxValues: maxValues})
+		acquired, err := normailzeFields(fields,
+			&budget{maxValues: maxValues}, false)
+
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, expected, acquired)
+	}
+}
+
+func TestExtractFields(ts *testing.T) {
+	ts.Parallel()
+
+	ts.Run("simple", func(t *testing.T) {
+		t.Parallel()
+
+		expected := fieldsMap{
+			"field1": operatorsMap{
+				operatorIn: []string{"a", "b", "c"},
+			},
+			"field2": operatorsMap{
+				operatorRegexIn: []string{"a", "b"},
+			},
+		}
+
+		acquired, errs := (&Parser{}).extractFields(url.Values{
+			"field1__in":   []string{"a,b,c"},
+			"field2__re[]": []string{"b"},
+			"field2__rein": []string{"a"},
+		}, &budget{})
+
+		assert.Empty(t, errs)
+
+		sort.Strings(acquired["field2"][operatorRegexIn])
+		assert.Equal(t, expected, acquired)
+	})
+
+	ts.Run("rein and re[] should be merged", func(t *testing.T) {
+		t.Parallel()
+
+		expected := fieldsMap{
+			"field": operatorsMap{
+				operatorRegexIn: []string{"a", "b"},
+			},
+		}
+
+		acquired, errs := (&Parser{}).extractFields(url.Values{
+			"field__rein": []string{"a"},
+			"field__re[]": []string{"b"},
+		}, &budget{})
+
+		assert.Empty(t, errs)
+
+		sort.Strings(acquired["field"][operatorRegexIn])
+		assert.Equal(t, expected, acquired)
+	})
+
+	ts.Run("convert map[like][fields] to struct.like.fields",
+		func(t *testing.T) {
+			t.Parallel()
+
+			expected := fieldsMap{
+				"field1.nested.nested2": operatorsMap{
+					operatorIn: []string{
+						"a", "b", "c",
+					},
+				},
+			}
+
+			acquired, errs := (&Parser{}).extractFields(url.Values{
+				"field1[nested][nested2][]": []string{"a", "b"},
+				"field1.nested.nested2[]":   []string{"c"},
+			}, &budget{})
+
+			assert.Empty(t, errs)
+
+			sort.Strings(acquired["field1.nested.nested2"][operatorIn])
+			assert.Equal(t, expected, acquired)
+		})
+
+	ts.Run("malformed brackets", func(t *testing.T) {
+		t.Parallel()
+
+		keys := []string{
+			"field1[nested[nested2]][]", "field[", "a]b[", "[a]",
+			"field[]x", "field[][a]", "field[a]b", "field]", "[]",
+			"field[a][]__in",
+		}
+
+		for _, key := range keys {
+			acquired, errs := (&Parser{}).extractFields(url.Values{
+				key:     []string{"x"},
+				"valid": []string{"y"},
+			}, &budget{})
+
+			if assert.Len(t, errs, 1, "key: %s", key) {
+				assert.True(t, errors.Is(errs[0], ErrBadBrackets))
+				assert.Contains(t, errs[0].Error(), key)
+			}
+
+			assert.Equal(t, fieldsMap{
+				"valid": operatorsMap{operatorEquals: []string{"y"}},
+			}, acquired, "key: %s", key)
+		}
+	})
+
+	ts.Run("lenient brackets", func(t *testing.T) {
+		t.Parallel()
+
+		expected := fieldsMap{
+			"field1.nested.nested2": operatorsMap{
+				operatorIn: []string{"a", "b", "d"},
+			},
+			"ab.": operatorsMap{operatorEquals: []string{"x"}},
+		}
+
+		acquired, errs := (&Parser{LenientBrackets: true}).extractFields(
+			url.Values{
+				"field1[nested][nested2][]": []string{"a", "b"},
+				"field1[nested[nested2]][]": []string{"d"},
+				"a]b[":                      []string{"x"},
+			}, &budget{})
+
+		assert.Empty(t, errs)
+
+		sort.Strings(acquired["field1.nested.nested2"][operatorIn])
+		assert.Equal(t, expected, acquired)
+	})
+}
+
+var fuzzSeedQueries = []string{
+	"name=John&age__lte=45&category__in=A,B&__limit=10&__sort=-age",
+	"field__in=a,b&field[]=c&field__rein=a&field__re[]=b",
+	"field1[nested][nested2][]=a&field1[nested[nested2]][]=d",
+	"required__exists=true&__sort=-required&__skip=1000",
+	"x__ico=$,x&y__isw=^&z__all[]=1&z__all=2,3&w__nin=a",
+	"__=x&____=y&name__=foo&name____gte=5&__limit=ten",
+	"field[=1&a]b[=2&[]=3&[=4&]=5&a[[b]]=6",
+	"field__unknown[]=a&field__=b&__sort=,,-,+",
+}
+
+func fuzzParser() (p *Parser) {
+	return &Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"age":      Field{Converter: Int()},
+			"required": Field{Converter: Bool()},
+		},
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range fuzzSeedQueries {
+		f.Add(seed)
+	}
+
+	f.Add("v=" + strings.Repeat("a,", 1<<20))
+
+	parsers := []*Parser{fuzzParser(), {}}
+
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		params, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+
+		for _, p := range parsers {
+			_, _ = p.Parse(params)
+		}
+	})
+}
+
+func FuzzExtractFields(f *testing.F) {
+	for _, seed := range fuzzSeedQueries {
+		params, _ := url.ParseQuery(seed)
+		for k, v := range params {
+			f.Add(k, strings.Join(v, ","))
+		}
+	}
+
+	f.Add("__", "x")
+	f.Add("field__", "x")
+	f.Add("field[", "x")
+	f.Add("a]b[", "x")
+	f.Add("field__in", strings.Repeat(",", 1<<20))
+
+	f.Fuzz(func(t *testing.T, key, value string) {
+		fields, _ := (&Parser{}).extractFields(
+			url.Values{key: []string{value}}, &budget{})
+
+		for field, ops := range fields {
+			assert.NotContains(t, field, "[")
+			assert.NotContains(t, field, "]")
+
+			for op := range ops {
+				assert.False(t, op.IsMultiVal() && !op.IsArrayOperator() &&
+					len(ops[op]) == 1,
+					"multi-value operator %q has a single value", op)
+			}
+		}
+	})
+}
+
+type testPanicPrimitive struct{ testOidPrimitive }
+
+func (t testPanicPrimitive) DocElem(string, interface{}) (interface{}, error) {
+	panic("docelem")
+}
+
+//nolint:paralleltest
+func TestParserRecoversConverterPanic(t *testing.T) {
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"panic": Field{Converter: ConvertFunc(
+				func(string) (interface{}, error) { panic("boom") })},
+		},
+		PartialResults: true,
+	}
+
+	q, err := p.Parse(url.Values{"panic": []string{"x"}, "ok": []string{"1"}})
+	assert.True(t, errors.Is(err, ErrConverterPanic), "unexpected err: %v", err)
+	assert.Contains(t, err.Error(), "panic")
+	assert.Equal(t, M{"ok": int64(1)}, q.Filter)
+
+	p.Converter = NewDefaultConverter(testPanicPrimitive{})
+
+	_, err = p.Parse(url.Values{"__sort": []string{"x"}})
+	assert.True(t, errors.Is(err, ErrConverterPanic), "unexpected err: %v", err)
+}
+
+//nolint:paralleltest
+func TestParserBaseFilter(t *testing.T) {
+	base := M{"deleted": false}
+	p := Parser{
+		Converter:  NewDefaultConverter(testOidPrimitive{}),
+		BaseFilter: base,
+	}
+
+	q, err := p.Parse(url.Values{"name": []string{"x"}})
+	assert.NoError(t, err)
+	assert.Equal(t, M{"name": "x", "deleted": false}, q.Filter)
+
+	q, err = p.Parse(url.Values{"deleted": []string{"true"}})
+	assert.NoError(t, err)
+	assert.Equal(t, M{"$and": []M{
+		{"deleted": true}, {"deleted": false},
+	}}, q.Filter)
+
+	q, err = p.Parse(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, M{"deleted": false}, q.Filter)
+
+	q.Filter["deleted"] = true
+
+	assert.Equal(t, M{"deleted": false}, base)
+}
+
+//nolint:paralleltest
+func TestParserWithoutConverter(t *testing.T) {
+	var p Parser
+
+	for _, key := range []string{"x", "x__re", "x__in"} {
+		_, err := p.Parse(url.Values{key: []string{"a,b"}})
+		assert.True(t, errors.Is(err, ErrNoConverter),
+			"key %s: unexpected err: %v", key, err)
+	}
+
+	q, err := p.Parse(url.Values{"x__exists": []string{"yes"}})
+	assert.NoError(t, err)
+	assert.Equal(t, M{"x": M{"$exists": true}}, q.Filter)
+}
+
+func TestParserBudget(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter:     NewDefaultConverter(testOidPrimitive{}),
+		MaxValues:     5,
+		MaxValuesSize: 64,
+	}
+
+	ts.Run("within budget", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"a__in": []string{"1,2,3"},
+			"b[]":   []string{"4", "5"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, q.Filter, 2)
+	})
+
+	ts.Run("too many split values", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"a__in": []string{"1,2,3"},
+			"b__in": []string{"4,5,6"},
+		})
+		assert.True(t, errors.Is(err, ErrQueryTooLarge),
+			"unexpected err: %v", err)
+		assert.Nil(t, q.Filter)
+	})
+
+	ts.Run("too many bytes", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"a": []string{strings.Repeat("x", 65)}})
+		assert.True(t, errors.Is(err, ErrQueryTooLarge),
+			"unexpected err: %v", err)
+	})
+
+	ts.Run("directives are counted", func(t *testing.T) {
+		t.Parallel()
+
+		for name, query := range map[string]url.Values{
+			"sort values":   {"__sort": []string{"a,b,c,d,e,f"}},
+			"fields values": {"__fields": []string{"a,b,c", "d,e,f"}},
+			"search bytes":  {"__search": []string{strings.Repeat("x", 65)}},
+			"cursor bytes":  {"__after": []string{strings.Repeat("x", 65)}},
+			"with conditions": {
+				"a__in":  []string{"1,2,3"},
+				"__sort": []string{"a,b,c"},
+			},
+		} {
+			q, err := p.Parse(query)
+			assert.True(t, errors.Is(err, ErrQueryTooLarge),
+				"%s: unexpected err: %v", name, err)
+			assert.Equal(t, Query{}, q, name)
+		}
+
+		_, err := p.Parse(url.Values{
+			"a__in":   []string{"1,2"},
+			"__sort":  []string{"a,b"},
+			"__limit": []string{"1"},
+		})
+		assert.NoError(t, err)
+	})
+}
+
+func BenchmarkParseQueryTooLarge(b *testing.B) {
+	huge := url.Values{
+		"id__in": []string{strings.Repeat("1234567890,", 1000000)},
+	}
+
+	parsers := map[string]Parser{
+		"MaxValuesSize": {
+			Converter:     NewDefaultConverter(testOidPrimitive{}),
+			MaxValuesSize: 1 << 16,
+		},
+		"MaxValues": {
+			Converter: NewDefaultConverter(testOidPrimitive{}),
+			MaxValues: 1000,
+		},
+	}
+
+	for name, p := range parsers {
+		p := p
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Parse(huge); !errors.Is(err,
+					ErrQueryTooLarge) {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest
+func TestCountSplit(t *testing.T) {
+	assert.Equal(t, 1, countSplit("", -1))
+	assert.Equal(t, 3, countSplit("a,b,c", -1))
+	assert.Equal(t, 3, countSplit(",,", 5))
+	assert.Equal(t, 3, countSplit("a,b,c,d,e", 2))
+	assert.Equal(t, 1, countSplit("a,b", 0))
+}
+
+func TestParserParseDelimiterInFieldName(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"legacy__code": Field{Converter: Int()},
+			"ext__ref":     Field{Converter: String()},
+			"ext":          Field{Converter: String()},
+		},
+		ValidateFields: true,
+	}
+
+	ts.Run("declared field with the delimiter", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"legacy__code": []string{"5"},
+			"ext__ref":     []string{"abc"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"legacy__code": int64(5), "ext__ref": "abc"},
+			q.Filter)
+	})
+
+	ts.Run("declared field with operators", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"legacy__code__gte": []string{"5"},
+			"legacy__code__lt":  []string{"10"},
+			"ext__ref__in":      []string{"a,b"},
+			"ext__ref[]":        []string{"c"},
+			"ext__ne":           []string{"x"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"legacy__code": M{"$gte": int64(5), "$lt": int64(10)},
+			"ext__ref":     M{"$in": []interface{}{"c", "a", "b"}},
+			"ext":          M{"$ne": "x"},
+		}, q.Filter)
+	})
+
+	ts.Run("unknown operator of a declared field", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"legacy__code__bad": []string{"5"}})
+		assert.True(t, errors.Is(err, ErrUnknownOperator),
+			"unexpected err: %v", err)
+	})
+
+	ts.Run("undeclared field is split at the first delimiter",
+		func(t *testing.T) {
+			t.Parallel()
+
+			_, err := p.Parse(url.Values{"legacy__other": []string{"5"}})
+			assert.True(t, errors.Is(err, ErrUnknownOperator),
+				"unexpected err: %v", err)
+		})
+
+	ts.Run("trailing delimiter", func(t *testing.T) {
+		t.Parallel()
+
+		for _, key := range []string{"name__", "ext__", "legacy__code__"} {
+			q, err := p.Parse(url.Values{key: []string{"foo"}})
+			assert.True(t, errors.Is(err, ErrUnknownOperator),
+				"unexpected err: %v", err)
+			assert.Contains(t, err.Error(), fmt.Sprintf("%q", key))
+			assert.NotContains(t, q.Filter, "name")
+		}
+	})
+
+	ts.Run("repeated delimiter", func(t *testing.T) {
+		t.Parallel()
+
+		for _, key := range []string{"name____gte", "ext____gte"} {
+			_, err := p.Parse(url.Values{key: []string{"5"}})
+			assert.True(t, errors.Is(err, ErrUnknownOperator),
+				"unexpected err: %v", err)
+		}
+	})
+
+	ts.Run("delimiter only is an unknown directive", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"__": []string{"x"}})
+		assert.NoError(t, err)
+		assert.Empty(t, q.Filter)
+	})
+}
+
+func TestParserBool(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields:    Fields{"name": Field{Converter: String()}},
+		Bool:      BoolTokens([]string{"true"}, []string{"false"}),
+	}
+
+	ts.Run("bare words are strings", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"answer": []string{"yes"}, "active": []string{"true"},
 		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"answer": "yes", "active": true}, q.Filter)
+	})
 
-	ts.Run("__in parameter should split string with commas",
-		func(t *testing.T) {
-			t.Parallel()
+	ts.Run("boolean operators", func(t *testing.T) {
+		t.Parallel()
 
-			q, err := p.Parse(url.Values{"field__in": []string{"a,b"}})
-			assert.NoError(t, err)
-			assert.Equal(t, M{"field": M{"$in": []interface{}{"a", "b"}}},
-				q.Filter)
-		})
+		q, err := p.Parse(url.Values{"name__exists": []string{"false"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": M{"$exists": false}}, q.Filter)
 
-	ts.Run("[] should be treated as __in", func(t *testing.T) {
+		_, err = p.Parse(url.Values{"name__exists": []string{"no"}})
+		assert.True(t, errors.Is(err, ErrNoMatch), "unexpected err: %v", err)
+	})
+
+	ts.Run("directives", func(t *testing.T) {
 		t.Parallel()
 
-		q, err := p.Parse(url.Values{"field[]": []string{"a", "b"}})
+		q, err := p.Parse(url.Values{"__count": []string{"true"}})
 		assert.NoError(t, err)
-		assert.Equal(t, M{"field": M{"$in": []interface{}{"a", "b"}}},
-			q.Filter)
+		assert.True(t, q.CountOnly)
+
+		_, err = p.Parse(url.Values{"__count": []string{"yes"}})
+		assert.Error(t, err)
 	})
 
-	ts.Run("[] parameter should not split string with commas",
-		func(t *testing.T) {
-			t.Parallel()
+	ts.Run("converter is not modified", func(t *testing.T) {
+		t.Parallel()
 
-			q, err := p.Parse(url.Values{"field[]": []string{"a,b"}})
-			assert.NoError(t, err)
-			assert.Equal(t, M{"field": "a,b"}, q.Filter)
+		i, err := p.Converter.Convert("yes")
+		assert.NoError(t, err)
+		assert.Equal(t, true, i)
+	})
+
+	ts.Run("numeric tokens", func(t *testing.T) {
+		t.Parallel()
+
+		numeric := Parser{
+			Converter: NewConverter(Bool(), nil, Int(), String()),
+			Bool:      BoolTokens([]string{"1"}, []string{"0"}),
+		}
+
+		q, err := numeric.Parse(url.Values{
+			"active": []string{"1"}, "deleted__exists": []string{"0"},
 		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"active": true, "deleted": M{"$exists": false},
+		}, q.Filter)
+	})
+}
 
-	ts.Run("treat re[] as rein", func(t *testing.T) {
+func TestParserStrictField(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"id":      Field{Converter: Int(), Strict: true},
+			"code":    Field{Converter: NumericString(), Strict: true},
+			"loose":   Field{},
+			"untyped": Field{Strict: true},
+		},
+		NullLiteral: "null",
+	}
+
+	ts.Run("field converter only", func(t *testing.T) {
 		t.Parallel()
 
 		q, err := p.Parse(url.Values{
-			"field__rein": []string{"a"},
-			"field__re[]": []string{"b"},
+			"id":           []string{"42"},
+			"code__in":     []string{"007,042"},
+			"loose":        []string{"yes"},
+			"id__exists":   []string{"true"},
+			"code__sw":     []string{"00"},
+			"loose__range": []string{"1,2"},
 		})
-
 		assert.NoError(t, err)
-		assert.Len(t, q.Filter, 1)
-		assert.NotNil(t, q.Filter["field"])
-		assert.NotNil(t, q.Filter["field"].(M))
-		assert.Len(t, q.Filter["field"], 1)
+		assert.Equal(t, M{
+			"id": M{"$eq": int64(42), "$exists": true},
+			"code": M{
+				"$in": []interface{}{"007", "042"},
+				"$eq": testRegEx{regex: "^00"},
+			},
+			"loose": M{"$eq": true, "$gte": int64(1), "$lte": int64(2)},
+		}, q.Filter)
+	})
 
-		in := q.Filter["field"].(M)["$in"]
-		assert.NotNil(t, in)
+	ts.Run("no fallback", func(t *testing.T) {
+		t.Parallel()
 
-		inArr := in.([]interface{})
-		assert.Len(t, inArr, 2)
+		for query, expected := range map[string]error{
+			"id=yes":                   strconv.ErrSyntax,
+			"id=null":                  strconv.ErrSyntax,
+			"code=true":                ErrNoMatch,
+			"untyped=1":                ErrNoConverter,
+			"untyped__datebetween=1,2": ErrNoConverter,
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
 
-		i1, i2 := inArr[0].(testRegEx), inArr[1].(testRegEx)
-		assert.True(t, i1.regex != i2.regex && (i1.regex == "a" || i1.regex == "b"))
-		assert.True(t, i1.regex != i2.regex && (i2.regex == "a" || i2.regex == "b"))
-		assert.Zero(t, i1.options)
-		assert.Zero(t, i2.options)
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, expected),
+				fmt.Sprintf("%s: %v", query, err))
+		}
+	})
+
+	ts.Run("null literal of loose fields", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"loose": []string{"null"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"loose": nil}, q.Filter)
 	})
 }
 
-//nolint:paralleltest
-func TestNormalizeFields(t *testing.T) {
-	expected := fieldsMap{
-		"field1": operatorsMap{
-			operatorIn: []string{"a", "b", "c"},
-		},
-		"field2": operatorsMap{
-			operatorEquals: []string{"a,b,c"},
-		},
-		"field3": operatorsMap{
-			operatorIn: []string{"a,b,c", "d"},
-		},
-		"field4": operatorsMap{
-			operatorIn: []string{"a", "b"},
-		},
-		"field5": operatorsMap{
-			operatorEquals: []string{"a"},
-		},
+var errNotPositive = errors.New("must be positive")
+
+func TestParserFieldValidate(ts *testing.T) {
+	ts.Parallel()
+
+	positive := func(value interface{}) error {
+		if n, ok := value.(int64); !ok || n <= 0 {
+			return errNotPositive
+		}
+
+		return nil
 	}
 
-	acquired := normailzeFields(fieldsMap{
-		// split string
-		"field1": operatorsMap{
-			operatorIn: []string{"a,b,c"},
-		},
-		// convert $in to $eq, do not split string for []
-		"field2": operatorsMap{
-			operatorInArray: []string{"a,b,c"},
-		},
-		// do not split string
-		"field3": operatorsMap{
-			operatorIn: []string{"a,b,c", "d"},
-		},
-		// merge __in and [] to $in
-		"field4": operatorsMap{
-			operatorInArray: []string{"a"},
-			operatorIn:      []string{"b"},
-		},
-		// convert $in to $eq
-		"field5": operatorsMap{
-			operatorIn: []string{"a"},
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"price": Field{Converter: Int(), Validate: positive},
+			"qty":   Field{Validate: positive},
+			"note": Field{Converter: NewConverter(nil, nil, Null(), String()),
+				Validate: func(value interface{}) error {
+					if len(value.(string)) > 3 {
+						return errors.New("too long")
+					}
+
+					return nil
+				}},
 		},
+	}
+
+	ts.Run("valid values", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"price__between": []string{"1,10"},
+			"qty__in":        []string{"1,2"},
+			"price__exists":  []string{"true"},
+			"note__re":       []string{"long pattern"},
+			"note__ne":       []string{"null"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"price": M{
+				"$gte": int64(1), "$lte": int64(10), "$exists": true,
+			},
+			"qty": M{"$in": []interface{}{int64(1), int64(2)}},
+			"note": M{
+				"$eq": testRegEx{regex: "long pattern"}, "$ne": nil,
+			},
+		}, q.Filter)
 	})
 
-	sort.Strings(acquired["field4"][operatorIn])
-	assert.Equal(t, expected, acquired)
+	ts.Run("invalid values", func(t *testing.T) {
+		t.Parallel()
+
+		for query, raw := range map[string]string{
+			"price=0":              "0",
+			"price__gte=-5":        "-5",
+			"price__between=-1,10": "-1",
+			"price__range=1,-1":    "-1",
+			"qty__in=1,0":          "0",
+			"qty=yes":              "yes",
+			"note=longer":          "longer",
+		} {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, err = p.Parse(values)
+			assert.True(t, errors.Is(err, ErrInvalidValue),
+				fmt.Sprintf("%s: %v", query, err))
+
+			var parseErr ParseError
+			if assert.True(t, errors.As(err, &parseErr), query) {
+				field, _ := parseOperator(query[:strings.Index(query, "=")])
+				assert.Equal(t, field, parseErr.Field, query)
+				assert.Equal(t, []string{raw}, parseErr.RawValues, query)
+			}
+		}
+
+		_, err := p.Parse(url.Values{"price": []string{"0"}})
+		assert.True(t, errors.Is(err, errNotPositive))
+	})
+
+	ts.Run("conversion errors first", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := p.Parse(url.Values{"price": []string{"x"}})
+		assert.True(t, errors.Is(err, strconv.ErrSyntax))
+		assert.False(t, errors.Is(err, ErrInvalidValue))
+	})
 }
 
-func TestExtractFields(ts *testing.T) {
+func TestParserFieldTransform(ts *testing.T) {
 	ts.Parallel()
 
-	ts.Run("simple", func(t *testing.T) {
-		t.Parallel()
+	errUnknownCode := errors.New("unknown code")
+	codes := map[string]int64{"gold": 1, "silver": 2}
 
-		expected := fieldsMap{
-			"field1": operatorsMap{
-				operatorIn: []string{"a", "b", "c"},
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"email": Field{
+				Converter: String(),
+				Transform: func(value interface{}) (interface{}, error) {
+					return strings.ToLower(value.(string)), nil
+				},
 			},
-			"field2": operatorsMap{
-				operatorRegexIn: []string{"a", "b"},
+			"tier": Field{
+				Converter: String(),
+				Validate: func(value interface{}) error {
+					if _, ok := value.(string); !ok {
+						return errors.New("not a string")
+					}
+
+					return nil
+				},
+				Transform: func(value interface{}) (interface{}, error) {
+					id, ok := codes[value.(string)]
+					if !ok {
+						return nil, errUnknownCode
+					}
+
+					return id, nil
+				},
 			},
-		}
+		},
+	}
 
-		acquired := extractFields(url.Values{
-			"field1__in":   []string{"a,b,c"},
-			"field2__re[]": []string{"b"},
-			"field2__rein": []string{"a"},
+	ts.Run("transformed values", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{
+			"email":    []string{"Jon@Example.com", "jon@example.com"},
+			"tier__in": []string{"gold,silver"},
 		})
+		assert.NoError(t, err)
+		assert.Equal(t, M{
+			"email": "jon@example.com",
+			"tier":  M{"$in": []interface{}{int64(1), int64(2)}},
+		}, q.Filter)
 
-		sort.Strings(acquired["field2"][operatorRegexIn])
-		assert.Equal(t, expected, acquired)
+		q, err = p.Parse(url.Values{"email__sw": []string{"Jon"}})
+		assert.NoError(t, err)
+		assert.Equal(t, M{"email": M{"$eq": testRegEx{regex: "^Jon"}}},
+			q.Filter)
 	})
 
-	ts.Run("rein and re[] should be merged", func(t *testing.T) {
+	ts.Run("transform errors", func(t *testing.T) {
 		t.Parallel()
 
-		expected := fieldsMap{
-			"field": operatorsMap{
-				operatorRegexIn: []string{"a", "b"},
-			},
+		_, err := p.Parse(url.Values{"tier__in": []string{"gold,bronze"}})
+		assert.True(t, errors.Is(err, ErrInvalidValue))
+		assert.True(t, errors.Is(err, errUnknownCode))
+
+		var parseErr ParseError
+		if assert.True(t, errors.As(err, &parseErr)) {
+			assert.Equal(t, "tier", parseErr.Field)
+			assert.Equal(t, []string{"bronze"}, parseErr.RawValues)
 		}
+	})
+}
 
-		acquired := extractFields(url.Values{
-			"field__rein": []string{"a"},
-			"field__re[]": []string{"b"},
+func TestParserParseLenient(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"age":  Field{Converter: Int()},
+			"name": Field{Converter: String()},
+		},
+		SortFields:   []string{"age"},
+		DefaultLimit: 20,
+		BaseFilter:   M{"tenant": "t1"},
+	}
+
+	ts.Run("invalid parts are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		q, warnings := p.ParseLenient(url.Values{
+			"name":     []string{"jon"},
+			"age__gte": []string{"old"},
+			"age__foo": []string{"1"},
+			"__limit":  []string{"x"},
+			"__sort":   []string{"-age,name"},
 		})
+		assert.Equal(t, M{"name": "jon", "tenant": "t1"}, q.Filter)
+		assert.Equal(t, int64(20), q.Limit)
+		assert.NotNil(t, q.Sort)
 
-		sort.Strings(acquired["field"][operatorRegexIn])
-		assert.Equal(t, expected, acquired)
+		fields := make([]string, 0, len(warnings))
+		for _, w := range warnings {
+			fields = append(fields, w.Field)
+			assert.Error(t, w.Err)
+		}
+
+		assert.ElementsMatch(t, []string{"age", "age", "", ""}, fields)
 	})
 
-	ts.Run("convert map[like][fields] to struct.like.fields",
-		func(t *testing.T) {
-			t.Parallel()
+	ts.Run("valid query", func(t *testing.T) {
+		t.Parallel()
 
-			expected := fieldsMap{
-				"field1.nested.nested2": operatorsMap{
-					operatorIn: []string{
-						"a", "b", "c", "d",
-					},
-				},
-			}
+		q, warnings := p.ParseLenient(url.Values{"age": []string{"5"}})
+		assert.Nil(t, warnings)
+		assert.Equal(t, M{"age": int64(5), "tenant": "t1"}, q.Filter)
 
-			acquired := extractFields(url.Values{
-				"field1[nested][nested2][]": []string{"a", "b"},
-				"field1.nested.nested2[]":   []string{"c"},
-				"field1[nested[nested2]][]": []string{"d"},
-			})
+		expected, err := p.Parse(url.Values{"age": []string{"5"}})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, q)
+	})
 
-			sort.Strings(acquired["field1.nested.nested2"][operatorIn])
-			assert.Equal(t, expected, acquired)
+	ts.Run("strict parse is not affected", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.Parse(url.Values{"age__gte": []string{"old"}})
+		assert.Error(t, err)
+		assert.Equal(t, Query{}, q)
+	})
+}
+
+//nolint:paralleltest
+func TestParserParseStrict(t *testing.T) {
+	calls := 0
+	counting := ConvertFunc(func(val string) (interface{}, error) {
+		calls++
+
+		return Int()(val)
+	})
+
+	p := Parser{
+		Converter: NewDefaultConverter(testOidPrimitive{}),
+		Fields: Fields{
+			"a": Field{Converter: counting},
+			"b": Field{Converter: counting},
+			"c": Field{Converter: counting},
+		},
+		SortFields: []string{"a"},
+	}
+
+	_, err := p.ParseStrict(url.Values{
+		"a": []string{"x"}, "b": []string{"y"}, "c": []string{"z"},
+		"__limit": []string{"bad"},
+	})
+	assert.True(t, errors.Is(err, strconv.ErrSyntax), "unexpected err: %v", err)
+	assert.Equal(t, 1, calls)
+
+	var parseErrs *ParseErrors
+	assert.False(t, errors.As(err, &parseErrs))
+
+	// the fields are converted in the ascending order
+	for i := 0; i < 10; i++ {
+		var parseErr ParseError
+
+		_, err = p.ParseStrict(url.Values{
+			"c": []string{"z"}, "b": []string{"y"}, "a": []string{"x"},
 		})
+		if assert.True(t, errors.As(err, &parseErr)) {
+			assert.Equal(t, "a", parseErr.Field)
+		}
+	}
+
+	q, err := p.ParseStrict(url.Values{
+		"a": []string{"1"}, "__limit": []string{"x"}, "__skip": []string{"y"},
+	})
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+	assert.Contains(t, err.Error(), limitParam)
+	assert.Equal(t, Query{}, q)
+
+	_, err = p.ParseStrict(url.Values{"__sort": []string{"b"}})
+	assert.True(t, errors.Is(err, ErrNoSortField))
+
+	// a sort without primitives stops before the cursor
+	_, errs := (&Parser{}).parseQuery(url.Values{
+		"__sort": []string{"a"}, "__skip": []string{"1"},
+		"__after": []string{"x"},
+	}, true)
+	if assert.Len(t, errs, 1) {
+		assert.True(t, errors.Is(errs[0], ErrNoSortField))
+	}
+
+	values := url.Values{"a": []string{"1"}, "__sort": []string{"-a"}}
+
+	q, err = p.ParseStrict(values)
+	assert.NoError(t, err)
+
+	expected, err := p.Parse(values)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, q)
 }
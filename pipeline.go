@@ -0,0 +1,76 @@
+package query
+
+// The names of the aggregation pipeline stages.
+const (
+	matchStage   = mongoOpPrefix + "match"
+	sortStage    = mongoOpPrefix + "sort"
+	skipStage    = mongoOpPrefix + "skip"
+	limitStage   = mongoOpPrefix + "limit"
+	projectStage = mongoOpPrefix + "project"
+	facetStage   = mongoOpPrefix + "facet"
+	countStage   = mongoOpPrefix + "count"
+)
+
+// The names of the FacetPipeline branches and of the count field.
+const (
+	dataFacet  = "data"
+	totalFacet = "total"
+	countField = "count"
+)
+
+// Pipeline renders the query as the stages of an aggregation pipeline:
+// $match, $sort, $skip, $limit and $project. The stages of the empty parts
+// of the query are omitted, so more stages can be appended to the result.
+// The documents are copied and the $sort stage holds the Sort as is, see
+// mongodriver.Pipeline for the pipeline of the official driver.
+func (f Query) Pipeline() (pipeline []M) {
+	q := f.Clone()
+
+	if len(q.Filter) > 0 {
+		pipeline = append(pipeline, M{matchStage: q.Filter})
+	}
+
+	if q.sortLen() > 0 {
+		pipeline = append(pipeline, M{sortStage: q.Sort})
+	}
+
+	if q.Skip != 0 {
+		pipeline = append(pipeline, M{skipStage: q.Skip})
+	}
+
+	if q.Limit != 0 {
+		pipeline = append(pipeline, M{limitStage: q.Limit})
+	}
+
+	if len(q.Projection) > 0 {
+		pipeline = append(pipeline, M{projectStage: q.Projection})
+	}
+
+	return pipeline
+}
+
+// FacetPipeline renders the query as the $match stage and the $facet stage
+// with the "data" branch of the other stages of Pipeline and the "total"
+// branch that counts all the matching documents, so a page and the total
+// count are found in a single round trip. The result is a single document,
+// i.e. {"data": [...], "total": [{"count": 42}]}, its total is empty when
+// nothing matches.
+func (f Query) FacetPipeline() (pipeline []M) {
+	data := f.Pipeline()
+
+	if len(data) > 0 {
+		if _, isMatch := data[0][matchStage]; isMatch {
+			pipeline, data = []M{data[0]}, data[1:]
+		}
+	}
+
+	if len(data) == 0 {
+		// a branch of $facet needs a stage
+		data = []M{{matchStage: M{}}}
+	}
+
+	return append(pipeline, M{facetStage: M{
+		dataFacet:  data,
+		totalFacet: []M{{countStage: countField}},
+	}})
+}
@@ -0,0 +1,19 @@
+module github.com/Denisss025/mongo-uri-query/primitives/mgo
+
+go 1.20
+
+require (
+	github.com/Denisss025/mongo-uri-query v1.0.0
+	github.com/globalsign/mgo v0.0.0-20181015135952-eeefdecb41b8
+	github.com/stretchr/testify v1.6.1
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
+
+// The replace directive applies only to the builds inside this repository,
+// the dependents get the required tagged version of the core module.
+replace github.com/Denisss025/mongo-uri-query => ../..
@@ -0,0 +1,98 @@
+// Package mgo implements the query.Primitives interface for the legacy mgo
+// driver (github.com/globalsign/mgo).
+package mgo
+
+import (
+	"fmt"
+
+	"github.com/globalsign/mgo/bson"
+
+	query "github.com/Denisss025/mongo-uri-query"
+)
+
+// Primitives converts strings to the mgo bson primitives.
+type Primitives struct{}
+
+// static assertion: Primitives must implement query.Primitives interface.
+var _ = query.Primitives(Primitives{})
+
+// static assertion: Primitives must implement query.DecimalPrimitives.
+var _ = query.DecimalPrimitives(Primitives{})
+
+// static assertion: Primitives must implement query.BinaryPrimitives.
+var _ = query.BinaryPrimitives(Primitives{})
+
+// RegEx returns a bson.RegEx with a given pattern and options.
+func (Primitives) RegEx(pattern, options string) (re interface{}, err error) {
+	return bson.RegEx{Pattern: pattern, Options: options}, nil
+}
+
+// ObjectID converts a hex string to a bson.ObjectId. Invalid values are
+// reported with query.ErrNoMatch.
+func (Primitives) ObjectID(val string) (oid interface{}, err error) {
+	if !bson.IsObjectIdHex(val) {
+		return nil, fmt.Errorf("%w: invalid ObjectId %q", query.ErrNoMatch,
+			val)
+	}
+
+	return bson.ObjectIdHex(val), nil
+}
+
+// Decimal128 converts a decimal string to a bson.Decimal128. Invalid values
+// are reported with query.ErrNoMatch.
+func (Primitives) Decimal128(val string) (d interface{}, err error) {
+	dec, err := bson.ParseDecimal128(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", query.ErrNoMatch, err)
+	}
+
+	return dec, nil
+}
+
+// Binary returns a bson.Binary with a given subtype and data.
+func (Primitives) Binary(subtype byte, data []byte) (bin interface{},
+	err error) {
+	return bson.Binary{Kind: subtype, Data: data}, nil
+}
+
+// DocElem returns a bson.DocElem with a given key and value.
+func (Primitives) DocElem(key string, val interface{}) (
+	elem interface{}, err error) {
+	return bson.DocElem{Name: key, Value: val}, nil
+}
+
+// NewParser creates a query.Parser with the default type converter that
+// uses the mgo primitives.
+func NewParser(fields query.Fields) (p *query.Parser) {
+	return &query.Parser{
+		Converter: query.NewDefaultConverter(Primitives{}),
+		Fields:    fields,
+	}
+}
+
+// Sort returns the sort of a query parsed with Primitives as the field
+// names of mgo.Query.Sort, i.e. []string{"-age", "name"}. The text score
+// is sorted as "$textScore:score".
+func Sort(q query.Query) (fields []string) {
+	sort, _ := q.Sort.([]bson.DocElem)
+	if len(sort) == 0 {
+		return nil
+	}
+
+	fields = make([]string, len(sort))
+
+	for i, elem := range sort {
+		fields[i] = elem.Name
+
+		switch direction := elem.Value.(type) {
+		case query.M:
+			fields[i] = "$textScore:" + elem.Name
+		case int:
+			if direction < 0 {
+				fields[i] = "-" + elem.Name
+			}
+		}
+	}
+
+	return fields
+}
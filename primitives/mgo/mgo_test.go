@@ -0,0 +1,78 @@
+package mgo
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+
+	query "github.com/Denisss025/mongo-uri-query"
+)
+
+const testObjectID = "0123456789abcdef01234567"
+
+//nolint:paralleltest
+func TestPrimitives(t *testing.T) {
+	var p Primitives
+
+	re, err := p.RegEx("^abc", "i")
+	assert.NoError(t, err)
+	assert.Equal(t, bson.RegEx{Pattern: "^abc", Options: "i"}, re)
+
+	oid, err := p.ObjectID(testObjectID)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.ObjectIdHex(testObjectID), oid)
+
+	for _, val := range []string{"", "deadbeefcafe-promo", testObjectID + "0"} {
+		_, err = p.ObjectID(val)
+		assert.True(t, errors.Is(err, query.ErrNoMatch), val)
+	}
+
+	dec, err := p.Decimal128("-1.5E+3")
+	assert.NoError(t, err)
+
+	expectedDec, _ := bson.ParseDecimal128("-1.5E+3")
+	assert.Equal(t, expectedDec, dec)
+
+	_, err = p.Decimal128("1.5.5")
+	assert.True(t, errors.Is(err, query.ErrNoMatch))
+
+	bin, err := p.Binary(4, []byte{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.Binary{Kind: 4, Data: []byte{1, 2}}, bin)
+
+	elem, err := p.DocElem("a", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.DocElem{Name: "a", Value: -1}, elem)
+}
+
+//nolint:paralleltest
+func TestNewParser(t *testing.T) {
+	p := NewParser(query.Fields{"code": query.Field{Converter: query.String()}})
+	p.AllowTextSearch = true
+
+	q, err := p.Parse(url.Values{
+		"_id":      []string{testObjectID},
+		"promo":    []string{"deadbeefcafe-promo"},
+		"code":     []string{testObjectID},
+		"name__re": []string{"abc"},
+		"__search": []string{"coffee"},
+		"__sort":   []string{"-a,b,__score"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, query.M{
+		"_id":   bson.ObjectIdHex(testObjectID),
+		"promo": "deadbeefcafe-promo",
+		"code":  testObjectID,
+		"name":  query.M{"$eq": bson.RegEx{Pattern: "abc"}},
+		"$text": query.M{"$search": "coffee"},
+	}, q.Filter)
+	assert.Equal(t, []string{"-a", "b", "$textScore:score"}, Sort(q))
+	assert.Nil(t, Sort(query.Query{}))
+
+	_, err = bson.Marshal(q.Filter)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,28 @@
+module github.com/Denisss025/mongo-uri-query/primitives/mongodriver
+
+go 1.20
+
+require (
+	github.com/Denisss025/mongo-uri-query v1.0.0
+	github.com/stretchr/testify v1.6.1
+	go.mongodb.org/mongo-driver v1.17.10
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
+	github.com/xdg-go/scram v1.1.2 // indirect
+	github.com/xdg-go/stringprep v1.0.4 // indirect
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
+	golang.org/x/crypto v0.26.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
+
+// The replace directive applies only to the builds inside this repository,
+// the dependents get the required tagged version of the core module.
+replace github.com/Denisss025/mongo-uri-query => ../..
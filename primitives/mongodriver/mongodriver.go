@@ -0,0 +1,256 @@
+// Package mongodriver implements the query.Primitives interface for
+// the official MongoDB Go driver (go.mongodb.org/mongo-driver).
+package mongodriver
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	query "github.com/Denisss025/mongo-uri-query"
+)
+
+// Primitives converts strings to the mongo-driver primitives.
+type Primitives struct{}
+
+// static assertion: Primitives must implement query.Primitives interface.
+var _ = query.Primitives(Primitives{})
+
+// static assertion: Primitives must implement query.DecimalPrimitives.
+var _ = query.DecimalPrimitives(Primitives{})
+
+// static assertion: Primitives must implement query.BinaryPrimitives.
+var _ = query.BinaryPrimitives(Primitives{})
+
+// RegEx returns a primitive.Regex with a given pattern and options.
+func (Primitives) RegEx(pattern, options string) (re interface{}, err error) {
+	return primitive.Regex{Pattern: pattern, Options: options}, nil
+}
+
+// ObjectID converts a hex string to a primitive.ObjectID. Invalid values
+// are reported with query.ErrNoMatch.
+func (Primitives) ObjectID(val string) (oid interface{}, err error) {
+	id, err := primitive.ObjectIDFromHex(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", query.ErrNoMatch, err)
+	}
+
+	return id, nil
+}
+
+// Decimal128 converts a decimal string to a primitive.Decimal128. Invalid
+// values are reported with query.ErrNoMatch.
+func (Primitives) Decimal128(val string) (d interface{}, err error) {
+	dec, err := primitive.ParseDecimal128(val)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", query.ErrNoMatch, err)
+	}
+
+	return dec, nil
+}
+
+// Binary returns a primitive.Binary with a given subtype and data.
+func (Primitives) Binary(subtype byte, data []byte) (bin interface{},
+	err error) {
+	return primitive.Binary{Subtype: subtype, Data: data}, nil
+}
+
+// DocElem returns a bson.E with a given key and value.
+func (Primitives) DocElem(key string, val interface{}) (
+	elem interface{}, err error) {
+	return bson.E{Key: key, Value: val}, nil
+}
+
+// NewParser creates a query.Parser with the default type converter that
+// uses the mongo-driver primitives.
+func NewParser(fields query.Fields) (p *query.Parser) {
+	return &query.Parser{
+		Converter: query.NewDefaultConverter(Primitives{}),
+		Fields:    fields,
+	}
+}
+
+// Sort returns the sort document of a query parsed with Primitives as
+// a bson.D, so it can be given to options.FindOptions.SetSort directly.
+func Sort(q query.Query) (sort bson.D) {
+	switch s := q.Sort.(type) {
+	case []bson.E:
+		return bson.D(s)
+	case bson.D:
+		return s
+	}
+
+	return nil
+}
+
+// FindOptions returns the find options of a query: the limit and the skip
+// are set only when they are not zero, the sort is converted to bson.D and
+// the projection to bson.M. The filter is not a part of the options, see
+// BSONFilter.
+func FindOptions(q query.Query) (opts *options.FindOptions) {
+	opts = options.Find()
+
+	if q.Limit != 0 {
+		opts.SetLimit(q.Limit)
+	}
+
+	if q.Skip != 0 {
+		opts.SetSkip(q.Skip)
+	}
+
+	if sort := Sort(q); sort != nil {
+		opts.SetSort(sort)
+	}
+
+	if q.Projection != nil {
+		opts.SetProjection(projection(q))
+	}
+
+	return opts
+}
+
+// projection converts the projection of a query to bson.M.
+func projection(q query.Query) (projection bson.M) {
+	projection = make(bson.M, len(q.Projection))
+	for field, include := range q.Projection {
+		projection[field] = include
+	}
+
+	return projection
+}
+
+// CountOptions returns the count options of a query for the CountDocuments
+// call of the __count queries: the limit and the skip are set only when
+// they are not zero.
+func CountOptions(q query.Query) (opts *options.CountOptions) {
+	opts = options.Count()
+
+	if q.Limit != 0 {
+		opts.SetLimit(q.Limit)
+	}
+
+	if q.Skip != 0 {
+		opts.SetSkip(q.Skip)
+	}
+
+	return opts
+}
+
+// Pipeline returns the stages of query.Query.Pipeline as a mongo.Pipeline
+// compatible []bson.D: the filter of the $match stage is converted with
+// BSONFilter, the $sort stage to bson.D and the $project stage to bson.M.
+func Pipeline(q query.Query) (pipeline []bson.D) {
+	return toStages(q, q.Pipeline())
+}
+
+// FacetPipeline returns the stages of query.Query.FacetPipeline converted
+// the same way as the stages of Pipeline.
+func FacetPipeline(q query.Query) (pipeline []bson.D) {
+	return toStages(q, q.FacetPipeline())
+}
+
+// toStages converts the pipeline stages of a query to bson.D.
+func toStages(q query.Query, stages []query.M) (pipeline []bson.D) {
+	pipeline = make([]bson.D, 0, len(stages))
+
+	for _, stage := range stages {
+		for name, value := range stage {
+			switch name {
+			case "$match":
+				value = toBSON(value)
+			case "$sort":
+				value = Sort(q)
+			case "$project":
+				value = projection(q)
+			case "$facet":
+				facet, _ := value.(query.M)
+				data, _ := facet["data"].([]query.M)
+				total, _ := facet["total"].([]query.M)
+
+				value = bson.D{
+					{Key: "data", Value: toStages(q, data)},
+					{Key: "total", Value: toStages(q, total)},
+				}
+			}
+
+			pipeline = append(pipeline, bson.D{{Key: name, Value: value}})
+		}
+	}
+
+	return pipeline
+}
+
+// BSONFilter returns a deep copy of the query filter where documents are
+// converted to bson.M and arrays to bson.A.
+func BSONFilter(q query.Query) (filter bson.M) {
+	if q.Filter == nil {
+		return nil
+	}
+
+	return toBSON(q.Filter).(bson.M)
+}
+
+// OrderedFilter returns the query.Query.OrderedFilter of a query as
+// a bson.D: the keys of the documents are sorted recursively and the arrays
+// are converted to bson.A.
+func OrderedFilter(q query.Query) (filter bson.D) {
+	// DocElem of Primitives never fails
+	ordered, _ := q.OrderedFilter(Primitives{}.DocElem)
+	filter, _ = toOrdered(ordered).(bson.D)
+
+	return filter
+}
+
+// toOrdered converts the ordered documents of a value to bson.D.
+func toOrdered(val interface{}) (ordered interface{}) {
+	switch v := val.(type) {
+	case []bson.E:
+		d := make(bson.D, len(v))
+		for i, elem := range v {
+			d[i] = bson.E{Key: elem.Key, Value: toOrdered(elem.Value)}
+		}
+
+		return d
+	case []interface{}:
+		arr := make(bson.A, len(v))
+		for i, value := range v {
+			arr[i] = toOrdered(value)
+		}
+
+		return arr
+	case query.M:
+		return toBSON(v)
+	}
+
+	return val
+}
+
+func toBSON(val interface{}) (b interface{}) {
+	switch v := val.(type) {
+	case query.M:
+		m := make(bson.M, len(v))
+		for key, value := range v {
+			m[key] = toBSON(value)
+		}
+
+		return m
+	case []interface{}:
+		arr := make(bson.A, len(v))
+		for i, value := range v {
+			arr[i] = toBSON(value)
+		}
+
+		return arr
+	case []query.M:
+		arr := make(bson.A, len(v))
+		for i, value := range v {
+			arr[i] = toBSON(value)
+		}
+
+		return arr
+	}
+
+	return val
+}
@@ -0,0 +1,281 @@
+package mongodriver
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	query "github.com/Denisss025/mongo-uri-query"
+)
+
+const testObjectID = "0123456789abcdef01234567"
+
+//nolint:paralleltest
+func TestPrimitives(t *testing.T) {
+	var p Primitives
+
+	re, err := p.RegEx("^abc", "i")
+	assert.NoError(t, err)
+	assert.Equal(t, primitive.Regex{Pattern: "^abc", Options: "i"}, re)
+
+	oid, err := p.ObjectID(testObjectID)
+	assert.NoError(t, err)
+
+	expected, _ := primitive.ObjectIDFromHex(testObjectID)
+	assert.Equal(t, expected, oid)
+
+	for _, val := range []string{"", "deadbeefcafe-promo", testObjectID + "0"} {
+		_, err = p.ObjectID(val)
+		assert.True(t, errors.Is(err, query.ErrNoMatch), val)
+	}
+
+	dec, err := p.Decimal128("-1.5E+3")
+	assert.NoError(t, err)
+
+	expectedDec, _ := primitive.ParseDecimal128("-1.5E+3")
+	assert.Equal(t, expectedDec, dec)
+
+	_, err = p.Decimal128("1.5.5")
+	assert.True(t, errors.Is(err, query.ErrNoMatch))
+
+	bin, err := p.Binary(4, []byte{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, primitive.Binary{Subtype: 4, Data: []byte{1, 2}}, bin)
+
+	elem, err := p.DocElem("a", -1)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.E{Key: "a", Value: -1}, elem)
+}
+
+//nolint:paralleltest
+func TestNewParser(t *testing.T) {
+	p := NewParser(query.Fields{"code": query.Field{Converter: query.String()}})
+
+	q, err := p.Parse(url.Values{
+		"_id":      []string{testObjectID},
+		"promo":    []string{"deadbeefcafe-promo"},
+		"code":     []string{testObjectID},
+		"name__re": []string{"abc"},
+		"__sort":   []string{"-a,b"},
+	})
+	assert.NoError(t, err)
+
+	oid, _ := primitive.ObjectIDFromHex(testObjectID)
+
+	assert.Equal(t, query.M{
+		"_id":   oid,
+		"promo": "deadbeefcafe-promo",
+		"code":  testObjectID,
+		"name":  query.M{"$eq": primitive.Regex{Pattern: "abc"}},
+	}, q.Filter)
+	assert.Equal(t, bson.D{{Key: "a", Value: -1}, {Key: "b", Value: 1}},
+		Sort(q))
+	assert.Nil(t, Sort(query.Query{}))
+}
+
+//nolint:paralleltest
+func TestParsedQueryMarshal(t *testing.T) {
+	p := NewParser(nil)
+
+	q, err := p.Parse(url.Values{
+		"_id__in":    []string{testObjectID},
+		"name__ire":  []string{"^jo"},
+		"age__gte":   []string{"18"},
+		"__or[0][a]": []string{"1"},
+		"__or[1][b]": []string{"x"},
+		"__sort":     []string{"-age"},
+	})
+	assert.NoError(t, err)
+
+	oid, _ := primitive.ObjectIDFromHex(testObjectID)
+
+	for _, filter := range []interface{}{BSONFilter(q), OrderedFilter(q)} {
+		data, err := bson.Marshal(filter)
+		assert.NoError(t, err)
+
+		var decoded bson.M
+		assert.NoError(t, bson.Unmarshal(data, &decoded))
+		assert.Equal(t, bson.M{
+			"_id":  oid,
+			"name": bson.M{"$eq": primitive.Regex{Pattern: "^jo", Options: "i"}},
+			"age":  bson.M{"$gte": int64(18)},
+			"$or":  bson.A{bson.M{"a": int64(1)}, bson.M{"b": "x"}},
+		}, decoded)
+	}
+
+	_, err = bson.Marshal(bson.M{"sort": Sort(q)})
+	assert.NoError(t, err)
+}
+
+//nolint:paralleltest
+func TestFindOptions(t *testing.T) {
+	p := NewParser(nil)
+
+	q, err := p.Parse(url.Values{
+		"__sort":  []string{"-a,b"},
+		"__limit": []string{"5"},
+	})
+	assert.NoError(t, err)
+
+	opts := FindOptions(q)
+	assert.Equal(t, bson.D{{Key: "a", Value: -1}, {Key: "b", Value: 1}},
+		opts.Sort)
+
+	if assert.NotNil(t, opts.Limit) {
+		assert.Equal(t, int64(5), *opts.Limit)
+	}
+
+	assert.Nil(t, opts.Skip)
+	assert.Nil(t, opts.Projection)
+
+	opts = FindOptions(query.Query{
+		Skip:       3,
+		Projection: map[string]int{"a": 1},
+	})
+	assert.Nil(t, opts.Limit)
+	assert.Nil(t, opts.Sort)
+	assert.Equal(t, bson.M{"a": 1}, opts.Projection)
+
+	if assert.NotNil(t, opts.Skip) {
+		assert.Equal(t, int64(3), *opts.Skip)
+	}
+
+	q, err = p.Parse(url.Values{
+		"__page":     []string{"3"},
+		"__per_page": []string{"25"},
+		"__fields":   []string{"a,-_id"},
+	})
+	assert.NoError(t, err)
+
+	opts = FindOptions(q)
+	assert.Equal(t, bson.M{"a": 1, "_id": 0}, opts.Projection)
+
+	if assert.NotNil(t, opts.Limit) && assert.NotNil(t, opts.Skip) {
+		assert.Equal(t, int64(25), *opts.Limit)
+		assert.Equal(t, int64(50), *opts.Skip)
+	}
+}
+
+//nolint:paralleltest
+func TestCountOptions(t *testing.T) {
+	opts := CountOptions(query.Query{Limit: 5, CountOnly: true})
+
+	if assert.NotNil(t, opts.Limit) {
+		assert.Equal(t, int64(5), *opts.Limit)
+	}
+
+	assert.Nil(t, opts.Skip)
+
+	opts = CountOptions(query.Query{Skip: 3})
+	assert.Nil(t, opts.Limit)
+
+	if assert.NotNil(t, opts.Skip) {
+		assert.Equal(t, int64(3), *opts.Skip)
+	}
+}
+
+//nolint:paralleltest
+func TestPipeline(t *testing.T) {
+	p := NewParser(nil)
+
+	q, err := p.Parse(url.Values{
+		"a":        []string{"1"},
+		"__sort":   []string{"-a,b"},
+		"__limit":  []string{"5"},
+		"__skip":   []string{"10"},
+		"__fields": []string{"a"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []bson.D{
+		{{Key: "$match", Value: bson.M{"a": int64(1)}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "a", Value: -1}, {Key: "b", Value: 1},
+		}}},
+		{{Key: "$skip", Value: int64(10)}},
+		{{Key: "$limit", Value: int64(5)}},
+		{{Key: "$project", Value: bson.M{"a": 1}}},
+	}, Pipeline(q))
+
+	assert.Empty(t, Pipeline(query.Query{}))
+
+	assert.Equal(t, []bson.D{
+		{{Key: "$match", Value: bson.M{"a": int64(1)}}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "data", Value: []bson.D{
+				{{Key: "$sort", Value: bson.D{
+					{Key: "a", Value: -1}, {Key: "b", Value: 1},
+				}}},
+				{{Key: "$skip", Value: int64(10)}},
+				{{Key: "$limit", Value: int64(5)}},
+				{{Key: "$project", Value: bson.M{"a": 1}}},
+			}},
+			{Key: "total", Value: []bson.D{
+				{{Key: "$count", Value: "count"}},
+			}},
+		}}},
+	}, FacetPipeline(q))
+}
+
+//nolint:paralleltest
+func TestOrderedFilter(t *testing.T) {
+	assert.Nil(t, OrderedFilter(query.Query{}))
+
+	assert.Equal(t, bson.D{
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "e", Value: bson.D{{Key: "$gt", Value: 1}}}},
+			bson.D{{Key: "f", Value: bson.M{}}},
+		}},
+		{Key: "a", Value: bson.D{
+			{Key: "$gte", Value: 1},
+			{Key: "$in", Value: bson.A{1, bson.D{{Key: "b", Value: 2}}}},
+			{Key: "$lt", Value: 5},
+		}},
+		{Key: "c", Value: "d"},
+	}, OrderedFilter(query.Query{Filter: query.M{
+		"c": "d",
+		"a": query.M{
+			"$lt":  5,
+			"$in":  []interface{}{1, query.M{"b": 2}},
+			"$gte": 1,
+		},
+		"$or": []query.M{
+			{"e": query.M{"$gt": 1}},
+			{"f": query.M{}},
+		},
+	}}))
+}
+
+//nolint:paralleltest
+func TestBSONFilter(t *testing.T) {
+	assert.Nil(t, BSONFilter(query.Query{}))
+
+	assert.Equal(t, bson.M{
+		"a": bson.M{"$in": bson.A{1, bson.M{"b": 2}}},
+		"c": "d",
+		"$or": bson.A{
+			bson.M{"e": bson.M{"$gt": 1}},
+			bson.M{"f": bson.A{"g"}},
+		},
+	}, BSONFilter(query.Query{Filter: query.M{
+		"a": query.M{"$in": []interface{}{1, query.M{"b": 2}}},
+		"c": "d",
+		"$or": []query.M{
+			{"e": query.M{"$gt": 1}},
+			{"f": []interface{}{"g"}},
+		},
+	}}))
+}
+
+//nolint:paralleltest
+func TestQueryString(t *testing.T) {
+	q, err := NewParser(nil).ParseString(
+		"name__isw=jo&owner=" + testObjectID + "&__sort=-age")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"filter":{"name":{"$eq":{"$options":"i","$regex":"^jo"}},`+
+		`"owner":"`+testObjectID+`"},"sort":[{"age":-1}]}`, q.String())
+}
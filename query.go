@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -27,6 +28,117 @@ var (
 	// ErrTooManyValues is returned when a single value operator is assigned
 	// to multiple values.
 	ErrTooManyValues = errors.New("too many values")
+	// ErrConverterPanic is returned when a converter or a primitive panics
+	// while processing a value.
+	ErrConverterPanic = errors.New("converter panic")
+	// ErrQueryTooLarge is returned when a query exceeds the parser's
+	// MaxValues or MaxValuesSize limits.
+	ErrQueryTooLarge = errors.New("query too large")
+	// ErrBadBrackets is returned when a query key has unbalanced brackets
+	// or empty path segments, i.e. "field[" or "field[a][]b".
+	ErrBadBrackets = errors.New("malformed brackets")
+	// ErrOutOfRange is returned when a numeric parameter is out of its
+	// allowed range.
+	ErrOutOfRange = errors.New("out of range")
+	// ErrLimitTooLarge is returned when the __limit parameter exceeds
+	// MaxLimit. It wraps ErrOutOfRange.
+	ErrLimitTooLarge = fmt.Errorf("limit %w", ErrOutOfRange)
+	// ErrEmptyValue is returned when an empty value is given to an operator
+	// that does not allow it, i.e. "price__gte=", or to any operator with
+	// the EmptyError policy.
+	ErrEmptyValue = errors.New("empty value not allowed")
+	// ErrConflictingValues is returned when a field gets several equality
+	// conditions with different values, i.e. "status=open&status__eq=closed".
+	// It wraps ErrTooManyValues.
+	ErrConflictingValues = fmt.Errorf("%w: conflicting values",
+		ErrTooManyValues)
+	// ErrNoProjectionField is returned when a __fields directive projects
+	// a field that is not present in the fields specification or has an
+	// empty field name, i.e. "__fields=a,,b".
+	ErrNoProjectionField = errors.New("no projection field")
+	// ErrMixedProjection is returned when a projection mixes included and
+	// excluded fields other than _id.
+	ErrMixedProjection = errors.New("mixed inclusion and exclusion")
+	// ErrBadGroup is returned for a malformed key of a group directive,
+	// i.e. "__or[x][status]" or "__or[0]".
+	ErrBadGroup = errors.New("malformed group")
+	// ErrBadRange is returned when the range operator gets neither "min,max"
+	// nor an open range, i.e. "price__range=10" or "price__range=,".
+	ErrBadRange = errors.New("malformed range")
+	// ErrTooManyArrayValues is returned when a multi-value operator of
+	// a field gets more values than the parser's MaxArrayValues.
+	ErrTooManyArrayValues = errors.New("too many array values")
+	// ErrBadRegex is returned with ValidateRegex when a pattern of the regex
+	// operators does not compile.
+	ErrBadRegex = errors.New("bad regex")
+	// ErrRegexTooLong is returned when a pattern of the regex operators
+	// exceeds the parser's MaxRegexLength.
+	ErrRegexTooLong = errors.New("regex too long")
+	// ErrFieldConflict is returned by Query.Merge with MergeStrict when
+	// both queries have different conditions on the same field.
+	ErrFieldConflict = errors.New("field conflict")
+	// ErrMalformedQuery is returned by Parser.ParseString and
+	// Parser.ParseRequest when a raw query or a form cannot be decoded.
+	ErrMalformedQuery = errors.New("malformed query")
+	// ErrOperatorExists is returned by Parser.RegisterOperator for a name of
+	// a built-in or an already registered operator.
+	ErrOperatorExists = errors.New("operator already exists")
+	// ErrBadOperatorName is returned by Parser.RegisterOperator for
+	// a malformed operator name or an incomplete OperatorSpec.
+	ErrBadOperatorName = errors.New("bad operator")
+	// ErrCacheUnsafe is returned by Parser.EnableCache for a parser with
+	// hooks unless the CacheHooks option is given.
+	ErrCacheUnsafe = errors.New("cache is unsafe")
+	// ErrBadCoordinates is returned when a value of the near or geowithin
+	// operator is not "lon,lat,meters" of valid numbers.
+	ErrBadCoordinates = errors.New("bad coordinates")
+	// ErrTextSearchDisabled is returned for the __search directive unless
+	// the parser's AllowTextSearch is set.
+	ErrTextSearchDisabled = errors.New("text search disabled")
+	// ErrTooManySortFields is returned when the __sort directive has more
+	// fields than the parser's MaxSortFields.
+	ErrTooManySortFields = errors.New("too many sort fields")
+	// ErrBadCursor is returned for the __after or __before directive
+	// without a single sort field or together with __skip.
+	ErrBadCursor = errors.New("bad cursor")
+	// ErrInvalidCursor is returned for a cursor token with a missing or
+	// wrong signature when the parser has a CursorKey. It wraps
+	// ErrBadCursor.
+	ErrInvalidCursor = fmt.Errorf("%w: invalid signature", ErrBadCursor)
+	// ErrExpensiveOperator is returned for an unanchored pattern operator
+	// on a field with NoRegex.
+	ErrExpensiveOperator = errors.New("expensive operator")
+	// ErrNotEncodable is returned by Query.Encode for a condition that has
+	// no query form, i.e. a nested group or a custom operator.
+	ErrNotEncodable = errors.New("not encodable")
+	// ErrNotGeoPoint is returned with ValidateFields for a geospatial
+	// operator on a field without GeoPoint.
+	ErrNotGeoPoint = errors.New("not a geo point")
+	// ErrBadModArgs is returned when the mod operator gets other than two
+	// values or a zero divisor, i.e. "seq__mod=4" or "seq__mod=0,1". More
+	// than two values are also reported with ErrTooManyValues.
+	ErrBadModArgs = errors.New("bad mod arguments")
+	// ErrOperatorNotAllowed is returned for an operator that is not in
+	// the AllowedOperators of a field.
+	ErrOperatorNotAllowed = errors.New("operator not allowed")
+	// ErrOperatorDisabled is returned for an operator that is in
+	// the DisabledOperators of the parser.
+	ErrOperatorDisabled = errors.New("operator disabled")
+	// ErrBadPage is returned for the __page or __per_page directive together
+	// with __skip or __limit, or for a page after the first one without
+	// a page size.
+	ErrBadPage = errors.New("bad page")
+	// ErrUnknownDirective is returned with StrictDirectives for a query
+	// parameter that starts with the delimiter but is not a known
+	// directive, i.e. "__limt".
+	ErrUnknownDirective = errors.New("unknown directive")
+	// ErrInvertedRange is returned when the lower bound of the between
+	// operators exceeds the upper one, i.e. "price__between=20,10". It
+	// wraps ErrBadRange.
+	ErrInvertedRange = fmt.Errorf("%w: lower bound exceeds upper", ErrBadRange)
+	// ErrInvalidValue wraps the errors of Field.Validate and
+	// Field.Transform.
+	ErrInvalidValue = errors.New("invalid value")
 )
 
 // M is an alias for map[string]interface{}.
@@ -44,35 +156,318 @@ type Query struct {
 	// Skip is a number of documents to be skipped before adding documents
 	// to the results.
 	Skip int64
+	// Projection is a document specifying the fields to return: 1 includes
+	// a field and 0 excludes it.
+	Projection map[string]int
+	// Page is the page number of the __page and __per_page directives, zero
+	// without them. Skip and Limit already take it into account.
+	Page int64
+	// CountOnly is set by the __count directive when the documents are
+	// counted instead of being found.
+	CountOnly bool
 }
 
-func appendArray(array, values interface{}) (retval interface{}) {
-	type mongoArray = []interface{}
+// Clone returns a deep copy of the query. Documents and arrays of the
+// filter and the sort are copied recursively, other values are copied
+// by value.
+func (f Query) Clone() (q Query) {
+	q = f
+
+	if f.Filter != nil {
+		q.Filter = cloneValue(f.Filter).(M)
+	}
+
+	if f.Sort != nil {
+		s := reflect.ValueOf(f.Sort)
+		if s.Kind() == reflect.Slice && !s.IsNil() {
+			sorted := reflect.MakeSlice(s.Type(), s.Len(), s.Len())
+
+			for i := 0; i < s.Len(); i++ {
+				elem := reflect.ValueOf(cloneValue(s.Index(i).Interface()))
+				if elem.IsValid() {
+					sorted.Index(i).Set(elem)
+				}
+			}
+
+			q.Sort = sorted.Interface()
+		}
+	}
+
+	if f.Projection != nil {
+		q.Projection = make(map[string]int, len(f.Projection))
+
+		for field, include := range f.Projection {
+			q.Projection[field] = include
+		}
+	}
+
+	return q
+}
+
+// MergeOption defines how Query.Merge resolves the conditions on a field
+// that is present in both queries.
+type MergeOption int
+
+const (
+	// MergeReplace replaces the condition with the merged-in one. It is
+	// the default option.
+	MergeReplace MergeOption = iota
+	// MergeAnd keeps both conditions, they are moved to an $and. The sorts
+	// are concatenated and the smaller Limit is kept.
+	MergeAnd
+	// MergeStrict makes Merge return ErrFieldConflict and keep the query
+	// intact. Different Limit and Skip values are conflicts too.
+	MergeStrict
+)
+
+// andOperator is a mongo operator that combines conditions with AND.
+const andOperator = mongoOpPrefix + "and"
+
+// Merge merges other query into the query, i.e. to force server-side
+// conditions on top of a parsed query. The conditions on the fields that
+// are present in a single query are copied, the equal conditions are kept
+// once and the other ones are resolved with the option: the merged-in
+// condition wins by default. The $and conditions of both queries are
+// always concatenated. Sort, Limit, Skip and Projection are taken from
+// other only when they are set, except for MergeAnd that appends the sort
+// fields of other that the query has not and keeps the smaller Limit.
+// Page is taken together with Skip and is reset when the merged Limit and
+// Skip no longer describe it. CountOnly is set when either query has it.
+func (f *Query) Merge(other Query, opts ...MergeOption) (err error) {
+	opt := MergeReplace
+	if len(opts) > 0 {
+		opt = opts[len(opts)-1]
+	}
+
+	fields := make([]string, 0, len(other.Filter))
+	for field := range other.Filter {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	if err = f.checkMerge(other, fields, opt); err != nil {
+		return err
+	}
+
+	if f.Filter == nil && len(fields) > 0 {
+		f.Filter = make(M, len(fields))
+	}
+
+	var and []M
+
+	for _, field := range fields {
+		value := cloneValue(other.Filter[field])
+		prev, exists := f.Filter[field]
+
+		switch {
+		case field == andOperator:
+			and = append(and, asConditions(value)...)
+		case !exists || opt == MergeReplace:
+			f.Filter[field] = value
+		case reflect.DeepEqual(prev, value):
+		default:
+			delete(f.Filter, field)
+
+			and = append(and, M{field: prev}, M{field: value})
+		}
+	}
+
+	f.AddAnd(and...)
+
+	f.mergeOptions(other, opt)
+
+	return nil
+}
+
+// checkMerge reports the conflicts of MergeStrict and the sorts of
+// different types that MergeAnd can not concatenate, so Merge keeps
+// the query intact.
+func (f *Query) checkMerge(other Query, fields []string, opt MergeOption) (
+	err error) {
+	switch opt {
+	case MergeStrict:
+		for _, field := range fields {
+			prev, exists := f.Filter[field]
+			if exists && field != andOperator &&
+				!reflect.DeepEqual(prev, other.Filter[field]) {
+				return fmt.Errorf("merge: %w: %s", ErrFieldConflict, field)
+			}
+		}
+
+		switch {
+		case f.Limit != 0 && other.Limit != 0 && f.Limit != other.Limit:
+			return fmt.Errorf("merge: %w: %s: %d and %d", ErrFieldConflict,
+				limitParam, f.Limit, other.Limit)
+		case f.Skip != 0 && other.Skip != 0 && f.Skip != other.Skip:
+			return fmt.Errorf("merge: %w: %s: %d and %d", ErrFieldConflict,
+				skipParam, f.Skip, other.Skip)
+		}
+	case MergeAnd:
+		if f.Sort != nil && other.Sort != nil &&
+			reflect.TypeOf(f.Sort) != reflect.TypeOf(other.Sort) {
+			return fmt.Errorf("merge: %w: %s: %T and %T", ErrFieldConflict,
+				sortParam, f.Sort, other.Sort)
+		}
+	}
+
+	return nil
+}
+
+// AddAnd appends conditions to the $and of the filter, i.e. to combine
+// the conditions on a field that cannot be merged in a single map.
+func (f *Query) AddAnd(conditions ...M) {
+	if len(conditions) == 0 {
+		return
+	}
+
+	if f.Filter == nil {
+		f.Filter = make(M, 1)
+	}
+
+	f.Filter[andOperator] = append(asConditions(f.Filter[andOperator]),
+		conditions...)
+}
+
+// asConditions converts a value of an $and to a list of conditions.
+func asConditions(val interface{}) (conditions []M) {
+	switch v := val.(type) {
+	case []M:
+		return v
+	case []interface{}:
+		conditions = make([]M, 0, len(v))
 
-	fArray, isFArray := array.(mongoArray)
-	vArray, isVarray := values.(mongoArray)
+		for _, condition := range v {
+			if m, ok := condition.(M); ok {
+				conditions = append(conditions, m)
+			}
+		}
+
+		return conditions
+	}
+
+	return nil
+}
+
+// mergeOptions takes Sort, Limit, Skip and Projection from other query
+// when they are set. MergeAnd concatenates the sorts and keeps the smaller
+// limit.
+func (f *Query) mergeOptions(other Query, opt MergeOption) {
+	other = other.Clone()
+
+	switch {
+	case other.Sort == nil:
+	case opt == MergeAnd && f.Sort != nil:
+		f.concatSort(other.Sort)
+	default:
+		f.Sort = other.Sort
+	}
+
+	switch {
+	case other.Limit == 0:
+	case opt == MergeAnd && f.Limit != 0 && f.Limit < other.Limit:
+	default:
+		f.Limit = other.Limit
+	}
+
+	if other.Skip != 0 || other.Page != 0 {
+		f.Skip, f.Page = other.Skip, other.Page
+	}
+
+	if f.Page != 0 && f.Skip != (f.Page-1)*f.Limit {
+		// the merged limit and skip no longer describe the page
+		f.Page = 0
+	}
+
+	if other.Projection != nil {
+		f.Projection = other.Projection
+	}
+
+	if other.CountOnly {
+		f.CountOnly = true
+	}
+}
+
+func cloneValue(val interface{}) (clone interface{}) {
+	switch v := val.(type) {
+	case M:
+		if v == nil {
+			return v
+		}
+
+		m := make(M, len(v))
+		for key, value := range v {
+			m[key] = cloneValue(value)
+		}
+
+		return m
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+
+		arr := make([]interface{}, len(v))
+		for i, value := range v {
+			arr[i] = cloneValue(value)
+		}
+
+		return arr
+	case []M:
+		if v == nil {
+			return v
+		}
 
-	if array != nil && !isFArray {
-		fArray = make(mongoArray, 1, len(vArray)+2)
-		fArray[0] = array
+		arr := make([]M, len(v))
+		for i, value := range v {
+			arr[i] = cloneValue(value).(M)
+		}
+
+		return arr
 	}
 
-	if values != nil && !isVarray {
-		vArray = mongoArray{values}
+	return val
+}
+
+// appendArray merges values into array for the multi-value operators:
+//   - nil contributes nothing;
+//   - a scalar contributes itself as a single element;
+//   - arrays are concatenated in order; their elements are not flattened,
+//     so nested arrays are kept as single elements.
+//
+// An existing array may be grown in place, the result is never nil.
+func appendArray(array, values interface{}) (retval interface{}) {
+	vArray := asArray(values)
+
+	fArray, isFArray := array.([]interface{})
+	if !isFArray || fArray == nil {
+		existing := asArray(array)
+
+		fArray = make([]interface{}, len(existing), len(existing)+len(vArray))
+		copy(fArray, existing)
 	}
 
 	return append(fArray, vArray...)
 }
 
+// asArray converts a value to an array: nil is an empty array, a scalar is
+// a single element array.
+func asArray(val interface{}) (arr []interface{}) {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+
+	return []interface{}{val}
+}
+
 func addField(filter M, field string, op operator, val interface{}) (m M) {
 	if m = filter; m == nil {
-		m = make(M)
+		m = make(M, 1)
 	}
 
 	f, exists := m[field]
-	if !exists {
-		f = nil
-	}
 
 	mm, isMap := f.(M)
 	if !isMap {
@@ -82,52 +477,324 @@ func addField(filter M, field string, op operator, val interface{}) (m M) {
 			return m
 		}
 
-		if f != nil {
-			mm = M{operatorEquals.MongoOperator(): f}
-		} else {
-			mm = make(M)
+		mm = make(M, 1)
+
+		if exists {
+			mm[operatorEquals.MongoOperator()] = f
 		}
+
+		m[field] = mm
 	}
 
-	if op.IsMultiVal() {
-		var arr interface{}
+	mongoOp := op.MongoOperator()
 
-		if marr, hasOperator := mm[op.MongoOperator()]; hasOperator {
-			arr = marr
-		}
+	if op.IsNegated() || op == operatorNotIn {
+		addNegated(mm, op, val)
+
+		return m
+	}
 
-		val = appendArray(arr, val)
+	if op.IsMultiVal() && !op.IsArguments() {
+		val = appendArray(mm[mongoOp], val)
 	}
 
-	mm[op.MongoOperator()] = val
-	m[field] = mm
+	mm[mongoOp] = val
 
 	return m
 }
 
-// AddFilter appends an operator, field and value to the filter.
-func (f *Query) AddFilter(field string, op operator, value interface{}) {
+// addNegated adds a negated pattern or a "nin" condition to the field
+// document mm. A single negation is a $not, while several negations are
+// merged to $nin, since a value must match none of the patterns.
+func addNegated(mm M, op operator, val interface{}) {
+	notOp := operatorNot.MongoOperator()
+	ninOp := operatorNotIn.MongoOperator()
+
+	prev, hasNot := mm[notOp]
+	_, hasNin := mm[ninOp]
+
+	if !op.IsMultiVal() && !hasNot && !hasNin {
+		mm[notOp] = val
+
+		return
+	}
+
+	if hasNot {
+		delete(mm, notOp)
+		mm[ninOp] = appendArray(mm[ninOp], prev)
+	}
+
+	mm[ninOp] = appendArray(mm[ninOp], val)
+}
+
+// notCondition wraps the operator expression of a condition with $not,
+// i.e. {"$not": {"$gt": 30}} for "not__gt=30".
+func notCondition(op operator, value interface{}) (notOp operator, doc M) {
+	cond := Query{}
+	cond.addCondition("", op, value)
+
+	doc, isDoc := cond.Filter[""].(M)
+	if !isDoc {
+		doc = M{operatorEquals.MongoOperator(): cond.Filter[""]}
+	}
+
+	return operatorNot, doc
+}
+
+// AddFilter appends an operator, field and value to the filter. An equality
+// is upgraded to an "$eq" condition when another operator is added to
+// the field and the arrays of the multi-value operators, i.e. OpIn, are
+// appended. A value of the range operator is added as its "gte" and "lte"
+// bounds and a condition of an operator negated by the modifier, i.e.
+// "not__gt", is wrapped with $not.
+func (f *Query) AddFilter(field string, op Operator, value interface{}) {
+	f.addCondition(field, op.operator(), value)
+}
+
+// addCondition is AddFilter for an operator of a parsed query.
+func (f *Query) addCondition(field string, op operator, value interface{}) {
+	if inner, negated := op.operand(); negated {
+		notOp, doc := notCondition(inner, value)
+		f.Filter = addField(f.Filter, field, notOp, doc)
+
+		return
+	}
+
+	if frag, isFragment := value.(fragment); isFragment {
+		f.Filter = addFragment(f.Filter, field, frag)
+
+		return
+	}
+
+	if r, isRange := value.(valueRange); isRange && op.IsRange() {
+		for _, b := range r {
+			f.Filter = addField(f.Filter, field, b.op, b.value)
+		}
+
+		return
+	}
+
 	f.Filter = addField(f.Filter, field, op, value)
 }
 
-// AddSort adds a field to sort to the Sort document.
-func (f *Query) AddSort(val string,
-	docElem func(string, interface{}) (interface{}, error)) (
-	fieldName string, err error) {
-	sortDirection := sortAsc
+// addFilter is addCondition that never overwrites a single value condition.
+// A condition that is already set for the field and the mongo operator is
+// kept when it has the same value and reported as a conflict otherwise.
+func (f *Query) addFilter(field string, op operator, value interface{}) (
+	err error) {
+	if frag, isFragment := value.(fragment); isFragment {
+		for _, mongoOp := range frag.sortedConditions() {
+			prev, isSet := f.condition(field, mongoOp)
+			if isSet && !reflect.DeepEqual(prev, frag[mongoOp]) {
+				return conflictError(field, op, prev, frag[mongoOp])
+			}
+		}
+
+		f.addCondition(field, op, value)
+
+		return nil
+	}
+
+	if op.IsNegated() {
+		// a $not of an operator expression is never merged to a $nin
+		prev, isSet := f.condition(field, operatorNot.MongoOperator())
+		if _, isDoc := prev.(M); isSet && isDoc {
+			return conflictError(field, op, prev, value)
+		}
+	}
+
+	if op.IsMultiVal() && !op.IsArguments() || op.IsNegated() {
+		f.addCondition(field, op, value)
+
+		return nil
+	}
+
+	if r, isRange := value.(valueRange); isRange && op.IsRange() {
+		for _, b := range r {
+			if err = f.addFilter(field, b.op, b.value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	prev, isSet := f.condition(field, op.MongoOperator())
+
+	switch {
+	case !isSet:
+		f.addCondition(field, op, value)
+	case !reflect.DeepEqual(prev, value):
+		return conflictError(field, op, prev, value)
+	}
+
+	return nil
+}
+
+// conflictError reports two different values of the same condition.
+func conflictError(field string, op operator, prev, value interface{}) (
+	err error) {
+	return ParseError{
+		Field:     field,
+		Operator:  op.String(),
+		Count:     2,
+		RawValues: []string{fmt.Sprint(prev), fmt.Sprint(value)},
+		Err:       ErrConflictingValues,
+	}
+}
+
+// condition returns a value of the field condition with the mongo operator.
+func (f *Query) condition(field, mongoOp string) (
+	value interface{}, ok bool) {
+	value, ok = f.Filter[field]
+	if !ok {
+		return nil, false
+	}
+
+	if m, isMap := value.(M); isMap {
+		value, ok = m[mongoOp]
+
+		return value, ok
+	}
+
+	return value, mongoOp == operatorEquals.MongoOperator()
+}
+
+// parseSort splits a sort value to a field name and a sort direction. A
+// leading space is the "+" prefix decoded from a query string.
+func parseSort(val string) (fieldName string, sortDirection int) {
+	sortDirection = sortAsc
 
 	fieldName = strings.TrimPrefix(val, sortAscPrefix)
+	fieldName = strings.TrimPrefix(fieldName, sortAscSpace)
 
 	if strings.HasPrefix(fieldName, sortDescPrefix) {
 		sortDirection, fieldName = sortDesc, fieldName[1:]
 	}
 
+	return fieldName, sortDirection
+}
+
+// parseSortSpec splits a sort value given either with a prefix, i.e.
+// "-age", or with a direction suffix, i.e. "age:desc", to a field name and
+// a sort direction. The prefixes are not parsed when a suffix is given.
+func parseSortSpec(val string) (fieldName string, sortDirection int) {
+	pos := strings.LastIndex(val, sortDirectionDelimiter)
+	if pos < 0 {
+		return parseSort(val)
+	}
+
+	switch suffix := val[pos+len(sortDirectionDelimiter):]; {
+	case strings.EqualFold(suffix, sortAscSuffix):
+		return val[:pos], sortAsc
+	case strings.EqualFold(suffix, sortDescSuffix):
+		return val[:pos], sortDesc
+	}
+
+	return parseSort(val)
+}
+
+// AddSort adds a field to sort to the Sort document. The value is either
+// a field name with an optional "+" or "-" prefix or a field name with
+// the ":asc" or ":desc" suffix. The first sort of a field wins, the later
+// ones are ignored, so "a,-a" sorts by "a" ascending. The returned
+// fieldName is always the bare name.
+func (f *Query) AddSort(val string,
+	docElem func(string, interface{}) (interface{}, error)) (
+	fieldName string, err error) {
+	fieldName, sortDirection := parseSortSpec(val)
+	if f.hasSort(fieldName) {
+		return fieldName, nil
+	}
+
 	de, err := docElem(fieldName, sortDirection)
 	if err != nil {
 		return fieldName, fmt.Errorf("add sort: %w: %s: %d",
 			err, fieldName, sortDirection)
 	}
 
+	f.appendSort(de)
+
+	return
+}
+
+// hasSort checks if the Sort document has a field. The field names are
+// known for the document elements that start with a string field, i.e.
+// the Key of bson.E, and for the single key maps.
+func (f *Query) hasSort(fieldName string) (ok bool) {
+	s := reflect.ValueOf(f.Sort)
+	if s.Kind() != reflect.Slice {
+		return false
+	}
+
+	for i := 0; i < s.Len(); i++ {
+		if key, known := sortKey(s.Index(i)); known && key == fieldName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortKey(de reflect.Value) (key string, ok bool) {
+	for de.Kind() == reflect.Interface || de.Kind() == reflect.Ptr {
+		if de.IsNil() {
+			return "", false
+		}
+
+		de = de.Elem()
+	}
+
+	switch de.Kind() {
+	case reflect.Struct:
+		if de.NumField() > 0 && de.Field(0).Kind() == reflect.String {
+			return de.Field(0).String(), true
+		}
+	case reflect.Map:
+		if keys := de.MapKeys(); len(keys) == 1 &&
+			keys[0].Kind() == reflect.String {
+			return keys[0].String(), true
+		}
+	}
+
+	return "", false
+}
+
+// sortLen returns the number of the Sort document elements.
+func (f *Query) sortLen() (n int) {
+	if s := reflect.ValueOf(f.Sort); s.Kind() == reflect.Slice {
+		return s.Len()
+	}
+
+	return 0
+}
+
+// truncateSort keeps the first n elements of the Sort document.
+func (f *Query) truncateSort(n int) {
+	if f.sortLen() > n {
+		f.Sort = reflect.ValueOf(f.Sort).Slice(0, n).Interface()
+	}
+}
+
+// concatSort appends the elements of a sort document of the same type
+// whose fields are not sorted yet.
+func (f *Query) concatSort(sort interface{}) {
+	s := reflect.ValueOf(sort)
+	if s.Kind() != reflect.Slice {
+		return
+	}
+
+	for i := 0; i < s.Len(); i++ {
+		if key, known := sortKey(s.Index(i)); known && f.hasSort(key) {
+			continue
+		}
+
+		f.appendSort(s.Index(i).Interface())
+	}
+}
+
+// appendSort appends a document element to the Sort document.
+func (f *Query) appendSort(de interface{}) {
 	s := reflect.ValueOf(f.Sort)
 	deVal := reflect.ValueOf(de)
 
@@ -138,6 +805,4 @@ func (f *Query) AddSort(val string,
 	s = reflect.Append(s, deVal)
 
 	f.Sort = s.Interface()
-
-	return
 }
@@ -45,6 +45,56 @@ func TestAddSort(t *testing.T) {
 	_, err = q.AddSort("-x", docElemErr)
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, ErrNoSortField))
+
+	f, err = q.AddSort("test", docElemErr)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", f)
+	assert.Equal(t, []KV{{K: "test", V: -1}, {K: "field", V: 1}}, q.Sort)
+}
+
+func TestAddSortSpec(ts *testing.T) {
+	ts.Parallel()
+
+	docElem := func(k string, v interface{}) (kv interface{}, err error) {
+		return M{k: v}, nil
+	}
+
+	ts.Run("direction suffix", func(t *testing.T) {
+		t.Parallel()
+
+		var q Query
+
+		for val, expected := range map[string]string{
+			"a:asc":   "a",
+			"b:DESC":  "b",
+			"c.d:asc": "c.d",
+			"-e":      "e",
+			"f:up":    "f:up",
+			"-g:desc": "-g",
+		} {
+			f, err := q.AddSort(val, docElem)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, f, val)
+		}
+
+		assert.ElementsMatch(t, []M{
+			{"a": 1}, {"b": -1}, {"c.d": 1}, {"e": -1}, {"f:up": 1},
+			{"-g": -1},
+		}, q.Sort)
+	})
+
+	ts.Run("first wins", func(t *testing.T) {
+		t.Parallel()
+
+		var q Query
+
+		for _, val := range []string{"a", "-a", "b:desc", "a:desc", "+b"} {
+			_, err := q.AddSort(val, docElem)
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, []M{{"a": 1}, {"b": -1}}, q.Sort)
+	})
 }
 
 //nolint:paralleltest
@@ -75,6 +125,37 @@ func TestAppendArray(t *testing.T) {
 	arr2 := appendArray(nil, arr)
 	assert.Len(t, arr2, 2)
 	assert.Equal(t, arr, arr2)
+
+	assert.Equal(t, []interface{}{}, appendArray(nil, nil))
+	assert.Equal(t, []interface{}{val}, appendArray(val, nil))
+	assert.Equal(t, []interface{}{val}, appendArray(nil, val))
+
+	// typed nil arrays contribute nothing
+	var nilArray []interface{}
+
+	assert.Equal(t, []interface{}{}, appendArray(nilArray, nilArray))
+	assert.Equal(t, []interface{}{val}, appendArray(nilArray, val))
+	assert.Equal(t, []interface{}{val}, appendArray(val, nilArray))
+
+	// typed nil scalars are values
+	var nilPtr *int
+
+	assert.Equal(t, []interface{}{nilPtr, val}, appendArray(nilPtr, val))
+	assert.Equal(t, []interface{}{val, nilPtr}, appendArray(val, nilPtr))
+
+	// nested arrays are kept as elements
+	nested := []interface{}{1, 2}
+
+	assert.Equal(t, []interface{}{val, nested, 3},
+		appendArray(val, []interface{}{nested, 3}))
+	assert.Equal(t, []interface{}{nested, val},
+		appendArray([]interface{}{nested}, val))
+
+	// order is preserved
+	assert.Equal(t, []interface{}{1, 2, 3, 4},
+		appendArray([]interface{}{1, 2}, []interface{}{3, 4}))
+	assert.Equal(t, []interface{}{0, 1, 2},
+		appendArray(0, []interface{}{1, 2}))
 }
 
 //nolint:paralleltest
@@ -83,31 +164,31 @@ func TestAddFilter(t *testing.T) {
 
 	val := interface{}("value")
 
-	q.AddFilter("field", operatorEquals, val)
+	q.AddFilter("field", OpEquals, val)
 	assert.Len(t, q.Filter, 1)
 	assert.Equal(t, val, q.Filter["field"])
 
 	arr := appendArray(val, val)
 	q.Filter = nil
-	q.AddFilter("field", operatorIn, arr)
+	q.AddFilter("field", OpIn, arr)
 	assert.Len(t, q.Filter, 1)
 	assert.Equal(t, M{"$in": []interface{}{val, val}}, q.Filter["field"])
 
-	q.AddFilter("field2", operatorEquals, val)
+	q.AddFilter("field2", OpEquals, val)
 	assert.Len(t, q.Filter, 2)
 	assert.Equal(t, M{"$in": []interface{}{val, val}}, q.Filter["field"])
 	assert.Equal(t, val, q.Filter["field2"])
 
-	q.AddFilter("field3", operatorGreaterThan, val)
+	q.AddFilter("field3", OpGreaterThan, val)
 	assert.Len(t, q.Filter, 3)
 	assert.Equal(t, M{"$gt": val}, q.Filter["field3"])
 
-	q.AddFilter("field", operatorIn, val)
+	q.AddFilter("field", OpIn, val)
 	assert.Len(t, q.Filter, 3)
 	assert.Equal(t, M{"$in": []interface{}{val, val, val}},
 		q.Filter["field"])
 
-	q.AddFilter("field", operatorNotIn, val)
+	q.AddFilter("field", OpNotIn, val)
 	assert.Len(t, q.Filter, 3)
 	assert.Equal(t, M{
 		"$in":  []interface{}{val, val, val},
@@ -116,9 +197,459 @@ func TestAddFilter(t *testing.T) {
 		q.Filter["field"])
 
 	q.Filter = nil
-	q.AddFilter("field", operatorEquals, val)
-	q.AddFilter("field", operatorEqualArray, val)
+	q.AddFilter("field", OpEquals, val)
+	q.AddFilter("field", OpEqualArray, val)
 
 	assert.Len(t, q.Filter, 1)
 	assert.Equal(t, M{"$eq": []interface{}{val, val}}, q.Filter["field"])
+
+	q.Filter = nil
+	q.AddFilter("field", OpGreaterThanOrEquals, 1)
+	q.AddFilter("field", OpLessThan, 10)
+	q.AddFilter("field", OpIn, []interface{}{2, 3})
+	q.AddFilter("field", OpNotIn, []interface{}{4})
+	q.AddFilter("field", OpExists, true)
+	q.AddFilter("field", OpIn, 5)
+	q.AddFilter("field", OpNotIn, []interface{}{6, 7})
+
+	assert.Equal(t, M{"field": M{
+		"$gte":    1,
+		"$lt":     10,
+		"$in":     []interface{}{2, 3, 5},
+		"$nin":    []interface{}{4, 6, 7},
+		"$exists": true,
+	}}, q.Filter)
+
+	q.Filter = nil
+	q.AddFilter("field", OpEquals, val)
+	q.AddFilter("field", OpNotEquals, "other")
+	q.AddFilter("field", OpIn, []interface{}{val})
+
+	assert.Equal(t, M{"field": M{
+		"$eq": val,
+		"$ne": "other",
+		"$in": []interface{}{val},
+	}}, q.Filter)
+}
+
+func BenchmarkAddFilter(b *testing.B) {
+	type condition struct {
+		op  Operator
+		val interface{}
+	}
+
+	scenarios := map[string][]condition{
+		"eq": {
+			{OpEquals, "value"},
+		},
+		"eq upgrade": {
+			{OpEquals, "value"},
+			{OpNotEquals, "other"},
+		},
+		"range": {
+			{OpGreaterThanOrEquals, 1},
+			{OpLessThan, 10},
+		},
+		"in merge": {
+			{OpIn, []interface{}{1, 2, 3}},
+			{OpIn, []interface{}{4, 5}},
+			{OpIn, 6},
+		},
+		"range+in+nin+exists": {
+			{OpGreaterThanOrEquals, 1},
+			{OpLessThan, 10},
+			{OpIn, []interface{}{2, 3}},
+			{OpNotIn, []interface{}{4}},
+			{OpExists, true},
+			{OpIn, []interface{}{5, 6}},
+			{OpNotIn, 7},
+		},
+	}
+
+	for name, conditions := range scenarios {
+		conditions := conditions
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var q Query
+
+				for _, c := range conditions {
+					q.AddFilter("field", c.op, c.val)
+				}
+			}
+		})
+	}
+}
+
+//nolint:paralleltest
+func TestAddFilterConflict(t *testing.T) {
+	var q Query
+
+	assert.NoError(t, q.addFilter("status", operatorEquals, "open"))
+	assert.NoError(t, q.addFilter("status", operatorEquals, "open"))
+	assert.Equal(t, M{"status": "open"}, q.Filter)
+
+	err := q.addFilter("status", operatorEquals, "closed")
+
+	var parseErr ParseError
+
+	assert.True(t, errors.Is(err, ErrConflictingValues))
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, "status", parseErr.Field)
+	assert.Equal(t, []string{"open", "closed"}, parseErr.RawValues)
+	assert.Equal(t, M{"status": "open"}, q.Filter)
+
+	assert.NoError(t, q.addFilter("status", operatorNotEquals, "new"))
+	assert.True(t, errors.Is(
+		q.addFilter("status", operatorNotEquals, "old"),
+		ErrTooManyValues))
+	assert.True(t, errors.Is(
+		q.addFilter("status", operatorRegex, "clo"),
+		ErrConflictingValues))
+	assert.NoError(t, q.addFilter("status", operatorIn, []interface{}{1}))
+	assert.NoError(t, q.addFilter("status", operatorIn, []interface{}{2}))
+	assert.Equal(t, M{"status": M{
+		"$eq": "open",
+		"$ne": "new",
+		"$in": []interface{}{1, 2},
+	}}, q.Filter)
+}
+
+//nolint:paralleltest
+func TestQueryClone(t *testing.T) {
+	var q Query
+
+	assert.Equal(t, q, q.Clone())
+
+	q = Query{
+		Filter: M{
+			"a": M{"$in": []interface{}{1, M{"b": 2}}},
+			"c": "d",
+		},
+		Sort:       []string{"a", "b"},
+		Limit:      10,
+		Skip:       5,
+		Projection: map[string]int{"a": 1},
+	}
+
+	c := q.Clone()
+	assert.Equal(t, q, c)
+
+	c.Filter["a"].(M)["$in"].([]interface{})[1].(M)["b"] = 3
+	c.Filter["c"] = "e"
+	c.Sort.([]string)[0] = "x"
+	c.Projection["a"] = 0
+
+	assert.Equal(t, M{"b": 2}, q.Filter["a"].(M)["$in"].([]interface{})[1])
+	assert.Equal(t, "d", q.Filter["c"])
+	assert.Equal(t, []string{"a", "b"}, q.Sort)
+	assert.Equal(t, map[string]int{"a": 1}, q.Projection)
+}
+
+func TestQueryMerge(ts *testing.T) {
+	ts.Parallel()
+
+	parsed := func() Query {
+		return Query{
+			Filter: M{
+				"tenantId": M{"$in": []interface{}{"a", "b"}},
+				"deleted":  true,
+				"name":     "John",
+			},
+			Sort:  []string{"name"},
+			Limit: 10,
+		}
+	}
+
+	forced := Query{Filter: M{
+		"tenantId": "a",
+		"deleted":  false,
+		"name":     "John",
+		"active":   true,
+	}}
+
+	ts.Run("replace", func(t *testing.T) {
+		t.Parallel()
+
+		q := parsed()
+
+		assert.NoError(t, q.Merge(forced))
+		assert.Equal(t, M{
+			"tenantId": "a",
+			"deleted":  false,
+			"name":     "John",
+			"active":   true,
+		}, q.Filter)
+		assert.Equal(t, []string{"name"}, q.Sort)
+		assert.Equal(t, int64(10), q.Limit)
+	})
+
+	ts.Run("and", func(t *testing.T) {
+		t.Parallel()
+
+		q := parsed()
+		q.Filter["$and"] = []M{{"x": 1}}
+
+		assert.NoError(t, q.Merge(forced, MergeAnd))
+		assert.Equal(t, M{
+			"name":   "John",
+			"active": true,
+			"$and": []M{
+				{"x": 1},
+				{"deleted": true},
+				{"deleted": false},
+				{"tenantId": M{"$in": []interface{}{"a", "b"}}},
+				{"tenantId": "a"},
+			},
+		}, q.Filter)
+	})
+
+	ts.Run("strict", func(t *testing.T) {
+		t.Parallel()
+
+		q := parsed()
+
+		err := q.Merge(forced, MergeStrict)
+		assert.True(t, errors.Is(err, ErrFieldConflict))
+		assert.Contains(t, err.Error(), "deleted")
+		assert.Equal(t, parsed(), q)
+
+		q = Query{Filter: M{"name": "John", "$and": []M{{"x": 1}}}}
+
+		assert.NoError(t, q.Merge(Query{Filter: M{
+			"name": "John",
+			"age":  M{"$gte": 18},
+			"$and": []interface{}{M{"y": 2}},
+		}}, MergeStrict))
+		assert.Equal(t, M{
+			"name": "John",
+			"age":  M{"$gte": 18},
+			"$and": []M{{"x": 1}, {"y": 2}},
+		}, q.Filter)
+	})
+
+	ts.Run("and options", func(t *testing.T) {
+		t.Parallel()
+
+		q := Query{
+			Sort:  []M{{"name": 1}, {"age": -1}},
+			Limit: 10,
+			Skip:  5,
+		}
+
+		assert.NoError(t, q.Merge(Query{
+			Sort:  []M{{"age": 1}, {"_id": 1}},
+			Limit: 50,
+		}, MergeAnd))
+		assert.Equal(t, []M{{"name": 1}, {"age": -1}, {"_id": 1}}, q.Sort)
+		assert.Equal(t, int64(10), q.Limit)
+		assert.Equal(t, int64(5), q.Skip)
+
+		assert.NoError(t, q.Merge(Query{Limit: 3, Skip: 7}, MergeAnd))
+		assert.Equal(t, int64(3), q.Limit)
+		assert.Equal(t, int64(7), q.Skip)
+
+		q = Query{Limit: 0}
+		assert.NoError(t, q.Merge(Query{Limit: 20}, MergeAnd))
+		assert.Equal(t, int64(20), q.Limit)
+
+		q = Query{Filter: M{"a": 1}, Sort: []string{"a"}}
+
+		err := q.Merge(Query{Filter: M{"b": 2}, Sort: []M{{"b": 1}}}, MergeAnd)
+		assert.True(t, errors.Is(err, ErrFieldConflict))
+		assert.Equal(t, Query{Filter: M{"a": 1}, Sort: []string{"a"}}, q)
+	})
+
+	ts.Run("strict options", func(t *testing.T) {
+		t.Parallel()
+
+		q := Query{Filter: M{"a": 1}, Limit: 10, Skip: 5}
+
+		err := q.Merge(Query{Filter: M{"b": 2}, Limit: 20}, MergeStrict)
+		assert.True(t, errors.Is(err, ErrFieldConflict))
+		assert.Contains(t, err.Error(), "limit")
+
+		err = q.Merge(Query{Skip: 6}, MergeStrict)
+		assert.True(t, errors.Is(err, ErrFieldConflict))
+		assert.Contains(t, err.Error(), "skip")
+		assert.Equal(t, Query{Filter: M{"a": 1}, Limit: 10, Skip: 5}, q)
+
+		assert.NoError(t, q.Merge(Query{Limit: 10, Skip: 5}, MergeStrict))
+	})
+
+	ts.Run("options", func(t *testing.T) {
+		t.Parallel()
+
+		var q Query
+
+		other := Query{
+			Filter:     M{"a": M{"$gt": 1}},
+			Sort:       []string{"b"},
+			Skip:       5,
+			Projection: map[string]int{"c": 1},
+		}
+
+		assert.NoError(t, q.Merge(other))
+		assert.Equal(t, other, q)
+
+		// the merged-in values are copied
+		other.Filter["a"].(M)["$gt"] = 2
+		other.Sort.([]string)[0] = "x"
+		other.Projection["c"] = 0
+
+		assert.Equal(t, M{"a": M{"$gt": 1}}, q.Filter)
+		assert.Equal(t, []string{"b"}, q.Sort)
+		assert.Equal(t, map[string]int{"c": 1}, q.Projection)
+
+		assert.NoError(t, q.Merge(Query{Limit: 3}))
+		assert.Equal(t, int64(3), q.Limit)
+		assert.Equal(t, int64(5), q.Skip)
+		assert.Equal(t, []string{"b"}, q.Sort)
+	})
+
+	ts.Run("page", func(t *testing.T) {
+		t.Parallel()
+
+		q := Query{Skip: 5}
+
+		assert.NoError(t, q.Merge(Query{Limit: 25, Page: 1}))
+		assert.Equal(t, Query{Limit: 25, Page: 1}, q)
+
+		q = Query{Limit: 25, Skip: 50, Page: 3}
+
+		assert.NoError(t, q.Merge(Query{Filter: M{"a": 1}}, MergeAnd))
+		assert.EqualValues(t, 3, q.Page)
+
+		assert.NoError(t, q.Merge(Query{Limit: 10}, MergeAnd))
+		assert.Equal(t, Query{Filter: M{"a": 1}, Limit: 10, Skip: 50}, q)
+	})
+}
+
+//nolint:paralleltest
+func TestQueryPipeline(t *testing.T) {
+	q := Query{
+		Filter:     M{"a": M{"$gt": 1}},
+		Sort:       []M{{"b": -1}},
+		Limit:      5,
+		Skip:       10,
+		Projection: map[string]int{"a": 1},
+	}
+
+	pipeline := q.Pipeline()
+	assert.Equal(t, []M{
+		{"$match": M{"a": M{"$gt": 1}}},
+		{"$sort": []M{{"b": -1}}},
+		{"$skip": int64(10)},
+		{"$limit": int64(5)},
+		{"$project": map[string]int{"a": 1}},
+	}, pipeline)
+
+	// the stages are copies of the query documents
+	pipeline[0]["$match"].(M)["a"].(M)["$gt"] = 2
+	assert.Equal(t, M{"a": M{"$gt": 1}}, q.Filter)
+
+	assert.Nil(t, Query{}.Pipeline())
+	assert.Equal(t, []M{{"$limit": int64(5)}}, Query{Limit: 5}.Pipeline())
+}
+
+//nolint:paralleltest
+func TestQueryFacetPipeline(t *testing.T) {
+	q := Query{Filter: M{"a": 1}, Sort: []M{{"b": -1}}, Limit: 5}
+
+	assert.Equal(t, []M{
+		{"$match": M{"a": 1}},
+		{"$facet": M{
+			"data":  []M{{"$sort": []M{{"b": -1}}}, {"$limit": int64(5)}},
+			"total": []M{{"$count": "count"}},
+		}},
+	}, q.FacetPipeline())
+
+	assert.Equal(t, []M{{"$facet": M{
+		"data":  []M{{"$match": M{}}},
+		"total": []M{{"$count": "count"}},
+	}}}, Query{}.FacetPipeline())
+}
+
+//nolint:paralleltest
+func TestQueryOrderedFilter(t *testing.T) {
+	docElem := testOidPrimitive{}.DocElem
+
+	filter, err := Query{}.OrderedFilter(docElem)
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+
+	q := Query{Filter: M{
+		"b": M{"$lt": 5, "$gt": 1},
+		"a": []interface{}{M{"y": 1, "x": 2}, 3},
+		"$or": []M{
+			{"c": 1},
+		},
+		"d": M{},
+	}}
+
+	filter, err = q.OrderedFilter(docElem)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"$or": []interface{}{[]map[string]interface{}{{"c": 1}}}},
+		{"a": []interface{}{
+			[]map[string]interface{}{{"x": 2}, {"y": 1}}, 3,
+		}},
+		{"b": []map[string]interface{}{{"$gt": 1}, {"$lt": 5}}},
+		{"d": M{}},
+	}, filter)
+
+	docElem = testOidPrimitive{
+		forbidSortFields: map[string]struct{}{"$gt": {}},
+	}.DocElem
+
+	_, err = q.OrderedFilter(docElem)
+	assert.True(t, errors.Is(err, ErrNoSortField), "unexpected err: %v", err)
+}
+
+//nolint:paralleltest
+func TestQueryAddAnd(t *testing.T) {
+	var q Query
+
+	q.AddAnd()
+	assert.Nil(t, q.Filter)
+
+	q.AddAnd(M{"tags": M{"$in": []interface{}{"a", "b"}}})
+	q.AddAnd(M{"tags": M{"$in": []interface{}{"c"}}}, M{"x": 1})
+	assert.Equal(t, M{"$and": []M{
+		{"tags": M{"$in": []interface{}{"a", "b"}}},
+		{"tags": M{"$in": []interface{}{"c"}}},
+		{"x": 1},
+	}}, q.Filter)
+
+	q = Query{Filter: M{"$and": []interface{}{M{"a": 1}}}}
+	q.AddAnd(M{"b": 2})
+	assert.Equal(t, M{"$and": []M{{"a": 1}, {"b": 2}}}, q.Filter)
+}
+
+//nolint:paralleltest
+func TestAddFilterNot(t *testing.T) {
+	var q Query
+
+	q.addCondition("age", "not__gt", 30)
+	q.addCondition("age", operatorNotEquals, 5)
+	q.addCondition("tags", "not__all", []interface{}{"a", "b"})
+	q.addCondition("name", "not__ieq", testRegEx{regex: "^a$", options: "i"})
+	q.addCondition("score", "not__range", valueRange{
+		{op: operatorGreaterThanOrEquals, value: 1},
+		{op: operatorLessThanOrEquals, value: 5},
+	})
+
+	assert.Equal(t, M{
+		"age":  M{"$not": M{"$gt": 30}, "$ne": 5},
+		"tags": M{"$not": M{"$all": []interface{}{"a", "b"}}},
+		"name": M{"$not": M{
+			"$eq": testRegEx{regex: "^a$", options: "i"},
+		}},
+		"score": M{"$not": M{"$gte": 1, "$lte": 5}},
+	}, q.Filter)
+
+	_, doc := notCondition(operatorEquals, 3)
+	assert.Equal(t, M{"$eq": 3}, doc)
 }
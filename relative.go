@@ -0,0 +1,132 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeBases are the starting points of the relative date expressions.
+// They are evaluated in UTC.
+var relativeBases = map[string]func(now time.Time) time.Time{
+	"now": func(now time.Time) time.Time { return now },
+	"startOfDay": func(now time.Time) time.Time {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0,
+			time.UTC)
+	},
+	"startOfWeek": func(now time.Time) time.Time {
+		// the weeks start on Monday
+		offset := (int(now.Weekday()) + 6) % 7
+
+		return time.Date(now.Year(), now.Month(), now.Day()-offset,
+			0, 0, 0, 0, time.UTC)
+	},
+	"startOfMonth": func(now time.Time) time.Time {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	},
+	"startOfYear": func(now time.Time) time.Time {
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	},
+}
+
+// RelativeDate converts the relative date expressions to time.Time.
+// An expression is a base, i.e. "now", "startOfDay", "startOfWeek",
+// "startOfMonth" or "startOfYear", followed by any number of signed offsets
+// with the "s", "m", "h", "d", "w", "M" (months) and "y" units, i.e.
+// "now-7d" or "startOfMonth-1M". The expressions are evaluated in UTC at the
+// time returned by now, nil now is time.Now.
+func RelativeDate(now func() time.Time) (convert ConvertFunc) {
+	if now == nil {
+		now = time.Now
+	}
+
+	return func(val string) (i interface{}, err error) {
+		t, ok := relativeTime(val, now().UTC())
+		if !ok {
+			return nil, ErrNoMatch
+		}
+
+		return t, nil
+	}
+}
+
+// isRelativeDate reports whether a value is a relative date expression.
+// The parsed queries with such values depend on the time of parsing, so
+// they are never cached.
+func isRelativeDate(val string) (ok bool) {
+	_, ok = relativeTime(val, time.Time{})
+
+	return ok
+}
+
+// relativeTime evaluates a relative date expression at now.
+func relativeTime(val string, now time.Time) (t time.Time, ok bool) {
+	end := strings.IndexAny(val, "+-")
+	if end < 0 {
+		end = len(val)
+	}
+
+	base, ok := relativeBases[val[:end]]
+	if !ok {
+		return t, false
+	}
+
+	return addOffsets(base(now), val[end:])
+}
+
+// addOffsets adds the signed offsets of a relative date expression, i.e.
+// "-1M+2d", to a time.
+func addOffsets(t time.Time, offsets string) (res time.Time, ok bool) {
+	for len(offsets) > 0 {
+		sign := 1
+
+		switch offsets[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			return res, false
+		}
+
+		digits := 1
+		for digits < len(offsets) &&
+			offsets[digits] >= '0' && offsets[digits] <= '9' {
+			digits++
+		}
+
+		// at least one digit and a unit are required
+		if digits == 1 || digits == len(offsets) {
+			return res, false
+		}
+
+		n, err := strconv.Atoi(offsets[1:digits])
+		if err != nil {
+			return res, false
+		}
+
+		n *= sign
+
+		switch offsets[digits] {
+		case 's':
+			t = t.Add(time.Duration(n) * time.Second)
+		case 'm':
+			t = t.Add(time.Duration(n) * time.Minute)
+		case 'h':
+			t = t.Add(time.Duration(n) * time.Hour)
+		case 'd':
+			t = t.AddDate(0, 0, n)
+		case 'w':
+			t = t.AddDate(0, 0, 7*n)
+		case 'M':
+			t = t.AddDate(0, n, 0)
+		case 'y':
+			t = t.AddDate(n, 0, 0)
+		default:
+			return res, false
+		}
+
+		offsets = offsets[digits+1:]
+	}
+
+	return t, true
+}
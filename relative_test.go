@@ -0,0 +1,93 @@
+package query
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//nolint:paralleltest
+func TestRelativeDate(t *testing.T) {
+	// Wednesday
+	now := time.Date(2023, time.March, 15, 13, 45, 30, 0, time.UTC)
+	convert := RelativeDate(func() time.Time { return now })
+
+	for val, expected := range map[string]time.Time{
+		"now":             now,
+		"now-7d":          now.AddDate(0, 0, -7),
+		"now+1h":          now.Add(time.Hour),
+		"now-30m":         now.Add(-30 * time.Minute),
+		"now-15s":         now.Add(-15 * time.Second),
+		"now-2w":          now.AddDate(0, 0, -14),
+		"now-1y":          now.AddDate(-1, 0, 0),
+		"startOfDay":      time.Date(2023, time.March, 15, 0, 0, 0, 0, time.UTC),
+		"startOfDay-1d":   time.Date(2023, time.March, 14, 0, 0, 0, 0, time.UTC),
+		"startOfWeek":     time.Date(2023, time.March, 13, 0, 0, 0, 0, time.UTC),
+		"startOfMonth":    time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC),
+		"startOfMonth-1M": time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"startOfYear":     time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"now-1M+2d":       time.Date(2023, time.February, 17, 13, 45, 30, 0, time.UTC),
+	} {
+		i, err := convert(val)
+		assert.NoError(t, err, val)
+		assert.Equal(t, expected, i, val)
+	}
+
+	for _, val := range []string{
+		"", "today", "now-", "now-7", "now-d", "now-7x", "now7d",
+		"now-7dx", "startofday", "-7d",
+	} {
+		_, err := convert(val)
+		assert.True(t, errors.Is(err, ErrNoMatch), val)
+	}
+}
+
+//nolint:paralleltest
+func TestRelativeDateStartOfWeek(t *testing.T) {
+	monday := time.Date(2023, time.March, 13, 0, 0, 0, 0, time.UTC)
+
+	for day := 0; day < 7; day++ {
+		now := monday.AddDate(0, 0, day).Add(5 * time.Hour)
+
+		i, err := RelativeDate(func() time.Time { return now })("startOfWeek")
+		assert.NoError(t, err)
+		assert.Equal(t, monday, i, now.Weekday().String())
+	}
+}
+
+//nolint:paralleltest
+func TestRelativeDateLocation(t *testing.T) {
+	// 2023-03-15 01:00 in UTC+3 is 2023-03-14 22:00 in UTC
+	now := time.Date(2023, time.March, 15, 1, 0, 0, 0,
+		time.FixedZone("UTC+3", 3*60*60))
+
+	i, err := RelativeDate(func() time.Time { return now })("startOfDay")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, time.March, 14, 0, 0, 0, 0, time.UTC), i)
+}
+
+//nolint:paralleltest
+func TestDateRelative(t *testing.T) {
+	before := time.Now().UTC()
+
+	i, err := Date(AcceptRelative)("now-1h")
+	assert.NoError(t, err)
+
+	if assert.IsType(t, time.Time{}, i) {
+		got := i.(time.Time)
+		assert.False(t, got.Before(before.Add(-time.Hour)))
+		assert.False(t, got.After(time.Now().UTC().Add(-time.Hour)))
+	}
+
+	_, err = Date()("now")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+
+	_, err = Date(AcceptRelative)("1672531200")
+	assert.True(t, errors.Is(err, ErrNoMatch))
+
+	i, err = Date(AcceptRelative, AcceptUnixSeconds)("1672531200")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC), i)
+}
@@ -0,0 +1,95 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	formContentType          = "application/x-www-form-urlencoded"
+	multipartFormContentType = "multipart/form-data"
+
+	// maxFormMemory is the number of bytes of a multipart form kept in
+	// memory, it is the default of the net/http package.
+	maxFormMemory = 32 << 20
+)
+
+// ParseRequest parses the URL query of a request together with the form
+// values of the POST, PUT and PATCH requests with a form content type.
+// The URL query values win over the form values of the same key unless
+// the parser's PreferForm is set.
+func (p *Parser) ParseRequest(r *http.Request) (filter Query, err error) {
+	params := r.URL.Query()
+
+	form, err := requestForm(r)
+	if err != nil {
+		return p.parseMalformed(params, err)
+	}
+
+	for key, values := range form {
+		if _, exists := params[key]; !exists || p.PreferForm {
+			params[key] = values
+		}
+	}
+
+	return p.Parse(params)
+}
+
+// ParseString parses a raw URL query, i.e. "name=John&__limit=10".
+// A leading "?" is ignored.
+func (p *Parser) ParseString(rawQuery string) (filter Query, err error) {
+	params, err := url.ParseQuery(strings.TrimPrefix(rawQuery, "?"))
+	if err != nil {
+		return p.parseMalformed(params, err)
+	}
+
+	return p.Parse(params)
+}
+
+// requestForm returns the form values of a request with a form content
+// type, other requests have no form values.
+func requestForm(r *http.Request) (form url.Values, err error) {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, nil
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+
+	switch contentType {
+	case formContentType:
+		err = r.ParseForm()
+	case multipartFormContentType:
+		err = r.ParseMultipartForm(maxFormMemory)
+	default:
+		return nil, nil
+	}
+
+	return r.PostForm, err
+}
+
+// parseMalformed reports a malformed query or form with ErrMalformedQuery.
+// With PartialResults the values that were decoded are parsed anyway.
+func (p *Parser) parseMalformed(params url.Values, cause error) (
+	filter Query, err error) {
+	errs := []error{fmt.Errorf("%w: %v", ErrMalformedQuery, cause)}
+
+	if p.PartialResults {
+		filter, err = p.parse(params)
+
+		var parseErrs *ParseErrors
+		if errors.As(err, &parseErrs) {
+			errs = append(errs, parseErrs.errs...)
+		}
+	}
+
+	return filter, &ParseErrors{errs: errs, format: p.ErrorFormatter}
+}
@@ -0,0 +1,146 @@
+package query
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParserParseRequest(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	ts.Run("get", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodGet,
+			"/users?name=John&age__gte=18&__sort=+age,-name&__limit=5", nil)
+
+		q, err := p.ParseRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "John", "age": M{"$gte": int64(18)}},
+			q.Filter)
+		assert.Equal(t, []M{{"age": 1}, {"name": -1}}, q.Sort)
+		assert.Equal(t, int64(5), q.Limit)
+	})
+
+	ts.Run("post form", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/users?name=John&age=30",
+			strings.NewReader("name=Jane&city=Paris&__limit=7"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		q, err := p.ParseRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "John", "age": int64(30), "city": "Paris"},
+			q.Filter)
+		assert.Equal(t, int64(7), q.Limit)
+
+		prefer := p
+		prefer.PreferForm = true
+
+		r = httptest.NewRequest(http.MethodPost, "/users?name=John",
+			strings.NewReader("name=Jane"))
+		r.Header.Set("Content-Type",
+			"application/x-www-form-urlencoded; charset=utf-8")
+
+		q, err = prefer.ParseRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "Jane"}, q.Filter)
+	})
+
+	ts.Run("post multipart form", func(t *testing.T) {
+		t.Parallel()
+
+		var body bytes.Buffer
+
+		w := multipart.NewWriter(&body)
+		assert.NoError(t, w.WriteField("city", "Paris"))
+		assert.NoError(t, w.Close())
+
+		r := httptest.NewRequest(http.MethodPost, "/users?name=John", &body)
+		r.Header.Set("Content-Type", w.FormDataContentType())
+
+		q, err := p.ParseRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "John", "city": "Paris"}, q.Filter)
+	})
+
+	ts.Run("other bodies are ignored", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/users?name=John",
+			strings.NewReader(`{"city":"Paris"}`))
+		r.Header.Set("Content-Type", "application/json")
+
+		q, err := p.ParseRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "John"}, q.Filter)
+
+		r = httptest.NewRequest(http.MethodGet, "/users?name=John",
+			strings.NewReader("city=Paris"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		q, err = p.ParseRequest(r)
+		assert.NoError(t, err)
+		assert.Equal(t, M{"name": "John"}, q.Filter)
+	})
+
+	ts.Run("malformed form", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/users?name=John",
+			strings.NewReader("city=%zz"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		q, err := p.ParseRequest(r)
+		assert.True(t, errors.Is(err, ErrMalformedQuery))
+		assert.Equal(t, Query{}, q)
+	})
+}
+
+func TestParserParseString(ts *testing.T) {
+	ts.Parallel()
+
+	p := Parser{Converter: NewDefaultConverter(testOidPrimitive{})}
+
+	ts.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, raw := range []string{
+			"name=John&__sort=+age", "?name=John&__sort=%2Bage",
+		} {
+			q, err := p.ParseString(raw)
+			assert.NoError(t, err, raw)
+			assert.Equal(t, M{"name": "John"}, q.Filter, raw)
+			assert.Equal(t, []M{{"age": 1}}, q.Sort, raw)
+		}
+	})
+
+	ts.Run("malformed", func(t *testing.T) {
+		t.Parallel()
+
+		q, err := p.ParseString("name=%zz&age=x&__limit=5")
+		assert.True(t, errors.Is(err, ErrMalformedQuery))
+		assert.Equal(t, Query{}, q)
+
+		var parseErrs *ParseErrors
+		assert.True(t, errors.As(err, &parseErrs))
+
+		partial := p
+		partial.PartialResults = true
+
+		q, err = partial.ParseString("name=%zz&age__gte=x&__limit=5")
+		assert.True(t, errors.Is(err, ErrMalformedQuery))
+		assert.Equal(t, M{"age": M{"$gte": "x"}}, q.Filter)
+		assert.Equal(t, int64(5), q.Limit)
+	})
+}
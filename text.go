@@ -0,0 +1,107 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	textOperator = mongoOpPrefix + "text"
+
+	// scoreSortField is a sort value that sorts by the text search score.
+	scoreSortField = delimiter + "score"
+	// textScoreField is a name of the text score sort field.
+	textScoreField = "score"
+)
+
+// parseTextSearch converts the __search directive to a $text document,
+// i.e. "__search=coffee shop&__search_lang=en" to
+// {"$search": "coffee shop", "$language": "en"}. Several __search values
+// are joined with a space and the __search_case and __search_diacritic
+// flags are added as $caseSensitive and $diacriticSensitive. The text is
+// nil without the directive.
+func (p *Parser) parseTextSearch(params url.Values) (text M, err error) {
+	values, hasSearch := params[delimiter+searchParam]
+	if !hasSearch {
+		return nil, nil
+	}
+
+	if !p.AllowTextSearch {
+		return nil, fmt.Errorf("%w: %s", ErrTextSearchDisabled,
+			delimiter+searchParam)
+	}
+
+	terms := make([]string, 0, len(values))
+
+	for _, val := range values {
+		if val = strings.TrimSpace(val); len(val) > 0 {
+			terms = append(terms, val)
+		}
+	}
+
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyValue,
+			delimiter+searchParam)
+	}
+
+	text = M{"$search": strings.Join(terms, " ")}
+
+	if lang := params.Get(delimiter + searchLangParam); len(lang) > 0 {
+		text["$language"] = lang
+	}
+
+	err = p.addSearchFlag(text, params, searchCaseParam, "$caseSensitive")
+	if err == nil {
+		err = p.addSearchFlag(text, params, diacriticParam,
+			"$diacriticSensitive")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return text, nil
+}
+
+// addSearchFlag adds a boolean flag of the text search to the $text
+// document when its directive is given.
+func (p *Parser) addSearchFlag(text M, params url.Values, name,
+	mongoOp string) (err error) {
+	str := params.Get(delimiter + name)
+	if len(str) == 0 {
+		return nil
+	}
+
+	flag, err := p.boolConverter().Convert(str)
+	if err != nil {
+		return fmt.Errorf("%s parameter: %w", name, err)
+	}
+
+	text[mongoOp] = flag
+
+	return nil
+}
+
+// addScoreSort sorts a query by the text search score. It needs the $text
+// condition, so it is reported with ErrNoSortField without __search.
+func (p *Parser) addScoreSort(filter *Query) (err error) {
+	if _, hasText := filter.Filter[textOperator]; !hasText {
+		return fmt.Errorf("%w: %s needs %s", ErrNoSortField,
+			scoreSortField, delimiter+searchParam)
+	}
+
+	if filter.hasSort(textScoreField) {
+		return nil
+	}
+
+	de, err := p.Converter.Primitives.DocElem(textScoreField,
+		M{"$meta": "textScore"})
+	if err != nil {
+		return fmt.Errorf("add sort: %w: %s", err, scoreSortField)
+	}
+
+	filter.appendSort(de)
+
+	return nil
+}